@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"os"
@@ -13,9 +15,42 @@ import (
 	"gopher-market/internal/httpserver"
 	"gopher-market/internal/logging"
 	"gopher-market/internal/loyalty"
-	"gopher-market/internal/model"
+	"gopher-market/internal/metrics"
+	"gopher-market/internal/ops"
+	"gopher-market/internal/ratelimit"
+	"gopher-market/internal/tlsconfig"
+	"gopher-market/internal/trace"
+	"gopher-market/internal/webhook"
 )
 
+// eventsRetention — сколько хранятся события пользователей для возобновления SSE-потока
+const eventsRetention = 24 * time.Hour
+
+// accrualTLSConfig собирает TLS-настройки клиента системы расчета; клиентский сертификат
+// перечитывается при изменении файлов до отмены ctx
+func accrualTLSConfig(ctx context.Context, cfg config.Config) (*tls.Config, error) {
+	minVersion, err := tlsconfig.ParseVersion(cfg.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	var rootCAs *x509.CertPool
+	if cfg.AccrualCAFile != "" {
+		if rootCAs, err = tlsconfig.LoadCertPool(cfg.AccrualCAFile); err != nil {
+			return nil, err
+		}
+	}
+
+	var cert *tlsconfig.Reloader
+	if cfg.AccrualCertFile != "" {
+		if cert, err = tlsconfig.NewReloader(cfg.AccrualCertFile, cfg.AccrualKeyFile); err != nil {
+			return nil, err
+		}
+		go cert.Watch(ctx, tlsconfig.ReloadInterval)
+	}
+	return tlsconfig.Client(cert, minVersion, rootCAs), nil
+}
+
 func main() {
 	logging.Logg = logging.NewLogger("debug", "text", "json", "both", "logs/2006-01-02.log")
 	if logging.Logg == nil {
@@ -31,6 +66,16 @@ func main() {
 	}
 
 	logging.Logg.Info("cfg", "cfg", cfg.DBDSN)
+
+	if cfg.TraceExport != "" {
+		exporter, closer, err := trace.Open(cfg.TraceExport)
+		if err != nil {
+			logging.Logg.Error("Failed to open trace export", "error", err)
+			os.Exit(1)
+		}
+		defer closer.Close()
+		trace.SetExporter(exporter)
+	}
 	handler, err := handlers.NewHandler(&cfg)
 	if err != nil {
 		logging.Logg.Error("Server creation error", "error", err)
@@ -41,9 +86,23 @@ func main() {
 	defer cancel()
 
 	pool := loyalty.NewWorkerPool(ctx, 10)
+	if cfg.AccrualCAFile != "" || cfg.AccrualCertFile != "" {
+		tlsCfg, err := accrualTLSConfig(ctx, cfg)
+		if err != nil {
+			logging.Logg.Error("Failed to configure accrual TLS", "error", err)
+			os.Exit(1)
+		}
+		pool.SetTLSConfig(tlsCfg)
+	}
 	pool.Start()
 	defer pool.Stop()
 
+	metrics.Default.GaugeFunc("gophermart_worker_queue_length", "Accrual tasks waiting for a free worker.",
+		func() float64 { return float64(pool.QueueLength()) })
+	metrics.Default.GaugeFunc("gophermart_worker_in_flight", "Accrual tasks currently being processed.",
+		func() float64 { return float64(pool.InFlight()) })
+	metrics.RegisterDBStats(handler.Service.Repo.DB)
+
 	resultChan := make(chan *loyalty.Accrual)
 	errorChan := make(chan error)
 
@@ -53,8 +112,85 @@ func main() {
 		os.Exit(1)
 	}
 
+	srv.Health.AddCheck("accrual", func(context.Context) error {
+		if pool.CircuitState() == loyalty.CircuitOpen {
+			return loyalty.ErrCircuitOpen
+		}
+		return nil
+	})
+	metrics.Default.GaugeFunc("gophermart_accrual_circuit_open", "Whether requests to the accrual system are suspended.",
+		func() float64 {
+			if pool.CircuitState() == loyalty.CircuitOpen {
+				return 1
+			}
+			return 0
+		})
+
 	srv.Start()
 
+	// Служебный сервер не входит в публичный роутер и по умолчанию доступен только с localhost
+	var opsSrv *ops.Server
+	if cfg.OpsAddress != "" {
+		opsSrv = ops.New(cfg.OpsAddress, pool)
+		opsSrv.Start()
+	}
+
+	dispatcher := webhook.NewDispatcher(&handler.Service.Repo)
+	go dispatcher.Run(ctx)
+
+	if cfg.EventsNotify {
+		go handler.Service.Events.Listen(ctx)
+	}
+
+	// Снятие просроченных удержаний баллов и отклонение неподтвержденных вовремя переводов
+	go func() {
+		holds := time.NewTicker(time.Minute)
+		defer holds.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-holds.C:
+				if err := handler.Service.ReleaseExpiredHolds(); err != nil {
+					logging.Logg.Error("Failed to release expired holds", "error", err)
+				}
+				if err := handler.Service.DeclineExpiredTransfers(); err != nil {
+					logging.Logg.Error("Failed to decline expired transfers", "error", err)
+				}
+			}
+		}
+	}()
+
+	// Периодическое обслуживание: очистка старых событий, сгорание баллов, пересчет уровней, очистка операций риск-движка и давно не использованных корзин ограничения частоты
+	go func() {
+		cleanup := time.NewTicker(time.Hour)
+		defer cleanup.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-cleanup.C:
+				handler.Service.Events.Cleanup(eventsRetention)
+				if err := handler.Service.ExpirePoints(); err != nil {
+					logging.Logg.Error("Failed to expire points", "error", err)
+				}
+				if err := handler.Service.RecalculateTiers(); err != nil {
+					logging.Logg.Error("Failed to recalculate tiers", "error", err)
+				}
+				if err := handler.Service.CleanupRiskEvents(); err != nil {
+					logging.Logg.Error("Failed to clean up risk events", "error", err)
+				}
+				if cfg.RateLimitStore == config.RateLimitPostgres {
+					// Корзина, простоявшая дольше самого длинного окна, полна и эквивалентна отсутствующей
+					idle := ratelimit.MaxWindow(cfg.RateLimitRules)
+					if _, err := handler.Service.Repo.DeleteRateLimitsBefore(time.Now().Add(-idle)); err != nil {
+						logging.Logg.Error("Failed to clean up rate limits", "error", err)
+					}
+				}
+			}
+		}
+	}()
+
 	go func() {
 		for {
 			select {
@@ -67,14 +203,11 @@ func main() {
 					"accrual", result.Accrual,
 				)
 
-				order, _ := handler.Service.Repo.GetOrderByNumber(result.Order)
-				if order.Status != model.StatusProcessed && order.Status != model.StatusInvalid {
-					if err := handler.Service.Repo.UpdateOrder(result.Order, result.Status, result.Accrual); err != nil {
-						logging.Logg.Error("Failed to update order status",
-							"order", result.Order,
-							"error", err,
-						)
-					}
+				if err := handler.Service.ProcessAccrual(trace.ContextWithRemote(ctx, result.Trace), result); err != nil {
+					logging.Logg.Error("Failed to update order status",
+						"order", result.Order,
+						"error", err,
+					)
 				}
 
 			case err := <-errorChan:
@@ -93,6 +226,29 @@ func main() {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
+	// Рассчитанные заказы перепроверяются, чтобы учесть пересмотр вознаграждения системой расчёта
+	recheck := time.NewTicker(cfg.AccrualRecheckInterval)
+	defer recheck.Stop()
+	if cfg.AccrualRecheckWindow == 0 {
+		recheck.Stop()
+	}
+
+	addTasks := func(orderNumbers []string) {
+		// На паузе очередь не пополняется: незавершенные заказы будут выбраны снова после возобновления
+		if pool.Paused() {
+			return
+		}
+		for _, orderNumber := range orderNumbers {
+			task := loyalty.Task{
+				BaseURL:     handler.Config.Accrual,
+				OrderNumber: orderNumber,
+				ResultChan:  resultChan,
+				ErrorChan:   errorChan,
+			}
+			pool.AddTask(task)
+		}
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -102,10 +258,9 @@ func main() {
 
 			logging.Logg.Info("Shutting down server gracefully")
 
-			pool.Stop()
-			pool.Wait()
-
-			shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			// Сначала сервер перестает быть готовым и дожидается исключения из балансировки,
+			// затем завершает активные запросы, и только после этого останавливается обработка заказов
+			shutdownCtx, cancel := context.WithTimeout(ctx, cfg.ShutdownDrain+10*time.Second)
 			defer cancel()
 
 			if err := srv.Shutdown(shutdownCtx); err != nil {
@@ -113,6 +268,15 @@ func main() {
 				logging.Logg.Warn("Forcefully exiting program")
 				os.Exit(1)
 			}
+
+			pool.Stop()
+			pool.Wait()
+
+			if opsSrv != nil {
+				if err := opsSrv.Shutdown(shutdownCtx); err != nil {
+					logging.Logg.Error("Ops server shutdown error", "error", err)
+				}
+			}
 			logging.Logg.Info("Server stopped")
 			return
 
@@ -128,15 +292,16 @@ func main() {
 				continue
 			}
 
-			for _, orderNumber := range orderNumbers {
-				task := loyalty.Task{
-					BaseURL:     handler.Config.Accrual,
-					OrderNumber: orderNumber,
-					ResultChan:  resultChan,
-					ErrorChan:   errorChan,
-				}
-				pool.AddTask(task)
+			addTasks(orderNumbers)
+
+		case <-recheck.C:
+			orderNumbers, err := handler.Service.Repo.GetOrdersForRecheck(time.Now().Add(-cfg.AccrualRecheckWindow))
+			if err != nil {
+				logging.Logg.Error("Failed to fetch orders for recheck", "error", err)
+				continue
 			}
+			logging.Logg.Info("Rechecking processed orders", "count", len(orderNumbers))
+			addTasks(orderNumbers)
 		}
 	}
 }
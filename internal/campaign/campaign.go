@@ -0,0 +1,102 @@
+package campaign
+
+import (
+	"errors"
+	"fmt"
+	"gopher-market/internal/model"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrEmptyName   = errors.New("campaign name is empty")
+	ErrWindow      = errors.New("campaign must end after it starts")
+	ErrMultiplier  = errors.New("campaign multiplier must not be less than 1")
+	ErrNegative    = errors.New("campaign fixed bonus must not be negative")
+	ErrNoBonus     = errors.New("campaign gives no bonus")
+	ErrOrderPrefix = errors.New("campaign order prefix must be numeric")
+	ErrUnknownTier = errors.New("campaign tier is not configured")
+	ErrDuplicate   = errors.New("campaign tiers must not repeat")
+)
+
+// Order — сведения о рассчитанном заказе, по которым проверяются условия акций
+type Order struct {
+	Number     string    // номер заказа
+	Accrual    float32   // вознаграждение системы расчёта
+	Tier       string    // уровень владельца заказа
+	FirstOrder bool      // первый рассчитанный заказ пользователя
+	At         time.Time // момент расчета заказа
+}
+
+// Validate проверяет настройки акции перед сохранением; уровни акции должны быть среди настроенных tiers
+func Validate(c model.Campaign, tiers []model.Tier) error {
+	var errs []error
+	if strings.TrimSpace(c.Name) == "" {
+		errs = append(errs, ErrEmptyName)
+	}
+	if !c.EndsAt.After(c.StartsAt) {
+		errs = append(errs, ErrWindow)
+	}
+	if c.Multiplier < 1 {
+		errs = append(errs, ErrMultiplier)
+	}
+	if c.FixedBonus < 0 {
+		errs = append(errs, ErrNegative)
+	}
+	if c.Multiplier == 1 && c.FixedBonus == 0 {
+		errs = append(errs, ErrNoBonus)
+	}
+	if strings.Trim(c.OrderPrefix, "0123456789") != "" {
+		errs = append(errs, ErrOrderPrefix)
+	}
+	seen := make(map[string]bool, len(c.Tiers))
+	for _, name := range c.Tiers {
+		if !slices.ContainsFunc(tiers, func(t model.Tier) bool { return t.Name == name }) {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrUnknownTier, name))
+		}
+		if seen[name] {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrDuplicate, name))
+		}
+		seen[name] = true
+	}
+	return errors.Join(errs...)
+}
+
+// Eligible сообщает, подходит ли заказ под условия акции
+func Eligible(c model.Campaign, order Order) bool {
+	if !c.Active || order.At.Before(c.StartsAt) || !order.At.Before(c.EndsAt) {
+		return false
+	}
+	if c.FirstOrder && !order.FirstOrder {
+		return false
+	}
+	if len(c.Tiers) > 0 && !slices.Contains(c.Tiers, order.Tier) {
+		return false
+	}
+	return strings.HasPrefix(order.Number, c.OrderPrefix)
+}
+
+// Bonus рассчитывает бонус акции за заказ: надбавку по множителю плюс фиксированную сумму
+func Bonus(c model.Campaign, accrual float32) float32 {
+	bonus := c.FixedBonus
+	if accrual > 0 {
+		bonus += accrual * (c.Multiplier - 1)
+	}
+	return max(bonus, 0)
+}
+
+// Evaluate возвращает бонусы всех подходящих акций, каждая акция дает отдельный бонус.
+// Акции суммируются: заказ, подходящий под несколько акций, получает бонус каждой из них.
+func Evaluate(campaigns []model.Campaign, order Order) []model.Bonus {
+	var bonuses []model.Bonus
+	for _, c := range campaigns {
+		if !Eligible(c, order) {
+			continue
+		}
+		if amount := Bonus(c, order.Accrual); amount > 0 {
+			bonuses = append(bonuses, model.Bonus{Type: model.CampaignBonus, Amount: amount})
+		}
+	}
+	return bonuses
+}
@@ -0,0 +1,98 @@
+package campaign
+
+import (
+	"gopher-market/internal/model"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	valid := model.Campaign{Name: "weekend", StartsAt: start, EndsAt: start.AddDate(0, 0, 2), Multiplier: 2, Tiers: []string{"silver", "gold"}}
+	tiers := []model.Tier{{Name: "bronze"}, {Name: "silver", Threshold: 1000}, {Name: "gold", Threshold: 5000}}
+
+	if err := Validate(valid, tiers); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *model.Campaign)
+	}{
+		{"Empty name", func(c *model.Campaign) { c.Name = " " }},
+		{"Ends before start", func(c *model.Campaign) { c.EndsAt = c.StartsAt }},
+		{"Multiplier below one", func(c *model.Campaign) { c.Multiplier = 0.5 }},
+		{"No bonus", func(c *model.Campaign) { c.Multiplier = 1 }},
+		{"Negative fixed bonus", func(c *model.Campaign) { c.FixedBonus = -1 }},
+		{"Non-numeric prefix", func(c *model.Campaign) { c.OrderPrefix = "12a" }},
+		{"Unknown tier", func(c *model.Campaign) { c.Tiers = []string{"silver", "platinum"} }},
+		{"Duplicate tier", func(c *model.Campaign) { c.Tiers = []string{"gold", "silver", "gold"} }},
+		{"Tier with comma", func(c *model.Campaign) { c.Tiers = []string{"silver,gold"} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.modify(&c)
+			if err := Validate(c, tiers); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 2)
+	campaigns := []model.Campaign{
+		{ID: 1, Name: "double", StartsAt: start, EndsAt: end, Multiplier: 2, Active: true},
+		{ID: 2, Name: "welcome", StartsAt: start, EndsAt: end.AddDate(1, 0, 0), FirstOrder: true, Multiplier: 1, FixedBonus: 100, Active: true},
+		{ID: 3, Name: "gold", StartsAt: start, EndsAt: end, Tiers: []string{"gold"}, Multiplier: 1, FixedBonus: 10, Active: true},
+		{ID: 4, Name: "partner", StartsAt: start, EndsAt: end, OrderPrefix: "42", Multiplier: 1.5, Active: true},
+		{ID: 5, Name: "disabled", StartsAt: start, EndsAt: end, Multiplier: 3, Active: false},
+	}
+
+	tests := []struct {
+		name  string
+		order Order
+		want  []float32
+	}{
+		{
+			name:  "Within window",
+			order: Order{Number: "12345678903", Accrual: 50, Tier: "bronze", At: start.Add(time.Hour)},
+			want:  []float32{50},
+		},
+		{
+			name:  "First order in gold tier with prefix",
+			order: Order{Number: "4200000005", Accrual: 50, Tier: "gold", FirstOrder: true, At: start.Add(time.Hour)},
+			want:  []float32{50, 100, 10, 25},
+		},
+		{
+			name:  "Window end is exclusive",
+			order: Order{Number: "12345678903", Accrual: 50, Tier: "bronze", FirstOrder: true, At: end},
+			want:  []float32{100},
+		},
+		{
+			name:  "Before start",
+			order: Order{Number: "4200000005", Accrual: 50, Tier: "gold", FirstOrder: true, At: start.Add(-time.Second)},
+			want:  nil,
+		},
+		{
+			name:  "Zero accrual keeps fixed bonus only",
+			order: Order{Number: "12345678903", Accrual: 0, Tier: "gold", At: start},
+			want:  []float32{10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bonuses := Evaluate(campaigns, tt.order)
+			if len(bonuses) != len(tt.want) {
+				t.Fatalf("Expected %d bonuses, got %+v", len(tt.want), bonuses)
+			}
+			for i, bonus := range bonuses {
+				if bonus.Type != model.CampaignBonus || bonus.Amount != tt.want[i] {
+					t.Errorf("Bonus %d: expected %v, got %+v", i, tt.want[i], bonus)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"gopher-market/internal/store"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	OrderStatus = "order.status" // изменился статус заказа пользователя
+	Balance     = "balance"      // изменился баланс пользователя
+
+	notifyChannel = "user_events"
+	bufferSize    = 16
+	// replayPageSize — сколько пропущенных событий Replay читает одним запросом
+	replayPageSize = 1000
+)
+
+// Subscription — подписка одного клиента на события пользователя.
+// Канал C закрывается, если подписчик не успевает читать события; клиент должен переподключиться с Last-Event-ID.
+type Subscription struct {
+	C      <-chan model.UserEvent
+	ch     chan model.UserEvent
+	userID int
+}
+
+// Broker — внутрипроцессная шина событий пользователей.
+// Каждое событие сохраняется в БД, что позволяет дочитать пропущенное по Last-Event-ID,
+// а при включенном Notify рассылается остальным репликам через Postgres LISTEN/NOTIFY.
+type Broker struct {
+	repo   *store.Database
+	notify bool
+	origin string
+
+	mu     sync.Mutex
+	subs   map[int]map[*Subscription]struct{}
+	closed bool
+}
+
+// notification — полезная нагрузка NOTIFY, origin позволяет реплике пропустить собственные события
+type notification struct {
+	Origin string          `json:"origin"`
+	Event  model.UserEvent `json:"event"`
+	UserID int             `json:"user_id"`
+}
+
+func NewBroker(repo *store.Database, notify bool) *Broker {
+	return &Broker{
+		repo:   repo,
+		notify: notify,
+		origin: fmt.Sprintf("%d-%d", time.Now().UnixNano(), rand.Int63()),
+		subs:   make(map[int]map[*Subscription]struct{}),
+	}
+}
+
+func (b *Broker) Subscribe(userID int) *Subscription {
+	ch := make(chan model.UserEvent, bufferSize)
+	sub := &Subscription{C: ch, ch: ch, userID: userID}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return sub
+	}
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[*Subscription]struct{})
+	}
+	b.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(sub)
+}
+
+// Close закрывает все подписки, чтобы открытые потоки завершились при остановке сервера
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for _, userSubs := range b.subs {
+		for sub := range userSubs {
+			b.remove(sub)
+		}
+	}
+}
+
+// remove вызывается под мьютексом
+func (b *Broker) remove(sub *Subscription) {
+	userSubs, ok := b.subs[sub.userID]
+	if !ok {
+		return
+	}
+	if _, ok := userSubs[sub]; !ok {
+		return
+	}
+	delete(userSubs, sub)
+	close(sub.ch)
+	if len(userSubs) == 0 {
+		delete(b.subs, sub.userID)
+	}
+}
+
+// Publish сохраняет событие и доставляет его подписчикам пользователя
+func (b *Broker) Publish(userID int, eventType string, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logging.Logg.Error("Failed to marshal user event", "type", eventType, "error", err)
+		return
+	}
+
+	event, err := b.repo.CreateUserEvent(userID, eventType, payload)
+	if err != nil {
+		logging.Logg.Error("Failed to save user event", "type", eventType, "error", err)
+		return
+	}
+	event.UserID = userID
+	b.deliver(*event)
+
+	if !b.notify {
+		return
+	}
+	msg, err := json.Marshal(notification{Origin: b.origin, Event: *event, UserID: userID})
+	if err != nil {
+		logging.Logg.Error("Failed to marshal notification", "error", err)
+		return
+	}
+	if err := b.repo.Notify(notifyChannel, string(msg)); err != nil {
+		logging.Logg.Error("Failed to notify replicas", "error", err)
+	}
+}
+
+func (b *Broker) deliver(event model.UserEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs[event.UserID] {
+		select {
+		case sub.ch <- event:
+		default:
+			logging.Logg.Warn("Subscriber is too slow, dropping subscription", "user_id", event.UserID)
+			b.remove(sub)
+		}
+	}
+}
+
+// Listen принимает события других реплик через LISTEN/NOTIFY до отмены контекста,
+// переподключаясь при обрыве соединения
+func (b *Broker) Listen(ctx context.Context) {
+	for {
+		err := b.repo.Listen(ctx, notifyChannel, func(payload string) {
+			var n notification
+			if err := json.Unmarshal([]byte(payload), &n); err != nil {
+				logging.Logg.Error("Failed to decode notification", "error", err)
+				return
+			}
+			if n.Origin == b.origin {
+				return
+			}
+			n.Event.UserID = n.UserID
+			b.deliver(n.Event)
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		logging.Logg.Error("Events listener stopped, reconnecting", "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Replay возвращает все сохраненные события пользователя после lastID, читая их страницами.
+// Объем ограничен сроком хранения событий (Cleanup).
+func (b *Broker) Replay(userID int, lastID int64) ([]model.UserEvent, error) {
+	var missed []model.UserEvent
+	for {
+		page, err := b.repo.GetUserEventsSince(userID, lastID, replayPageSize)
+		if err != nil {
+			return nil, err
+		}
+		missed = append(missed, page...)
+		if len(page) < replayPageSize {
+			return missed, nil
+		}
+		lastID = page[len(page)-1].ID
+	}
+}
+
+// Cleanup удаляет события старше retention
+func (b *Broker) Cleanup(retention time.Duration) {
+	deleted, err := b.repo.DeleteUserEventsBefore(time.Now().Add(-retention))
+	if err != nil {
+		logging.Logg.Error("Failed to delete old user events", "error", err)
+		return
+	}
+	if deleted > 0 {
+		logging.Logg.Info("Old user events deleted", "count", deleted)
+	}
+}
@@ -2,98 +2,340 @@ package gzip
 
 import (
 	"compress/gzip"
+	"compress/zlib"
+	"errors"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 )
 
-type compressWriter struct {
-	w  http.ResponseWriter
-	zw *gzip.Writer
+const (
+	// MinSize — ответы меньше этого размера не сжимаются: выигрыш не окупает накладные расходы
+	MinSize = 1024
+	// MaxDecompressedSize — предел распакованного тела запроса, защита от zip-бомб
+	MaxDecompressedSize = 10 << 20
+)
+
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// compressibleTypes — типы содержимого, которые имеет смысл сжимать. text/event-stream сюда не входит:
+// события должны доходить до клиента сразу после Flush, без буферизации в компрессоре.
+var compressibleTypes = map[string]bool{
+	"application/json":         true,
+	"application/problem+json": true,
+	"application/x-ndjson":     true,
+	"application/xml":          true,
+	"text/csv":                 true,
+	"text/html":                true,
+	"text/plain":               true,
+	"text/xml":                 true,
+}
+
+// encoder — общий интерфейс gzip.Writer и zlib.Writer
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
 }
 
-func newCompressWriter(w http.ResponseWriter) *compressWriter {
-	return &compressWriter{
-		w:  w,
-		zw: gzip.NewWriter(w),
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	zlibWriters = sync.Pool{New: func() any { return zlib.NewWriter(nil) }}
+	gzipReaders sync.Pool
+)
+
+func acquireEncoder(encoding string, w io.Writer) encoder {
+	var enc encoder
+	if encoding == encodingGzip {
+		enc = gzipWriters.Get().(*gzip.Writer)
+	} else {
+		enc = zlibWriters.Get().(*zlib.Writer)
 	}
+	enc.Reset(w)
+	return enc
 }
 
-func (c *compressWriter) Header() http.Header {
-	return c.w.Header()
+func releaseEncoder(enc encoder) {
+	// Отвязываем кодировщик от ответа, чтобы пул не удерживал соединение
+	enc.Reset(io.Discard)
+	switch enc := enc.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(enc)
+	case *zlib.Writer:
+		zlibWriters.Put(enc)
+	}
 }
 
-func (c *compressWriter) Write(p []byte) (int, error) {
-	return c.zw.Write(p)
+// negotiate выбирает кодировку ответа по Accept-Encoding с учетом q-значений.
+// Пустая строка означает, что ответ отдается без сжатия.
+func negotiate(acceptEncoding string) string {
+	q := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		switch name {
+		case encodingGzip, "x-gzip":
+			q[encodingGzip] = weight
+		case encodingDeflate:
+			q[encodingDeflate] = weight
+		case "*":
+			wildcard = weight
+		}
+	}
+
+	weight := func(encoding string) float64 {
+		if w, ok := q[encoding]; ok {
+			return w
+		}
+		return wildcard
+	}
+	gz, deflate := weight(encodingGzip), weight(encodingDeflate)
+	switch {
+	case gz > 0 && gz >= deflate:
+		return encodingGzip
+	case deflate > 0:
+		return encodingDeflate
+	}
+	return ""
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && compressibleTypes[mediaType]
+}
+
+// bodyAllowed сообщает, может ли ответ с таким статусом иметь тело
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// compressWriter откладывает решение о сжатии, пока не наберется MinSize байт или обработчик не завершится,
+// и только тогда выставляет Content-Encoding
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	head     bool
+
+	status      int
+	wroteHeader bool   // обработчик выставил статус
+	decided     bool   // заголовки отправлены клиенту
+	buf         []byte // начало тела до принятия решения
+	enc         encoder
 }
 
 func (c *compressWriter) WriteHeader(statusCode int) {
-	if statusCode < 300 {
-		c.w.Header().Set("Content-Encoding", "gzip")
+	if statusCode < 200 {
+		// Информационные ответы (103 Early Hints) уходят клиенту сразу
+		c.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if c.wroteHeader {
+		return
+	}
+	c.status = statusCode
+	c.wroteHeader = true
+	if c.head || !bodyAllowed(statusCode) {
+		c.decide()
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.decided {
+		if c.enc != nil {
+			return c.enc.Write(p)
+		}
+		return c.ResponseWriter.Write(p)
+	}
+
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= MinSize {
+		if err := c.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// decide отправляет заголовки и накопленное начало тела, сжимая его, если это имеет смысл
+func (c *compressWriter) decide() error {
+	c.decided = true
+	h := c.Header()
+	if h.Get("Content-Type") == "" && len(c.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(c.buf))
+	}
+
+	if !c.head && bodyAllowed(c.status) && len(c.buf) >= MinSize &&
+		h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", c.encoding)
+		h.Del("Content-Length")
+		c.enc = acquireEncoder(c.encoding, c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+
+	buf := c.buf
+	c.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if c.enc != nil {
+		_, err = c.enc.Write(buf)
+	} else {
+		_, err = c.ResponseWriter.Write(buf)
 	}
-	c.w.WriteHeader(statusCode)
+	return err
+}
+
+// Flush отправляет клиенту все, что уже записано. Если решение о сжатии еще не принято,
+// ответ уходит без сжатия: потоковым ответам важнее задержка, чем размер.
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		if !c.wroteHeader {
+			c.WriteHeader(http.StatusOK)
+		}
+		if !c.decided {
+			c.decide()
+		}
+	}
+	if c.enc != nil {
+		c.enc.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap позволяет http.ResponseController добраться до исходного ResponseWriter
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
 }
 
-// Close закрывает gzip.Writer и досылает все данные из буфера.
+// Close досылает буфер и возвращает кодировщик в пул
 func (c *compressWriter) Close() error {
-	return c.zw.Close()
+	if !c.decided && c.wroteHeader {
+		if err := c.decide(); err != nil {
+			return err
+		}
+	}
+	if c.enc == nil {
+		return nil
+	}
+	err := c.enc.Close()
+	releaseEncoder(c.enc)
+	c.enc = nil
+	return err
 }
 
 // compressReader реализует интерфейс io.ReadCloser и позволяет прозрачно для сервера
 // декомпрессировать получаемые от клиента данные
 type compressReader struct {
 	r  io.ReadCloser
-	zr *gzip.Reader
+	zr io.ReadCloser
 }
 
-func newCompressReader(r io.ReadCloser) (*compressReader, error) {
-	zr, err := gzip.NewReader(r)
+func newCompressReader(r io.ReadCloser, encoding string) (*compressReader, error) {
+	var zr io.ReadCloser
+	var err error
+	switch encoding {
+	case encodingGzip, "x-gzip":
+		if v := gzipReaders.Get(); v != nil {
+			gr := v.(*gzip.Reader)
+			if err = gr.Reset(r); err == nil {
+				zr = gr
+			}
+		} else {
+			zr, err = gzip.NewReader(r)
+		}
+	case encodingDeflate:
+		zr, err = zlib.NewReader(r)
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &compressReader{
-		r:  r,
-		zr: zr,
-	}, nil
+	return &compressReader{r: r, zr: zr}, nil
 }
 
-func (c compressReader) Read(p []byte) (n int, err error) {
+func (c *compressReader) Read(p []byte) (n int, err error) {
+	if c.zr == nil {
+		return 0, http.ErrBodyReadAfterClose
+	}
 	return c.zr.Read(p)
 }
 
+// Close можно вызывать повторно: тело закрывают и обработчик, и middleware,
+// а распаковщик должен вернуться в пул ровно один раз
 func (c *compressReader) Close() error {
-	if err := c.r.Close(); err != nil {
-		return err
+	if c.zr == nil {
+		return nil
+	}
+	err := c.zr.Close()
+	if gr, ok := c.zr.(*gzip.Reader); ok {
+		gzipReaders.Put(gr)
 	}
-	return c.zr.Close()
+	c.zr = nil
+	if rerr := c.r.Close(); rerr != nil {
+		return rerr
+	}
+	return err
 }
-func GzipMiddleware(h http.HandlerFunc) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ow := w
-		acceptEncoding := r.Header.Get("Accept-Encoding")
-		supportsGzip := strings.Contains(acceptEncoding, "gzip")
-		//Если поддерживается gzip отдаем в сжатом виде
-		if supportsGzip {
-			cw := newCompressWriter(w)
-			ow = cw
-			defer cw.Close()
-			ow.Header().Set("Content-Encoding", "gzip")
 
-		}
-
-		// проверяем, что клиент отправил серверу сжатые данные в формате gzip
-		contentEncoding := r.Header.Get("Content-Encoding")
-		sendsGzip := strings.Contains(contentEncoding, "gzip")
-		if sendsGzip {
-			cr, err := newCompressReader(r.Body)
+// GzipMiddleware сжимает ответы gzip или deflate по Accept-Encoding клиента и прозрачно
+// распаковывает тела запросов с Content-Encoding, ограничивая их распакованный размер.
+func GzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Проверяем, что клиент отправил серверу сжатые данные
+		if encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding != "" && encoding != "identity" {
+			cr, err := newCompressReader(r.Body, encoding)
+			if errors.Is(err, ErrUnsupportedEncoding) {
+				w.Header().Set("Accept-Encoding", "gzip, deflate")
+				http.Error(w, "Unsupported content encoding", http.StatusUnsupportedMediaType)
+				return
+			}
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+				http.Error(w, "Invalid compressed body", http.StatusBadRequest)
 				return
 			}
-			r.Body = cr
 			defer cr.Close()
+			r.Body = http.MaxBytesReader(w, cr, MaxDecompressedSize)
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
 		}
-		h.ServeHTTP(ow, r)
+
+		// Ответ зависит от Accept-Encoding, даже если этому клиенту он отдается без сжатия
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiate(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, head: r.Method == http.MethodHead}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
 	})
 }
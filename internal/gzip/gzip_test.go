@@ -0,0 +1,150 @@
+package gzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serve(h http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	GzipMiddleware(h).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCompressResponse(t *testing.T) {
+	large := `{"orders":"` + strings.Repeat("a", 2*MinSize) + `"}`
+	cases := []struct {
+		name     string
+		accept   string
+		status   int
+		ctype    string
+		body     string
+		encoding string
+	}{
+		{"large json", "gzip", http.StatusOK, "application/json", large, "gzip"},
+		{"deflate preferred", "gzip;q=0.5, deflate", http.StatusOK, "application/json", large, "deflate"},
+		{"gzip refused", "gzip;q=0, *", http.StatusOK, "application/json", large, "deflate"},
+		{"no accept-encoding", "", http.StatusOK, "application/json", large, ""},
+		{"small body", "gzip", http.StatusOK, "application/json", `{"ok":true}`, ""},
+		{"small error", "gzip", http.StatusBadRequest, "text/plain; charset=utf-8", "Invalid request\n", ""},
+		{"no content", "gzip", http.StatusNoContent, "", "", ""},
+		{"event stream", "gzip", http.StatusOK, "text/event-stream", large, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tc.accept)
+			rec := serve(func(w http.ResponseWriter, r *http.Request) {
+				if tc.ctype != "" {
+					w.Header().Set("Content-Type", tc.ctype)
+				}
+				w.WriteHeader(tc.status)
+				// Пишем частями, чтобы проверить буферизацию до порога
+				for i := 0; i < len(tc.body); i += 100 {
+					io.WriteString(w, tc.body[i:min(i+100, len(tc.body))])
+				}
+			}, req)
+
+			if rec.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tc.encoding {
+				t.Fatalf("Expected Content-Encoding %q, got %q", tc.encoding, got)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Expected Vary: Accept-Encoding, got %q", got)
+			}
+
+			var body io.Reader = rec.Body
+			switch tc.encoding {
+			case "gzip":
+				zr, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			case "deflate":
+				zr, err := newCompressReader(io.NopCloser(rec.Body), "deflate")
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.body {
+				t.Errorf("Body mismatch: got %d bytes, expected %d", len(got), len(tc.body))
+			}
+		})
+	}
+}
+
+func TestDecompressRequest(t *testing.T) {
+	compress := func(data []byte) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		return &buf
+	}
+	readBody := func(body io.Reader, encoding string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req.Header.Set("Content-Encoding", encoding)
+		var read string
+		rec := serve(func(w http.ResponseWriter, r *http.Request) {
+			data, err := io.ReadAll(r.Body)
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			read = string(data)
+		}, req)
+		return rec.Code, read
+	}
+
+	if code, body := readBody(compress([]byte(`{"order":"12345678903"}`)), "gzip"); code != http.StatusOK || body != `{"order":"12345678903"}` {
+		t.Errorf("Expected decompressed body, got %d %q", code, body)
+	}
+	if code, _ := readBody(strings.NewReader("not gzip"), "gzip"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for corrupt body, got %d", code)
+	}
+	if code, _ := readBody(strings.NewReader("data"), "br"); code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for unsupported encoding, got %d", code)
+	}
+
+	// 20 МБ нулей сжимаются до нескольких килобайт
+	bomb := compress(make([]byte, 2*MaxDecompressedSize))
+	if code, _ := readBody(bomb, "gzip"); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for zip bomb, got %d", code)
+	}
+}
+
+func TestCompressReaderReturnedToPoolOnce(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("12345678903"))
+	zw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	serve(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		// Обработчик закрывает тело сам, middleware закроет его еще раз
+		r.Body.Close()
+	}, req)
+
+	first, second := gzipReaders.Get(), gzipReaders.Get()
+	if first != nil && first == second {
+		t.Fatal("The same gzip reader was returned to the pool twice")
+	}
+}
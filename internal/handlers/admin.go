@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"gopher-market/internal/store"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+func (b *webhookRequest) Validate() error {
+	u, err := url.Parse(b.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrWebhookURL
+	}
+	for _, event := range b.Events {
+		if !slices.Contains(model.WebhookEvents, event) {
+			return fmt.Errorf("%w: %s", ErrWebhookEvent, event)
+		}
+	}
+	return nil
+}
+
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req webhookRequest
+	if !bindJSON(w, r, &req) {
+		return
+	}
+
+	if len(req.Events) == 0 {
+		req.Events = model.WebhookEvents
+	}
+
+	if req.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+			return
+		}
+		req.Secret = hex.EncodeToString(secret)
+	}
+
+	endpoint := model.WebhookEndpoint{URL: req.URL, Secret: req.Secret, Events: req.Events, Active: true}
+	if err := h.Service.Repo.CreateWebhookEndpoint(&endpoint); err != nil {
+		logging.Logg.ErrorContext(r.Context(), "CreateWebhookEndpoint", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(endpoint)
+}
+
+func (h *Handler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	endpoints, err := h.Service.Repo.GetWebhookEndpoints()
+	if err != nil {
+		logging.Logg.ErrorContext(r.Context(), "GetWebhookEndpoints", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(endpoints)
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodDelete) {
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.Repo.DeleteWebhookEndpoint(id); err != nil {
+		if errors.Is(err, store.ErrWebhookNotFound) {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		logging.Logg.ErrorContext(r.Context(), "DeleteWebhookEndpoint", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetDeadWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	deliveries, err := h.Service.Repo.GetDeadWebhookDeliveries(100)
+	if err != nil {
+		logging.Logg.ErrorContext(r.Context(), "GetDeadWebhookDeliveries", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+func (h *Handler) RetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid delivery id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Service.Repo.RetryWebhookDelivery(id); err != nil {
+		if errors.Is(err, store.ErrWebhookNotFound) {
+			http.Error(w, "Dead delivery not found", http.StatusNotFound)
+			return
+		}
+		logging.Logg.ErrorContext(r.Context(), "RetryWebhookDelivery", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var (
+	ErrTrailingData   = errors.New("unexpected data after JSON body")
+	ErrMissingField   = errors.New("missing required field")
+	ErrNonPositiveSum = errors.New("sum must be positive")
+	ErrNegativeTTL    = errors.New("ttl_seconds must not be negative")
+	ErrNegativeLimit  = errors.New("limits must not be negative")
+	ErrWebhookURL     = errors.New("webhook url must be an absolute http or https url")
+	ErrWebhookEvent   = errors.New("unknown webhook event")
+	ErrReviewStatus   = errors.New("status must be approved or rejected")
+)
+
+// validator реализуют тела запросов с обязательными полями
+type validator interface {
+	Validate() error
+}
+
+// decodeJSON строго разбирает тело запроса в dst: неизвестные поля и данные после JSON-значения
+// считаются ошибкой, затем проверяются обязательные поля, если dst реализует validator
+func decodeJSON(r *http.Request, dst any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return err
+		}
+		return ErrTrailingData
+	}
+	if v, ok := dst.(validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// bindJSON разбирает тело запроса в dst и при ошибке сам отвечает клиенту:
+// 413, если тело превысило ограничение размера, иначе 400 с причиной
+func bindJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	err := decodeJSON(r, dst)
+	if err == nil {
+		return true
+	}
+
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		http.Error(w, fmt.Sprintf("Request body too large, max %d bytes", maxErr.Limit), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	http.Error(w, "Bad request format: "+err.Error(), http.StatusBadRequest)
+	return false
+}
+
+// requiredField возвращает ошибку для незаполненного обязательного поля
+func requiredField(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("%w: %s", ErrMissingField, name)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"gopher-market/internal/middleware"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBindJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"valid", `{"login":"user","password":"secret"}`, http.StatusOK},
+		{"trailing whitespace", "{\"login\":\"user\",\"password\":\"secret\"}\n", http.StatusOK},
+		{"unknown field", `{"login":"user","password":"secret","admin":true}`, http.StatusBadRequest},
+		{"trailing data", `{"login":"user","password":"secret"}{"login":"other"}`, http.StatusBadRequest},
+		{"missing password", `{"login":"user"}`, http.StatusBadRequest},
+		{"too large", `{"login":"` + strings.Repeat("a", middleware.SmallBodyLimit) + `","password":"secret"}`, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(tt.body))
+			req.ContentLength = -1
+			rec := httptest.NewRecorder()
+			middleware.BodyLimitMiddleware(middleware.SmallBodyLimit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body requestBody
+				if bindJSON(w, r, &body) {
+					w.WriteHeader(http.StatusOK)
+				}
+			})).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestBalanceValidate(t *testing.T) {
+	for _, tt := range []struct {
+		body Balance
+		ok   bool
+	}{
+		{Balance{Order: "2377225624", Sum: 751}, true},
+		{Balance{Sum: 751}, false},
+		{Balance{Order: "2377225624"}, false},
+		{Balance{Order: "2377225624", Sum: -100}, false},
+	} {
+		if err := tt.body.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate(%+v) = %v", tt.body, err)
+		}
+	}
+}
+
+func TestRequestValidate(t *testing.T) {
+	negative := float32(-1)
+	for _, tt := range []struct {
+		name string
+		body validator
+		ok   bool
+	}{
+		{"transfer", &transferRequest{To: "bob", Sum: 10}, true},
+		{"transfer without recipient", &transferRequest{Sum: 10}, false},
+		{"transfer with zero sum", &transferRequest{To: "bob"}, false},
+		{"hold", &holdRequest{Order: "2377225624", Sum: 10}, true},
+		{"hold with negative ttl", &holdRequest{Order: "2377225624", Sum: 10, TTLSeconds: -1}, false},
+		{"hold without order", &holdRequest{Sum: 10}, false},
+		{"campaign", &campaignRequest{Name: "spring"}, true},
+		{"campaign with blank name", &campaignRequest{Name: " "}, false},
+		{"limits", &limitsRequest{}, true},
+		{"negative limit", &limitsRequest{Daily: &negative}, false},
+		{"webhook", &webhookRequest{URL: "https://example.com/hook", Events: []string{"order.processed"}}, true},
+		{"webhook with relative url", &webhookRequest{URL: "/hook"}, false},
+		{"webhook with unknown event", &webhookRequest{URL: "https://example.com/hook", Events: []string{"unknown"}}, false},
+		{"review", &resolveReviewRequest{Status: "approved"}, true},
+		{"review with unknown status", &resolveReviewRequest{Status: "pending"}, false},
+	} {
+		if err := tt.body.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate() = %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gopher-market/internal/campaign"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"gopher-market/internal/store"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+type campaignRequest struct {
+	Name        string    `json:"name"`
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at"`
+	FirstOrder  bool      `json:"first_order"`
+	Tiers       []string  `json:"tiers"`
+	OrderPrefix string    `json:"order_prefix"`
+	Multiplier  *float32  `json:"multiplier"`
+	FixedBonus  float32   `json:"fixed_bonus"`
+	Active      *bool     `json:"active"`
+}
+
+// Validate проверяет обязательные поля; условия акции целиком проверяет campaign.Validate
+func (b *campaignRequest) Validate() error {
+	return requiredField("name", strings.TrimSpace(b.Name))
+}
+
+// decodeCampaign разбирает и проверяет описание акции; множитель по умолчанию 1, акция по умолчанию включена
+func (h *Handler) decodeCampaign(w http.ResponseWriter, r *http.Request) (*model.Campaign, bool) {
+	var req campaignRequest
+	if !bindJSON(w, r, &req) {
+		return nil, false
+	}
+
+	c := model.Campaign{
+		Name:        req.Name,
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.EndsAt,
+		FirstOrder:  req.FirstOrder,
+		Tiers:       req.Tiers,
+		OrderPrefix: req.OrderPrefix,
+		Multiplier:  1,
+		FixedBonus:  req.FixedBonus,
+		Active:      true,
+	}
+	if req.Multiplier != nil {
+		c.Multiplier = *req.Multiplier
+	}
+	if req.Active != nil {
+		c.Active = *req.Active
+	}
+
+	if err := campaign.Validate(c, h.Config.Tiers); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return &c, true
+}
+
+func campaignID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid campaign id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *Handler) CreateCampaign(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	c, ok := h.decodeCampaign(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Service.Repo.CreateCampaign(c); err != nil {
+		logging.Logg.ErrorContext(r.Context(), "CreateCampaign", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+func (h *Handler) GetCampaigns(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	campaigns, err := h.Service.Repo.GetCampaigns()
+	if err != nil {
+		logging.Logg.ErrorContext(r.Context(), "GetCampaigns", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(campaigns)
+}
+
+func (h *Handler) GetCampaign(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	id, ok := campaignID(w, r)
+	if !ok {
+		return
+	}
+	c, err := h.Service.Repo.GetCampaign(id)
+	if err != nil {
+		if errors.Is(err, store.ErrCampaignNotFound) {
+			http.Error(w, "Campaign not found", http.StatusNotFound)
+			return
+		}
+		logging.Logg.ErrorContext(r.Context(), "GetCampaign", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(c)
+}
+
+func (h *Handler) UpdateCampaign(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodPut) {
+		return
+	}
+
+	id, ok := campaignID(w, r)
+	if !ok {
+		return
+	}
+	c, ok := h.decodeCampaign(w, r)
+	if !ok {
+		return
+	}
+	c.ID = id
+	if err := h.Service.Repo.UpdateCampaign(c); err != nil {
+		if errors.Is(err, store.ErrCampaignNotFound) {
+			http.Error(w, "Campaign not found", http.StatusNotFound)
+			return
+		}
+		logging.Logg.ErrorContext(r.Context(), "UpdateCampaign", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(c)
+}
+
+func (h *Handler) DeleteCampaign(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodDelete) {
+		return
+	}
+
+	id, ok := campaignID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Service.Repo.DeleteCampaign(id); err != nil {
+		if errors.Is(err, store.ErrCampaignNotFound) {
+			http.Error(w, "Campaign not found", http.StatusNotFound)
+			return
+		}
+		logging.Logg.ErrorContext(r.Context(), "DeleteCampaign", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/middleware"
+	"gopher-market/internal/model"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+// StreamEvents отдает события пользователя (смена статуса заказа, изменение баланса) в формате Server-Sent Events.
+// Клиент может продолжить поток с места обрыва, передав заголовок Last-Event-ID.
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	username, err := middleware.ExtractUserFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !CheckRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	var lastID int64
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventID != "" {
+		lastID, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || lastID < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	user, err := h.Service.Repo.GetUserByLogin(username)
+	if err != nil {
+		http.Error(w, "The user does not exist", http.StatusInternalServerError)
+		return
+	}
+
+	// Подписываемся до чтения истории, чтобы не потерять события между ними
+	sub := h.Service.Events.Subscribe(user.ID)
+	defer h.Service.Events.Unsubscribe(sub)
+
+	var missed []model.UserEvent
+	if lastID > 0 {
+		missed, err = h.Service.Events.Replay(user.ID, lastID)
+		if err != nil {
+			logging.Logg.ErrorContext(r.Context(), "Failed to replay user events", "user_id", user.ID, "error", err)
+			http.Error(w, "Failed fetching events from DB", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	// Поток живет дольше WriteTimeout сервера
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logging.Logg.WarnContext(r.Context(), "Failed to reset write deadline", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	for _, event := range missed {
+		writeEvent(w, event)
+		lastID = event.ID
+	}
+	if err := rc.Flush(); err != nil {
+		logging.Logg.ErrorContext(r.Context(), "Streaming is not supported", "error", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if event.ID <= lastID {
+				continue
+			}
+			writeEvent(w, event)
+			lastID = event.ID
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event model.UserEvent) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
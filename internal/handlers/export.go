@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"gopher-market/internal/logging"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// форматы выгрузки списков
+const (
+	exportJSON   = "json"
+	exportCSV    = "csv"
+	exportNDJSON = "ndjson"
+
+	// exportFlushRows — через сколько строк выгрузка сбрасывается клиенту
+	exportFlushRows = 100
+	// exportTimeout заменяет общий WriteTimeout сервера для длинных выгрузок
+	exportTimeout = 10 * time.Minute
+)
+
+// exportFormat выбирает формат выгрузки по заголовку Accept, по умолчанию JSON-массив
+func exportFormat(r *http.Request) string {
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "text/csv"):
+		return exportCSV
+	case strings.Contains(accept, "application/x-ndjson"):
+		return exportNDJSON
+	}
+	return exportJSON
+}
+
+// exportWriter построчно пишет выгрузку в ответ. Заголовки отправляются вместе с первой строкой,
+// поэтому пустая выгрузка все еще может ответить 204.
+type exportWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	format  string
+	header  []string
+	csv     *csv.Writer
+	json    *json.Encoder
+	rows    int
+	started bool
+}
+
+// newExportWriter продлевает срок записи ответа сразу, до запроса к БД: общий WriteTimeout сервера
+// отсчитывается от чтения запроса и может истечь, пока выгрузка еще выбирает первые строки
+func newExportWriter(w http.ResponseWriter, format string, header []string) *exportWriter {
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(exportTimeout))
+	return &exportWriter{w: w, rc: rc, format: format, header: header}
+}
+
+func (e *exportWriter) start() error {
+	e.started = true
+	if e.format == exportCSV {
+		e.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		e.w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	e.w.WriteHeader(http.StatusOK)
+
+	if e.format == exportCSV {
+		e.csv = csv.NewWriter(e.w)
+		return e.csv.Write(e.header)
+	}
+	e.json = json.NewEncoder(e.w)
+	return nil
+}
+
+// Write выводит одну строку: record для CSV, value для NDJSON
+func (e *exportWriter) Write(record []string, value any) error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if e.format == exportCSV {
+		err = e.csv.Write(record)
+	} else {
+		err = e.json.Encode(value)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.rows++
+	if e.rows%exportFlushRows == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+func (e *exportWriter) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if err := e.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// Close завершает выгрузку; если строк не было, отвечает 204
+func (e *exportWriter) Close() error {
+	if !e.started {
+		e.w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	if e.csv != nil {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+	return nil
+}
+
+func formatFloat(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', 2, 32)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// finish завершает выгрузку после чтения из БД. Ошибку до первой строки еще можно вернуть клиенту
+// статусом 500, после — только оборвать ответ.
+func (e *exportWriter) finish(err error) {
+	if err == nil {
+		err = e.Close()
+	}
+	if err == nil {
+		return
+	}
+	logging.Logg.Error("Export failed", "format", e.format, "rows", e.rows, "err", err)
+	if !e.started {
+		http.Error(e.w, "Internal server error", http.StatusInternalServerError)
+	}
+}
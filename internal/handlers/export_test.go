@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportFormat(t *testing.T) {
+	for accept, format := range map[string]string{
+		"":                                 exportJSON,
+		"application/json":                 exportJSON,
+		"text/csv":                         exportCSV,
+		"text/csv; charset=utf-8":          exportCSV,
+		"application/x-ndjson":             exportNDJSON,
+		"application/x-ndjson, */*;q=0.1":  exportNDJSON,
+		"text/html, application/xhtml+xml": exportJSON,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+		req.Header.Set("Accept", accept)
+		if got := exportFormat(req); got != format {
+			t.Errorf("Accept %q: expected %s, got %s", accept, format, got)
+		}
+	}
+}
+
+type exportRow struct {
+	Number string `json:"number"`
+	Sum    int    `json:"sum"`
+}
+
+func writeExport(t *testing.T, format string, rows []exportRow, err error) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	export := newExportWriter(rec, format, []string{"number", "sum"})
+	for _, row := range rows {
+		if err := export.Write([]string{row.Number, strconv.Itoa(row.Sum)}, row); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	export.finish(err)
+	return rec
+}
+
+func TestExportWriter(t *testing.T) {
+	rows := []exportRow{{"12345678903", 500}, {"9278923470", 12}}
+
+	t.Run("CSV", func(t *testing.T) {
+		rec := writeExport(t, exportCSV, rows, nil)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+			t.Fatalf("Unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if want := "number,sum\n12345678903,500\n9278923470,12\n"; rec.Body.String() != want {
+			t.Errorf("Expected %q, got %q", want, rec.Body.String())
+		}
+	})
+
+	t.Run("NDJSON", func(t *testing.T) {
+		rec := writeExport(t, exportNDJSON, rows, nil)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Fatalf("Unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if want := "{\"number\":\"12345678903\",\"sum\":500}\n{\"number\":\"9278923470\",\"sum\":12}\n"; rec.Body.String() != want {
+			t.Errorf("Expected %q, got %q", want, rec.Body.String())
+		}
+	})
+
+	t.Run("Flushes in batches", func(t *testing.T) {
+		rec := writeExport(t, exportCSV, make([]exportRow, exportFlushRows+1), nil)
+		if !rec.Flushed {
+			t.Error("Expected response to be flushed")
+		}
+		if lines := strings.Count(rec.Body.String(), "\n"); lines != exportFlushRows+2 {
+			t.Errorf("Expected %d lines, got %d", exportFlushRows+2, lines)
+		}
+	})
+
+	t.Run("Empty export", func(t *testing.T) {
+		for _, format := range []string{exportCSV, exportNDJSON} {
+			rec := writeExport(t, format, nil, nil)
+			if rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+				t.Errorf("%s: expected empty 204, got %d %q", format, rec.Code, rec.Body.String())
+			}
+		}
+	})
+
+	t.Run("Error before first row", func(t *testing.T) {
+		rec := writeExport(t, exportCSV, nil, errors.New("connection reset"))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status 500, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Error after first row", func(t *testing.T) {
+		rec := writeExport(t, exportNDJSON, rows[:1], errors.New("connection reset"))
+		if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "Internal server error") {
+			t.Errorf("Expected truncated 200, got %d %q", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+// deadlineRecorder запоминает срок записи, выставленный через http.ResponseController
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	deadline time.Time
+}
+
+func (d *deadlineRecorder) SetWriteDeadline(deadline time.Time) error {
+	d.deadline = deadline
+	return nil
+}
+
+func TestExportWriterExtendsDeadline(t *testing.T) {
+	rec := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+	start := time.Now()
+	export := newExportWriter(rec, exportCSV, []string{"number", "sum"})
+
+	// Срок продлевается до первой строки, пока выгрузка еще ждет БД
+	if rec.deadline.Before(start.Add(exportTimeout)) {
+		t.Errorf("Expected write deadline of at least %v before the first row, got %v", exportTimeout, rec.deadline.Sub(start))
+	}
+	export.finish(nil)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected empty 204, got %d", rec.Code)
+	}
+}
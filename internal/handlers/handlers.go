@@ -1,15 +1,25 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gopher-market/internal/config"
+	"gopher-market/internal/events"
 	"gopher-market/internal/logging"
+	"gopher-market/internal/metrics"
 	"gopher-market/internal/middleware"
+	"gopher-market/internal/model"
 	"gopher-market/internal/service"
 	"gopher-market/internal/store"
+	"gopher-market/internal/trace"
 	"io"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
 )
 
 type Handler struct {
@@ -24,12 +34,22 @@ func NewHandler(cfg *config.Config) (*Handler, error) {
 		return nil, err
 	}
 	authService := service.NewService(s)
+	authService.Config = cfg
+	authService.Events = events.NewBroker(&authService.Repo, cfg.EventsNotify)
 	return &Handler{Service: authService, Config: cfg}, nil
 }
 
 type requestBody struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
+	Login        string `json:"login"`
+	Password     string `json:"password"`
+	ReferralCode string `json:"referral_code,omitempty"`
+}
+
+func (b *requestBody) Validate() error {
+	if err := requiredField("login", b.Login); err != nil {
+		return err
+	}
+	return requiredField("password", b.Password)
 }
 
 func (h *Handler) RegisterUser(w http.ResponseWriter, r *http.Request) {
@@ -37,25 +57,31 @@ func (h *Handler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var requestBody requestBody
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Bad request format", http.StatusBadRequest)
+	if !bindJSON(w, r, &requestBody) {
 		return
 	}
 
-	logging.Logg.Debug("RegisterUser", "requestBody.Login", requestBody.Login)
-	logging.Logg.Debug("RegisterUser", "requestBody.Password", requestBody.Password)
+	logging.Logg.DebugContext(r.Context(), "RegisterUser", "requestBody.Login", requestBody.Login)
+	logging.Logg.DebugContext(r.Context(), "RegisterUser", "requestBody.Password", requestBody.Password)
 
 	passwordHash, err := h.Service.HashPassword(requestBody.Password)
 	if err != nil {
 		http.Error(w, "Failed hash the password", http.StatusInternalServerError)
 		return
 	}
-	logging.Logg.Debug("HashPassword", passwordHash)
+	logging.Logg.DebugContext(r.Context(), "HashPassword", passwordHash)
 
-	_, err = h.Service.Register(r.Context(), requestBody.Login, requestBody.Password)
+	_, err = h.Service.Register(r.Context(), requestBody.Login, requestBody.Password, requestBody.ReferralCode)
 	if err != nil {
-		http.Error(w, "Login already exists", http.StatusConflict)
+		switch {
+		case errors.Is(err, service.ErrInvalidReferralCode):
+			http.Error(w, "Unknown referral code", http.StatusBadRequest)
+		case errors.Is(err, store.ErrDuplicate):
+			http.Error(w, "Login already exists", http.StatusConflict)
+		default:
+			logging.Logg.ErrorContext(r.Context(), "Register", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
 		return
 	}
 	authToken, err := service.GenerateToken(requestBody.Login, h.Config)
@@ -77,18 +103,16 @@ func (h *Handler) LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var requestBody requestBody
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Bad request format", http.StatusBadRequest)
+	if !bindJSON(w, r, &requestBody) {
 		return
 	}
 
-	logging.Logg.Debug("LoginUser", "requestBody.Login", requestBody.Login)
-	logging.Logg.Debug("LoginUser", "requestBody.Password", requestBody.Password)
+	logging.Logg.DebugContext(r.Context(), "LoginUser", "requestBody.Login", requestBody.Login)
+	logging.Logg.DebugContext(r.Context(), "LoginUser", "requestBody.Password", requestBody.Password)
 
 	isValid, err := h.Service.Login(r.Context(), requestBody.Login, requestBody.Password)
 	if err != nil {
-		logging.Logg.Error("Login failed", "error", err)
+		logging.Logg.ErrorContext(r.Context(), "Login failed", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -139,7 +163,7 @@ func (h *Handler) UploadOrder(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
-	err = h.Service.CheckOrder(body, username)
+	err = h.Service.CheckOrder(r.Context(), body, username)
 	if err != nil {
 		switch err.Error() {
 		case "invalid order number (StatusUnprocessableEntity)":
@@ -150,6 +174,8 @@ func (h *Handler) UploadOrder(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "the order was uploaded by the user", http.StatusOK)
 		case "order number already uploaded by another user(StatusConflict)":
 			http.Error(w, "order number already uploaded by another user", http.StatusConflict)
+		case service.ErrRiskBlocked.Error():
+			http.Error(w, err.Error(), http.StatusForbidden)
 
 		default:
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -158,7 +184,7 @@ func (h *Handler) UploadOrder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user, _ := h.Service.Repo.GetUserByLogin(username)
-	err = h.Service.UploadOrder(user.ID, body)
+	err = h.Service.UploadOrder(r.Context(), user.ID, body)
 
 	if err != nil {
 		http.Error(w, "Failed registered new order", http.StatusInternalServerError)
@@ -172,6 +198,86 @@ func (h *Handler) UploadOrder(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+const maxBatchSize = 1000
+
+// parseOrderBatch разбирает тело пакетной загрузки: JSON-массив строк или список номеров через перевод строки
+func parseOrderBatch(r *http.Request) ([]string, error) {
+	body, err := readRequestBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var orderNumbers []string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.Unmarshal([]byte(body), &orderNumbers); err != nil {
+			return nil, err
+		}
+		for i := range orderNumbers {
+			orderNumbers[i] = strings.TrimSpace(orderNumbers[i])
+		}
+		return orderNumbers, nil
+	}
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			orderNumbers = append(orderNumbers, line)
+		}
+	}
+	return orderNumbers, nil
+}
+
+func (h *Handler) UploadOrdersBatch(w http.ResponseWriter, r *http.Request) {
+	username, err := middleware.ExtractUserFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !CheckRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	orderNumbers, err := parseOrderBatch(r)
+	if err != nil {
+		http.Error(w, "Bad request format", http.StatusBadRequest)
+		return
+	}
+	if len(orderNumbers) == 0 {
+		http.Error(w, "Empty order batch", http.StatusBadRequest)
+		return
+	}
+	if len(orderNumbers) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("Too many orders in the batch, max %d", maxBatchSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	user, err := h.Service.Repo.GetUserByLogin(username)
+	if err != nil {
+		http.Error(w, "The user does not exist", http.StatusInternalServerError)
+		return
+	}
+
+	results, err := h.Service.UploadOrders(r.Context(), user.ID, username, orderNumbers)
+	if err != nil {
+		logging.Logg.ErrorContext(r.Context(), "UploadOrders", "err", err)
+		http.Error(w, "Failed registered new orders", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Status == model.UploadAccepted {
+			status = http.StatusAccepted
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(results)
+}
+
 func (h *Handler) GetOrders(w http.ResponseWriter, r *http.Request) {
 	username, err := middleware.ExtractUserFromContext(r)
 	if err != nil {
@@ -184,6 +290,16 @@ func (h *Handler) GetOrders(w http.ResponseWriter, r *http.Request) {
 
 	user, _ := h.Service.Repo.GetUserByLogin(username)
 
+	if format := exportFormat(r); format != exportJSON {
+		export := newExportWriter(w, format, []string{"number", "status", "accrual", "uploaded_at"})
+		export.finish(h.Service.Repo.EachOrder(user.ID, func(order model.Order) error {
+			return export.Write([]string{
+				order.OrderNumber, string(order.Status), formatFloat(order.Accrual), formatTime(&order.UploadedAt),
+			}, order)
+		}))
+		return
+	}
+
 	orders, err := h.Service.Repo.GetOrders(user.ID)
 	if err != nil {
 		http.Error(w, "Failed fetching orders from DB:", http.StatusInternalServerError)
@@ -200,6 +316,44 @@ func (h *Handler) GetOrders(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(orders)
 }
 
+func (h *Handler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	username, err := middleware.ExtractUserFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !CheckRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	orderNumber := chi.URLParam(r, "number")
+	if !service.IsNumeric(orderNumber) {
+		http.Error(w, "invalid order number format", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.Service.Repo.GetUserByLogin(username)
+	if err != nil {
+		http.Error(w, "The user does not exist", http.StatusInternalServerError)
+		return
+	}
+
+	details, err := h.Service.GetOrderDetails(user.ID, orderNumber)
+	if err != nil {
+		if errors.Is(err, store.ErrOrderNotFound) {
+			http.Error(w, "Order not found", http.StatusNotFound)
+			return
+		}
+		logging.Logg.ErrorContext(r.Context(), "GetOrderDetails", "order", orderNumber, "err", err)
+		http.Error(w, "Failed fetching order from DB", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(details)
+}
+
 func (h *Handler) GetBalance(w http.ResponseWriter, r *http.Request) {
 	username, err := middleware.ExtractUserFromContext(r)
 	if err != nil {
@@ -223,20 +377,103 @@ func (h *Handler) GetBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	expiringSoon, err := h.Service.Repo.GetExpiringPoints(user.ID, time.Now().AddDate(0, 0, h.Config.ExpiringSoonDays))
+	if err != nil {
+		http.Error(w, "Failded get the expiring amount", http.StatusInternalServerError)
+		return
+	}
+
+	held, err := h.Service.Repo.GetHeldBalance(user.ID)
+	if err != nil {
+		http.Error(w, "Failded get the held amount", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]float32{
-		"current":   user.Balance,
-		"withdrawn": withdrawnBalance,
+	json.NewEncoder(w).Encode(map[string]any{
+		"current":       user.Balance,
+		"held":          held,
+		"withdrawn":     withdrawnBalance,
+		"expiring_soon": expiringSoon,
+		"tier":          h.Service.UserTier(user).Name,
 	})
 
 }
 
+func (h *Handler) GetTier(w http.ResponseWriter, r *http.Request) {
+	username, err := middleware.ExtractUserFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !CheckRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	user, err := h.Service.Repo.GetUserByLogin(username)
+	if err != nil {
+		http.Error(w, "The user does not exist", http.StatusInternalServerError)
+		return
+	}
+
+	status, err := h.Service.GetTierStatus(user)
+	if err != nil {
+		logging.Logg.ErrorContext(r.Context(), "GetTierStatus", "err", err)
+		http.Error(w, "Failed fetching tier from DB", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+}
+
+func (h *Handler) GetReferral(w http.ResponseWriter, r *http.Request) {
+	username, err := middleware.ExtractUserFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !CheckRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	user, err := h.Service.Repo.GetUserByLogin(username)
+	if err != nil {
+		http.Error(w, "The user does not exist", http.StatusInternalServerError)
+		return
+	}
+
+	summary, err := h.Service.GetReferralSummary(user)
+	if err != nil {
+		logging.Logg.ErrorContext(r.Context(), "GetReferralSummary", "err", err)
+		http.Error(w, "Failed fetching referrals from DB", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(summary)
+}
+
 type Balance struct {
 	Order string  `json:"order"` // Номер заказа
 	Sum   float32 `json:"sum"`   // Сумма баллов
 }
 
+func (b *Balance) Validate() error {
+	if err := requiredField("order", b.Order); err != nil {
+		return err
+	}
+	if b.Sum <= 0 {
+		return ErrNonPositiveSum
+	}
+	return nil
+}
+
 func (h *Handler) WithdrawBalance(w http.ResponseWriter, r *http.Request) {
 	username, err := middleware.ExtractUserFromContext(r)
 	if err != nil {
@@ -245,7 +482,7 @@ func (h *Handler) WithdrawBalance(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user, _ := h.Service.Repo.GetUserByLogin(username)
-	logging.Logg.Info("user",
+	logging.Logg.InfoContext(r.Context(), "user",
 		"user", user.Username,
 		"balance", user.Balance,
 	)
@@ -255,40 +492,50 @@ func (h *Handler) WithdrawBalance(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req Balance
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !bindJSON(w, r, &req) {
 		return
 	}
-	logging.Logg.Info("Req balance",
+	logging.Logg.InfoContext(r.Context(), "Req balance",
 		"order", req.Order,
 		"sum", req.Sum,
 	)
 
-	err = h.Service.CheckOrder(req.Order, username)
+	err = h.Service.CheckWithdrawal(r.Context(), user, req.Order, req.Sum)
 
-	logging.Logg.Info("CheckOrder",
+	logging.Logg.InfoContext(r.Context(), "CheckWithdrawal",
 		"username", username,
 		"err", err,
 	)
 	if err != nil {
+		if errors.Is(err, service.ErrRiskBlocked) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		http.Error(w, "Incorrect order number", http.StatusUnprocessableEntity)
 		return
 	}
 
-	err = h.Service.Repo.CreateTransactionWithdraw(user, req.Order, req.Sum)
+	err = trace.Do(r.Context(), "store.CreateTransactionWithdraw", func(context.Context) error {
+		return h.Service.Repo.CreateTransactionWithdraw(user, req.Order, req.Sum, h.Service.WithdrawalLimits())
+	})
 	if err != nil {
 		if err == store.ErrInsufficientFunds {
-			logging.Logg.Error("insufficient funds", "err", err)
+			logging.Logg.ErrorContext(r.Context(), "insufficient funds", "err", err)
 			http.Error(w, "insufficient funds in the account", http.StatusPaymentRequired)
+		} else if errors.Is(err, store.ErrWithdrawalLimit) {
+			writeLimitError(w, err)
 		} else {
-			logging.Logg.Error("err", "err", err)
+			logging.Logg.ErrorContext(r.Context(), "err", "err", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
+		return
 	}
+	metrics.PointsWithdrawn.Add(float64(req.Sum))
+	h.Service.PublishBalance(user.ID)
 
 	_, err = h.Service.Repo.CreateOrder(user.ID, req.Order)
 	if err != nil {
-		logging.Logg.Error("Failed to create order", "orderNumber", req.Order, "error", err)
+		logging.Logg.ErrorContext(r.Context(), "Failed to create order", "orderNumber", req.Order, "error", err)
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -307,14 +554,24 @@ func (h *Handler) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
 
 	user, _ := h.Service.Repo.GetUserByLogin(username)
 
-	logging.Logg.Info("GetUserByLogin",
+	logging.Logg.InfoContext(r.Context(), "GetUserByLogin",
 		"username", user.Username,
 		"id", user.ID,
 	)
 
+	if format := exportFormat(r); format != exportJSON {
+		export := newExportWriter(w, format, []string{"order", "sum", "processed_at", "reversed_at"})
+		export.finish(h.Service.Repo.EachWithdrawal(user.ID, func(withdrawal model.Transaction) error {
+			return export.Write([]string{
+				withdrawal.OrderNumber, formatFloat(withdrawal.Amount), formatTime(&withdrawal.UpdatedAt), formatTime(withdrawal.ReversedAt),
+			}, withdrawal)
+		}))
+		return
+	}
+
 	withdrawals, err := h.Service.Repo.Getwithdrawals(user.ID)
 	if err != nil {
-		logging.Logg.Error("Getwithdrawals", "err", err)
+		logging.Logg.ErrorContext(r.Context(), "Getwithdrawals", "err", err)
 
 		http.Error(w, "Failed fetching orders from DB:", http.StatusInternalServerError)
 		return
@@ -332,7 +589,7 @@ func (h *Handler) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
 
 func CheckRequestMethod(w http.ResponseWriter, r *http.Request, expectedMethod string) bool {
 	if r.Method != expectedMethod {
-		logging.Logg.Error("Invalid request method.")
+		logging.Logg.ErrorContext(r.Context(), "Invalid request method.")
 
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return false
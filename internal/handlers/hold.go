@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/middleware"
+	"gopher-market/internal/model"
+	"gopher-market/internal/service"
+	"gopher-market/internal/store"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+type holdRequest struct {
+	Order      string  `json:"order"`       // номер заказа
+	Sum        float32 `json:"sum"`         // сумма резерва
+	TTLSeconds int     `json:"ttl_seconds"` // срок резерва, 0 — по умолчанию
+}
+
+func (b *holdRequest) Validate() error {
+	if err := requiredField("order", b.Order); err != nil {
+		return err
+	}
+	if b.Sum <= 0 {
+		return ErrNonPositiveSum
+	}
+	if b.TTLSeconds < 0 {
+		return ErrNegativeTTL
+	}
+	return nil
+}
+
+func (h *Handler) HoldBalance(w http.ResponseWriter, r *http.Request) {
+	username, err := middleware.ExtractUserFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !CheckRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req holdRequest
+	if !bindJSON(w, r, &req) {
+		return
+	}
+
+	user, err := h.Service.Repo.GetUserByLogin(username)
+	if err != nil {
+		http.Error(w, "The user does not exist", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.Service.CheckWithdrawal(r.Context(), user, req.Order, req.Sum); err != nil {
+		if errors.Is(err, service.ErrRiskBlocked) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, "Incorrect order number", http.StatusUnprocessableEntity)
+		return
+	}
+
+	hold, err := h.Service.CreateHold(user, req.Order, req.Sum, time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAmount), errors.Is(err, service.ErrInvalidTTL):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, store.ErrInsufficientFunds):
+			http.Error(w, "insufficient funds in the account", http.StatusPaymentRequired)
+		case errors.Is(err, store.ErrWithdrawalLimit):
+			writeLimitError(w, err)
+		default:
+			logging.Logg.ErrorContext(r.Context(), "CreateHold", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hold)
+}
+
+func (h *Handler) CaptureHold(w http.ResponseWriter, r *http.Request) {
+	h.resolveHold(w, r, true)
+}
+
+func (h *Handler) ReleaseHold(w http.ResponseWriter, r *http.Request) {
+	h.resolveHold(w, r, false)
+}
+
+func (h *Handler) resolveHold(w http.ResponseWriter, r *http.Request, capture bool) {
+	username, err := middleware.ExtractUserFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !CheckRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	holdID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid hold id", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.Service.Repo.GetUserByLogin(username)
+	if err != nil {
+		http.Error(w, "The user does not exist", http.StatusInternalServerError)
+		return
+	}
+
+	var hold *model.Hold
+	if capture {
+		hold, err = h.Service.CaptureHold(user, holdID)
+	} else {
+		hold, err = h.Service.ReleaseHold(user, holdID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrHoldNotFound):
+			http.Error(w, "Active hold not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrHoldExpired):
+			http.Error(w, "Hold expired", http.StatusGone)
+		case errors.Is(err, store.ErrInsufficientFunds):
+			http.Error(w, "Insufficient funds to capture the hold", http.StatusPaymentRequired)
+		default:
+			logging.Logg.ErrorContext(r.Context(), "resolveHold", "capture", capture, "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(hold)
+}
+
+func (h *Handler) GetHolds(w http.ResponseWriter, r *http.Request) {
+	username, err := middleware.ExtractUserFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !CheckRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	user, err := h.Service.Repo.GetUserByLogin(username)
+	if err != nil {
+		http.Error(w, "The user does not exist", http.StatusInternalServerError)
+		return
+	}
+
+	holds, err := h.Service.Repo.GetHolds(user.ID)
+	if err != nil {
+		logging.Logg.ErrorContext(r.Context(), "GetHolds", "err", err)
+		http.Error(w, "Failed fetching holds from DB", http.StatusInternalServerError)
+		return
+	}
+
+	if len(holds) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(holds)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"gopher-market/internal/store"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// limitErrorResponse — тело ответа о превышении ограничения списаний
+type limitErrorResponse struct {
+	Code    string     `json:"code"`               // всегда withdrawal_limit
+	Limit   string     `json:"limit"`              // min_amount, per_transaction, daily или monthly
+	Value   float32    `json:"value"`              // значение ограничения
+	ResetAt *time.Time `json:"reset_at,omitempty"` // когда ограничение за период снова допускает списание
+}
+
+// writeLimitError отвечает на превышение ограничения списаний. Суточное и месячное ограничения
+// отвечают 429 с Retry-After до начала следующего периода, ограничения суммы одного списания — 422:
+// повтор той же суммы не поможет.
+func writeLimitError(w http.ResponseWriter, err error) {
+	resp := limitErrorResponse{Code: "withdrawal_limit"}
+	status := http.StatusUnprocessableEntity
+	var limitErr *store.LimitError
+	if errors.As(err, &limitErr) {
+		resp.Limit, resp.Value = limitErr.Limit, limitErr.Value
+		if !limitErr.ResetAt.IsZero() {
+			resp.ResetAt = &limitErr.ResetAt
+			status = http.StatusTooManyRequests
+			retryAfter := math.Ceil(time.Until(limitErr.ResetAt).Seconds())
+			w.Header().Set("Retry-After", strconv.Itoa(max(int(retryAfter), 1)))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// limitsRequest — индивидуальные ограничения списаний из тела запроса
+type limitsRequest model.WithdrawalLimitOverride
+
+func (b *limitsRequest) Validate() error {
+	for _, v := range []*float32{b.MinAmount, b.PerTransaction, b.Daily, b.Monthly} {
+		if v != nil && *v < 0 {
+			return ErrNegativeLimit
+		}
+	}
+	return nil
+}
+
+// limitsUser находит пользователя по логину из пути запроса
+func (h *Handler) limitsUser(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	user, err := h.Service.Repo.GetUserByLogin(chi.URLParam(r, "login"))
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return nil, false
+		}
+		logging.Logg.ErrorContext(r.Context(), "GetUserByLogin", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+func (h *Handler) writeWithdrawalLimits(w http.ResponseWriter, r *http.Request, user *model.User) {
+	limits, err := h.Service.Repo.GetWithdrawalLimits(user, h.Service.WithdrawalLimits())
+	if err != nil {
+		logging.Logg.ErrorContext(r.Context(), "GetWithdrawalLimits", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(limits)
+}
+
+func (h *Handler) GetWithdrawalLimits(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	user, ok := h.limitsUser(w, r)
+	if !ok {
+		return
+	}
+	h.writeWithdrawalLimits(w, r, user)
+}
+
+// SetWithdrawalLimits задает индивидуальные ограничения; не указанные поля наследуют общие значения
+func (h *Handler) SetWithdrawalLimits(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodPut) {
+		return
+	}
+
+	user, ok := h.limitsUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req limitsRequest
+	if !bindJSON(w, r, &req) {
+		return
+	}
+
+	if err := h.Service.Repo.SetWithdrawalLimitOverride(user.ID, model.WithdrawalLimitOverride(req)); err != nil {
+		logging.Logg.ErrorContext(r.Context(), "SetWithdrawalLimitOverride", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.writeWithdrawalLimits(w, r, user)
+}
+
+func (h *Handler) DeleteWithdrawalLimits(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodDelete) {
+		return
+	}
+
+	user, ok := h.limitsUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.Repo.DeleteWithdrawalLimitOverride(user.ID); err != nil {
+		logging.Logg.ErrorContext(r.Context(), "DeleteWithdrawalLimitOverride", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopher-market/internal/store"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWriteLimitError(t *testing.T) {
+	reset := time.Now().Add(90 * time.Minute)
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		retryAfter bool
+	}{
+		{"daily", &store.LimitError{Limit: "daily", Value: 500, ResetAt: reset}, http.StatusTooManyRequests, true},
+		{"wrapped monthly", fmt.Errorf("withdraw: %w", &store.LimitError{Limit: "monthly", Value: 5000, ResetAt: reset}), http.StatusTooManyRequests, true},
+		{"per transaction", &store.LimitError{Limit: "per_transaction", Value: 100}, http.StatusUnprocessableEntity, false},
+		{"min amount", &store.LimitError{Limit: "min_amount", Value: 10}, http.StatusUnprocessableEntity, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeLimitError(rec, tt.err)
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			var resp limitErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != "withdrawal_limit" || resp.Limit == "" || resp.Value == 0 {
+				t.Errorf("Unexpected response %+v", resp)
+			}
+
+			header := rec.Header().Get("Retry-After")
+			if !tt.retryAfter {
+				if header != "" || resp.ResetAt != nil {
+					t.Errorf("Expected no retry hint, got Retry-After %q and reset_at %v", header, resp.ResetAt)
+				}
+				return
+			}
+			seconds, err := strconv.Atoi(header)
+			if err != nil || seconds < 89*60 || seconds > 90*60 {
+				t.Errorf("Expected Retry-After until the period reset, got %q", header)
+			}
+			if resp.ResetAt == nil || !resp.ResetAt.Equal(reset) {
+				t.Errorf("Expected reset_at %v, got %v", reset, resp.ResetAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gopher-market/internal/middleware"
+	"gopher-market/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+func TestReferralRegistration(t *testing.T) {
+	handler := newDBHandler(t)
+
+	suffix := time.Now().UnixNano()
+	referrer := fmt.Sprintf("referrer%d", suffix)
+	referee := fmt.Sprintf("referee%d", suffix)
+	t.Cleanup(func() {
+		handler.Service.Repo.DB.Exec("DELETE FROM users WHERE login IN ($1, $2)", referrer, referee)
+	})
+
+	r := chi.NewRouter()
+	r.Post("/api/user/register", handler.RegisterUser)
+	r.Get("/api/user/referral", handler.GetReferral)
+
+	register := func(login, code string) int {
+		body := fmt.Sprintf(`{"login":%q,"password":"secret","referral_code":%q}`, login, code)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/user/register", strings.NewReader(body)))
+		return rr.Code
+	}
+	summary := func(login string) model.ReferralSummary {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/referral", nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, login))
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rr.Code)
+		}
+		var s model.ReferralSummary
+		if err := json.Unmarshal(rr.Body.Bytes(), &s); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		return s
+	}
+
+	if code := register(referrer, ""); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	referralCode := summary(referrer).Code
+	if len(referralCode) != 8 {
+		t.Fatalf("Expected an 8 character referral code, got %q", referralCode)
+	}
+
+	t.Run("Unknown referral code", func(t *testing.T) {
+		if code := register(referee, "UNKNOWN0"); code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", code)
+		}
+	})
+
+	t.Run("Registration by referral code", func(t *testing.T) {
+		if code := register(referee, strings.ToLower(referralCode)); code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", code)
+		}
+		s := summary(referrer)
+		if s.Invited != 1 || len(s.Referrals) != 1 || s.Referrals[0].Referee != referee || s.Referrals[0].Status != model.ReferralPending {
+			t.Errorf("Unexpected referral summary: %+v", s)
+		}
+		if s := summary(referee); s.Code == "" || s.Code == referralCode || s.Invited != 0 {
+			t.Errorf("Unexpected referee summary: %+v", s)
+		}
+	})
+
+	t.Run("Login already taken", func(t *testing.T) {
+		if code := register(referrer, ""); code != http.StatusConflict {
+			t.Errorf("Expected status 409, got %d", code)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/service"
+	"gopher-market/internal/store"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+// AdminReverseWithdrawal отменяет списание по запросу администратора
+func (h *Handler) AdminReverseWithdrawal(w http.ResponseWriter, r *http.Request) {
+	h.reverseWithdrawal(w, r, "admin")
+}
+
+// PartnerReverseWithdrawal отменяет списание по запросу партнера, например при отмене покупки
+func (h *Handler) PartnerReverseWithdrawal(w http.ResponseWriter, r *http.Request) {
+	h.reverseWithdrawal(w, r, "partner")
+}
+
+func (h *Handler) reverseWithdrawal(w http.ResponseWriter, r *http.Request, initiator string) {
+	if !CheckRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	orderNumber := chi.URLParam(r, "number")
+	if !service.IsNumeric(orderNumber) {
+		http.Error(w, "invalid order number format", http.StatusBadRequest)
+		return
+	}
+	// Номер заказа не уникален между пользователями, поэтому владелец списания указывается явно
+	login := r.URL.Query().Get("login")
+	if login == "" {
+		http.Error(w, "login is required", http.StatusBadRequest)
+		return
+	}
+
+	reversal, err := h.Service.ReverseWithdrawal(login, orderNumber, initiator)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrWithdrawalNotFound):
+			http.Error(w, "Withdrawal not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrAlreadyReversed):
+			http.Error(w, "Withdrawal already reversed", http.StatusConflict)
+		default:
+			logging.Logg.ErrorContext(r.Context(), "ReverseWithdrawal", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(reversal)
+}
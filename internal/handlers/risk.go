@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"gopher-market/internal/store"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	defaultReviewsLimit = 100
+	maxReviewsLimit     = 1000
+)
+
+type resolveReviewRequest struct {
+	Status string `json:"status"` // approved или rejected
+	Note   string `json:"note"`
+}
+
+func (b *resolveReviewRequest) Validate() error {
+	status := strings.ToUpper(b.Status)
+	if status != model.ReviewApproved && status != model.ReviewRejected {
+		return ErrReviewStatus
+	}
+	return nil
+}
+
+// GetRiskReviews возвращает очередь проверок; по умолчанию только открытые, status=all — все
+func (h *Handler) GetRiskReviews(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	status := strings.ToUpper(r.URL.Query().Get("status"))
+	switch status {
+	case "":
+		status = model.ReviewOpen
+	case "ALL":
+		status = ""
+	case model.ReviewOpen, model.ReviewApproved, model.ReviewRejected:
+	default:
+		http.Error(w, "Invalid review status", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultReviewsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxReviewsLimit {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	reviews, err := h.Service.Repo.GetRiskReviews(status, limit)
+	if err != nil {
+		logging.Logg.ErrorContext(r.Context(), "GetRiskReviews", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// ResolveRiskReview закрывает открытую проверку решением администратора
+func (h *Handler) ResolveRiskReview(w http.ResponseWriter, r *http.Request) {
+	if !CheckRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid review id", http.StatusBadRequest)
+		return
+	}
+
+	var req resolveReviewRequest
+	if !bindJSON(w, r, &req) {
+		return
+	}
+	status := strings.ToUpper(req.Status)
+
+	if err := h.Service.Repo.ResolveRiskReview(id, status, req.Note); err != nil {
+		if errors.Is(err, store.ErrReviewNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		logging.Logg.ErrorContext(r.Context(), "ResolveRiskReview", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
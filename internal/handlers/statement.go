@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/middleware"
+	"gopher-market/internal/statement"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+// statementFormat выбирает формат выписки по параметру format, а без него — по заголовку Accept
+func statementFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "text/csv"):
+		return statement.FormatCSV
+	case strings.Contains(accept, "text/html"):
+		return statement.FormatHTML
+	}
+	return statement.FormatJSON
+}
+
+func (h *Handler) GetStatement(w http.ResponseWriter, r *http.Request) {
+	username, err := middleware.ExtractUserFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !CheckRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	format := statementFormat(r)
+	if format != statement.FormatJSON && format != statement.FormatCSV && format != statement.FormatHTML {
+		http.Error(w, "Unsupported statement format", http.StatusNotAcceptable)
+		return
+	}
+
+	user, err := h.Service.Repo.GetUserByLogin(username)
+	if err != nil {
+		http.Error(w, "The user does not exist", http.StatusInternalServerError)
+		return
+	}
+
+	period := chi.URLParam(r, "period")
+	s, err := h.Service.GetStatement(user, period)
+	if err != nil {
+		if errors.Is(err, statement.ErrInvalidPeriod) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logging.Logg.ErrorContext(r.Context(), "GetStatement", "err", err)
+		http.Error(w, "Failed fetching statement from DB", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", statement.ContentType(format))
+	if format == statement.FormatCSV {
+		w.Header().Set("Content-Disposition", `attachment; filename="statement-`+period+`.csv"`)
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := statement.Write(w, s, format); err != nil {
+		logging.Logg.ErrorContext(r.Context(), "Failed to write statement", "err", err)
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/middleware"
+	"gopher-market/internal/model"
+	"gopher-market/internal/service"
+	"gopher-market/internal/store"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+type transferRequest struct {
+	To  string  `json:"to"`  // логин получателя
+	Sum float32 `json:"sum"` // сумма перевода
+}
+
+func (b *transferRequest) Validate() error {
+	if err := requiredField("to", b.To); err != nil {
+		return err
+	}
+	if b.Sum <= 0 {
+		return ErrNonPositiveSum
+	}
+	return nil
+}
+
+func (h *Handler) TransferBalance(w http.ResponseWriter, r *http.Request) {
+	username, err := middleware.ExtractUserFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !CheckRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req transferRequest
+	if !bindJSON(w, r, &req) {
+		return
+	}
+
+	user, err := h.Service.Repo.GetUserByLogin(username)
+	if err != nil {
+		http.Error(w, "The user does not exist", http.StatusInternalServerError)
+		return
+	}
+
+	transfer, err := h.Service.Transfer(r.Context(), user, req.To, req.Sum)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAmount), errors.Is(err, store.ErrSelfTransfer):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, store.ErrUserNotFound):
+			http.Error(w, "Recipient not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrInsufficientFunds):
+			http.Error(w, "insufficient funds in the account", http.StatusPaymentRequired)
+		case errors.Is(err, store.ErrWithdrawalLimit):
+			writeLimitError(w, err)
+		case errors.Is(err, store.ErrTransferLimit), errors.Is(err, service.ErrRiskBlocked):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			logging.Logg.ErrorContext(r.Context(), "Transfer", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if transfer.Status == model.TransferPending {
+		status = http.StatusAccepted
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(transfer)
+}
+
+func (h *Handler) AcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	h.resolveTransfer(w, r, true)
+}
+
+func (h *Handler) DeclineTransfer(w http.ResponseWriter, r *http.Request) {
+	h.resolveTransfer(w, r, false)
+}
+
+func (h *Handler) resolveTransfer(w http.ResponseWriter, r *http.Request, accept bool) {
+	username, err := middleware.ExtractUserFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !CheckRequestMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	transferID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid transfer id", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.Service.Repo.GetUserByLogin(username)
+	if err != nil {
+		http.Error(w, "The user does not exist", http.StatusInternalServerError)
+		return
+	}
+
+	transfer, err := h.Service.ResolveTransfer(user, transferID, accept)
+	if err != nil {
+		if errors.Is(err, store.ErrTransferNotFound) {
+			http.Error(w, "Pending transfer not found", http.StatusNotFound)
+			return
+		}
+		logging.Logg.ErrorContext(r.Context(), "ResolveTransfer", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer)
+}
+
+func (h *Handler) GetTransfers(w http.ResponseWriter, r *http.Request) {
+	username, err := middleware.ExtractUserFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !CheckRequestMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	user, err := h.Service.Repo.GetUserByLogin(username)
+	if err != nil {
+		http.Error(w, "The user does not exist", http.StatusInternalServerError)
+		return
+	}
+
+	transfers, err := h.Service.Repo.GetTransfers(user.ID)
+	if err != nil {
+		logging.Logg.ErrorContext(r.Context(), "GetTransfers", "err", err)
+		http.Error(w, "Failed fetching transfers from DB", http.StatusInternalServerError)
+		return
+	}
+
+	if len(transfers) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfers)
+}
@@ -0,0 +1,130 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CheckTimeout — сколько ждать ответа каждой проверки готовности
+const CheckTimeout = 2 * time.Second
+
+var ErrShuttingDown = errors.New("server is shutting down")
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckFunc проверяет один компонент; nil означает, что компонент исправен
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Component — результат проверки одного компонента
+type Component struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report — ответ /readyz
+type Report struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components"`
+}
+
+// Checker отвечает на проверки живости и готовности процесса
+type Checker struct {
+	mu           sync.Mutex
+	checks       []check
+	shuttingDown atomic.Bool
+}
+
+func New() *Checker {
+	return &Checker{}
+}
+
+// AddCheck регистрирует проверку готовности компонента name
+func (c *Checker) AddCheck(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// SetShuttingDown переводит процесс в неготовое состояние, чтобы балансировщик перестал направлять запросы
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Ready выполняет все проверки параллельно
+func (c *Checker) Ready(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := append([]check(nil), c.checks...)
+	c.mu.Unlock()
+
+	report := Report{Status: StatusOK, Components: make(map[string]Component, len(checks)+1)}
+	shutdown := Component{Status: StatusOK}
+	if c.shuttingDown.Load() {
+		shutdown = Component{Status: StatusFail, Error: ErrShuttingDown.Error()}
+	}
+	report.Components["shutdown"] = shutdown
+
+	results := make([]Component, len(checks))
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := ch.fn(ctx)
+			results[i] = Component{Status: StatusOK, DurationMS: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				results[i].Status = StatusFail
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, ch := range checks {
+		report.Components[ch.name] = results[i]
+	}
+	for _, comp := range report.Components {
+		if comp.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+// LivenessHandler отвечает 200, пока процесс способен обслуживать HTTP-запросы
+func (c *Checker) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": StatusOK})
+}
+
+// ReadinessHandler отвечает 200, если все компоненты исправны, иначе 503 с подробностями
+func (c *Checker) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	report := c.Ready(r.Context())
+
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,49 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadiness(t *testing.T) {
+	c := New()
+	var dbErr error
+	c.AddCheck("database", func(context.Context) error { return dbErr })
+
+	get := func() (int, Report) {
+		rec := httptest.NewRecorder()
+		c.ReadinessHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var report Report
+		if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+			t.Fatalf("Invalid JSON: %v", err)
+		}
+		return rec.Code, report
+	}
+
+	if code, report := get(); code != http.StatusOK || report.Status != StatusOK || report.Components["database"].Status != StatusOK {
+		t.Errorf("Expected ready, got %d %+v", code, report)
+	}
+
+	dbErr = errors.New("connection refused")
+	code, report := get()
+	if code != http.StatusServiceUnavailable || report.Components["database"].Error != "connection refused" {
+		t.Errorf("Expected database failure, got %d %+v", code, report)
+	}
+
+	dbErr = nil
+	c.SetShuttingDown()
+	code, report = get()
+	if code != http.StatusServiceUnavailable || report.Components["shutdown"].Status != StatusFail {
+		t.Errorf("Expected not ready during shutdown, got %d %+v", code, report)
+	}
+
+	rec := httptest.NewRecorder()
+	c.LivenessHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Liveness must not depend on readiness, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,279 @@
+package httpserver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gopher-market/internal/config"
+	"gopher-market/internal/events"
+	"gopher-market/internal/handlers"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/middleware"
+	"gopher-market/internal/openapi"
+	"gopher-market/internal/service"
+	"gopher-market/internal/store"
+	"gopher-market/internal/tier"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EClaesson/go-luhn"
+	"github.com/go-chi/chi"
+)
+
+const (
+	testAdminToken   = "admin-token"
+	testPartnerToken = "partner-token"
+)
+
+func TestMain(m *testing.M) {
+	logging.Logg = logging.NewLogger("error", "text", "text", "console", "")
+	os.Exit(m.Run())
+}
+
+// newTestServer собирает роутер с базой, к которой невозможно подключиться: контрактные тесты
+// проверяют ответы, которые не требуют данных, а обращения к хранилищу должны отвечать описанной ошибкой 500
+func newTestServer(t *testing.T) (*Server, *config.Config) {
+	t.Helper()
+	db, err := sql.Open("pgx", "postgres://gophermart@127.0.0.1:1/gophermart?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Config{SecretKey: "contract-test", AdminToken: testAdminToken, PartnerToken: testPartnerToken, TLSMinVersion: "1.2"}
+	svc := service.NewService(store.Database{DB: db})
+	svc.Config = cfg
+	svc.Events = events.NewBroker(&svc.Repo, false)
+
+	srv, err := New(*cfg, &handlers.Handler{Service: svc, Config: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, cfg
+}
+
+func TestRoutesDocumented(t *testing.T) {
+	srv, _ := newTestServer(t)
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("Invalid OpenAPI document: %v", err)
+	}
+
+	var routes []string
+	err = chi.Walk(srv.Serv.Handler.(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routes = append(routes, method+" "+route)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(routes)
+
+	documented := doc.Routes()
+	for _, route := range routes {
+		if !slices.Contains(documented, route) {
+			t.Errorf("Route %s is not described in openapi.json", route)
+		}
+	}
+	for _, route := range documented {
+		if !slices.Contains(routes, route) {
+			t.Errorf("Route %s is described in openapi.json but not registered", route)
+		}
+	}
+}
+
+func TestResponsesMatchContract(t *testing.T) {
+	srv, cfg := newTestServer(t)
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("Invalid OpenAPI document: %v", err)
+	}
+	token, err := service.GenerateToken("contract-user", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := map[string]string{"Authorization": "Bearer " + token}
+	admin := map[string]string{middleware.AdminTokenHeader: testAdminToken}
+	partner := map[string]string{middleware.PartnerTokenHeader: testPartnerToken}
+	jsonBody := map[string]string{"Content-Type": "application/json"}
+	batch := strings.Repeat("12345678903\n", 1001)
+
+	tests := []struct {
+		method  string
+		path    string
+		route   string
+		headers map[string]string
+		body    string
+		status  int
+	}{
+		{http.MethodGet, "/healthz", "/healthz", nil, "", http.StatusOK},
+		{http.MethodGet, "/readyz", "/readyz", nil, "", http.StatusServiceUnavailable},
+		{http.MethodGet, "/api/openapi.json", "/api/openapi.json", nil, "", http.StatusOK},
+
+		{http.MethodPost, "/api/user/register", "/api/user/register", jsonBody, `{"login":"user"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/user/register", "/api/user/register", jsonBody, `{"login":"user","password":"p","role":"admin"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/user/register", "/api/user/register", jsonBody, `{"login":"` + strings.Repeat("u", middleware.SmallBodyLimit) + `"}`, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/api/user/login", "/api/user/login", jsonBody, `{"login":"user","password":"secret"}`, http.StatusInternalServerError},
+
+		{http.MethodGet, "/api/user/orders", "/api/user/orders", nil, "", http.StatusUnauthorized},
+		{http.MethodPost, "/api/user/orders/batch", "/api/user/orders/batch", user, "", http.StatusBadRequest},
+		{http.MethodPost, "/api/user/orders/batch", "/api/user/orders/batch", user, batch, http.StatusRequestEntityTooLarge},
+		{http.MethodGet, "/api/user/orders/abc", "/api/user/orders/{number}", user, "", http.StatusBadRequest},
+		{http.MethodGet, "/api/user/balance", "/api/user/balance", user, "", http.StatusInternalServerError},
+		{http.MethodGet, "/api/user/tier", "/api/user/tier", user, "", http.StatusInternalServerError},
+		{http.MethodGet, "/api/user/statements/2024-01?format=pdf", "/api/user/statements/{period}", user, "", http.StatusNotAcceptable},
+		{http.MethodPost, "/api/user/balance/transfer/abc/accept", "/api/user/balance/transfer/{id}/accept", user, "", http.StatusBadRequest},
+		{http.MethodPost, "/api/user/balance/hold/abc/release", "/api/user/balance/hold/{id}/release", user, "", http.StatusBadRequest},
+		{http.MethodGet, "/api/user/events", "/api/user/events", map[string]string{"Authorization": "Bearer " + token, "Last-Event-ID": "-1"}, "", http.StatusBadRequest},
+
+		{http.MethodGet, "/api/admin/webhooks", "/api/admin/webhooks", nil, "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/admin/webhooks", "/api/admin/webhooks", admin, "", http.StatusInternalServerError},
+		{http.MethodPost, "/api/admin/webhooks", "/api/admin/webhooks", admin, `{"url":"ftp://example.com"}`, http.StatusBadRequest},
+		{http.MethodDelete, "/api/admin/campaigns/abc", "/api/admin/campaigns/{id}", admin, "", http.StatusBadRequest},
+		{http.MethodGet, "/api/admin/risk/reviews?status=unknown", "/api/admin/risk/reviews", admin, "", http.StatusBadRequest},
+
+		{http.MethodPost, "/api/partner/withdrawals/12345678903/reverse", "/api/partner/withdrawals/{number}/reverse", nil, "", http.StatusUnauthorized},
+		{http.MethodPost, "/api/partner/withdrawals/abc/reverse", "/api/partner/withdrawals/{number}/reverse", partner, "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			srv.Serv.Handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if err := doc.ValidateResponse(tt.method, tt.route, rec.Code, rec.Header().Get("Content-Type"), rec.Body.Bytes()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// newDBTestServer собирает роутер с тестовой базой из TEST_DATABASE_URI; без нее тест пропускается
+func newDBTestServer(t *testing.T) (*Server, *store.Database) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+	var repo store.Database
+	if err := repo.NewStorage(dsn); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.DB.Close() })
+	if err := repo.DB.Ping(); err != nil {
+		t.Skipf("Test database is not available: %v", err)
+	}
+	if err := repo.CheckMigrations(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tiers, err := tier.Parse(tier.DefaultSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{SecretKey: "contract-test", Tiers: tiers, ExpiringSoonDays: 30, TLSMinVersion: "1.2"}
+	svc := service.NewService(repo)
+	svc.Config = cfg
+	svc.Events = events.NewBroker(&svc.Repo, false)
+
+	srv, err := New(*cfg, &handlers.Handler{Service: svc, Config: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, &svc.Repo
+}
+
+// luhnNumber дополняет base контрольной цифрой по алгоритму Луна
+func luhnNumber(t *testing.T, base string) string {
+	t.Helper()
+	digit, err := luhn.GetControlDigit(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base + strconv.Itoa(digit)
+}
+
+func TestSuccessResponsesMatchContract(t *testing.T) {
+	srv, repo := newDBTestServer(t)
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("Invalid OpenAPI document: %v", err)
+	}
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	login := "contract-" + suffix
+	t.Cleanup(func() {
+		if _, err := repo.DB.Exec("DELETE FROM users WHERE login = $1", login); err != nil {
+			t.Errorf("Failed to delete test user: %v", err)
+		}
+	})
+	order := luhnNumber(t, suffix)
+	withdrawal := luhnNumber(t, suffix[1:]+"1")
+
+	jsonBody := map[string]string{"Content-Type": "application/json"}
+	user := map[string]string{}
+
+	tests := []struct {
+		method  string
+		path    string
+		route   string
+		headers map[string]string
+		body    string
+		status  int
+	}{
+		{http.MethodPost, "/api/user/register", "/api/user/register", jsonBody, `{"login":"` + login + `","password":"secret"}`, http.StatusOK},
+		{http.MethodPost, "/api/user/login", "/api/user/login", jsonBody, `{"login":"` + login + `","password":"secret"}`, http.StatusOK},
+		{http.MethodGet, "/api/user/orders", "/api/user/orders", user, "", http.StatusNoContent},
+		{http.MethodPost, "/api/user/orders", "/api/user/orders", user, order, http.StatusAccepted},
+		{http.MethodPost, "/api/user/orders", "/api/user/orders", user, order, http.StatusOK},
+		{http.MethodGet, "/api/user/orders", "/api/user/orders", user, "", http.StatusOK},
+		{http.MethodGet, "/api/user/balance", "/api/user/balance", user, "", http.StatusOK},
+		{http.MethodGet, "/api/user/withdrawals", "/api/user/withdrawals", user, "", http.StatusNoContent},
+		{http.MethodPost, "/api/user/balance/withdraw", "/api/user/balance/withdraw", user, `{"order":"` + withdrawal + `","sum":10}`, http.StatusOK},
+		{http.MethodGet, "/api/user/withdrawals", "/api/user/withdrawals", user, "", http.StatusOK},
+		{http.MethodGet, "/api/user/balance", "/api/user/balance", user, "", http.StatusOK},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d %s %s", i, tt.method, tt.path), func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			srv.Serv.Handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if err := doc.ValidateResponse(tt.method, tt.route, rec.Code, rec.Header().Get("Content-Type"), rec.Body.Bytes()); err != nil {
+				t.Error(err)
+			}
+			// Дальнейшие запросы выполняются с токеном зарегистрированного пользователя
+			if tt.path == "/api/user/register" {
+				user["Authorization"] = rec.Header().Get("Authorization")
+			}
+		})
+
+		// Баллы для списания зачисляются напрямую: система расчета в тесте недоступна
+		if tt.path == "/api/user/withdrawals" && tt.status == http.StatusNoContent {
+			if _, err := repo.DB.Exec("UPDATE users SET current_balance = 100 WHERE login = $1", login); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
@@ -2,43 +2,125 @@ package httpserver
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
 	"net/http"
 	"os"
 	"time"
 
 	"gopher-market/internal/config"
+	"gopher-market/internal/gzip"
 	"gopher-market/internal/handlers"
+	"gopher-market/internal/health"
 	"gopher-market/internal/logging"
 	"gopher-market/internal/middleware"
+	"gopher-market/internal/openapi"
+	"gopher-market/internal/ratelimit"
+	"gopher-market/internal/tlsconfig"
 
 	"github.com/go-chi/chi"
 )
 
 type Server struct {
-	Serv *http.Server
+	Serv   *http.Server
+	Health *health.Checker
+
+	cert       *tlsconfig.Reloader // nil, если HTTPS не настроен
+	stopReload context.CancelFunc
+	drain      time.Duration // пауза между переходом в неготовое состояние и остановкой сервера
 }
 
 func New(cfg config.Config, handler *handlers.Handler) (*Server, error) {
 	authMiddleware := middleware.AuthMiddleware(&cfg)
+	adminMiddleware := middleware.AdminMiddleware(&cfg)
+	partnerMiddleware := middleware.PartnerMiddleware(&cfg)
+	clientCertMiddleware := middleware.ClientCertMiddleware(&cfg)
+	rateLimitMiddleware := newRateLimitMiddleware(cfg, handler)
 	r := chi.NewRouter()
+	r.Use(middleware.TraceMiddleware)
+	r.Use(gzip.GzipMiddleware)
+	r.Use(middleware.BodyLimitMiddleware(middleware.DefaultBodyLimit))
+	smallBody := middleware.BodyLimitMiddleware(middleware.SmallBodyLimit)
+
+	checker := health.New()
+	checker.AddCheck("database", handler.Service.Repo.Ping)
+	checker.AddCheck("migrations", handler.Service.Repo.CheckMigrations)
+	r.Get("/healthz", checker.LivenessHandler)
+	r.Get("/readyz", checker.ReadinessHandler)
 	r.Route("/api/user", func(r chi.Router) {
 		r.Use(middleware.LoggingMiddleware(logging.Logg))
-		r.Post("/register", handler.RegisterUser)
-		r.Post("/login", handler.LoginUser)
+		r.With(rateLimitMiddleware, smallBody).Post("/register", handler.RegisterUser)
+		r.With(rateLimitMiddleware, smallBody).Post("/login", handler.LoginUser)
 
 		r.Group(func(r chi.Router) {
 			r.Use(authMiddleware)
+			r.Use(rateLimitMiddleware)
 			r.Post("/orders", handler.UploadOrder)
+			r.Post("/orders/batch", handler.UploadOrdersBatch)
 			r.Get("/orders", handler.GetOrders)
+			r.Get("/orders/{number}", handler.GetOrder)
 
 			r.Get("/balance", handler.GetBalance)
+			r.Get("/tier", handler.GetTier)
+			r.Get("/referral", handler.GetReferral)
 
-			r.Post("/balance/withdraw", handler.WithdrawBalance)
+			r.With(smallBody).Post("/balance/withdraw", handler.WithdrawBalance)
 			r.Get("/withdrawals", handler.GetWithdrawals)
+			r.Get("/statements/{period}", handler.GetStatement)
+
+			r.With(smallBody).Post("/balance/transfer", handler.TransferBalance)
+			r.Post("/balance/transfer/{id}/accept", handler.AcceptTransfer)
+			r.Post("/balance/transfer/{id}/decline", handler.DeclineTransfer)
+			r.Get("/transfers", handler.GetTransfers)
+
+			r.With(smallBody).Post("/balance/hold", handler.HoldBalance)
+			r.Post("/balance/hold/{id}/capture", handler.CaptureHold)
+			r.Post("/balance/hold/{id}/release", handler.ReleaseHold)
+			r.Get("/balance/holds", handler.GetHolds)
+
+			r.Get("/events", handler.StreamEvents)
 		})
 	})
 
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(middleware.LoggingMiddleware(logging.Logg))
+		r.Use(clientCertMiddleware)
+		r.Use(adminMiddleware)
+		r.Use(rateLimitMiddleware)
+
+		r.With(smallBody).Post("/webhooks", handler.CreateWebhook)
+		r.Get("/webhooks", handler.GetWebhooks)
+		r.Delete("/webhooks/{id}", handler.DeleteWebhook)
+		r.Get("/webhooks/dead-letters", handler.GetDeadWebhookDeliveries)
+		r.Post("/webhooks/deliveries/{id}/retry", handler.RetryWebhookDelivery)
+
+		r.Post("/withdrawals/{number}/reverse", handler.AdminReverseWithdrawal)
+
+		r.With(smallBody).Post("/campaigns", handler.CreateCampaign)
+		r.Get("/campaigns", handler.GetCampaigns)
+		r.Get("/campaigns/{id}", handler.GetCampaign)
+		r.With(smallBody).Put("/campaigns/{id}", handler.UpdateCampaign)
+		r.Delete("/campaigns/{id}", handler.DeleteCampaign)
+
+		r.Get("/users/{login}/withdrawal-limits", handler.GetWithdrawalLimits)
+		r.With(smallBody).Put("/users/{login}/withdrawal-limits", handler.SetWithdrawalLimits)
+		r.Delete("/users/{login}/withdrawal-limits", handler.DeleteWithdrawalLimits)
+
+		r.Get("/risk/reviews", handler.GetRiskReviews)
+		r.With(smallBody).Post("/risk/reviews/{id}/resolve", handler.ResolveRiskReview)
+	})
+
+	r.Route("/api/partner", func(r chi.Router) {
+		r.Use(middleware.LoggingMiddleware(logging.Logg))
+		r.Use(clientCertMiddleware)
+		r.Use(partnerMiddleware)
+		r.Use(rateLimitMiddleware)
+
+		r.Post("/withdrawals/{number}/reverse", handler.PartnerReverseWithdrawal)
+	})
+
+	r.Get("/api/openapi.json", openapi.Handler)
+
 	serv := &http.Server{
 		Addr:         cfg.Address,
 		Handler:      r,
@@ -47,13 +129,71 @@ func New(cfg config.Config, handler *handlers.Handler) (*Server, error) {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	return &Server{Serv: serv}, nil
+	// Потоки событий иначе удерживали бы соединения до истечения таймаута остановки
+	serv.RegisterOnShutdown(handler.Service.Events.Close)
+
+	s := &Server{Serv: serv, Health: checker, drain: cfg.ShutdownDrain}
+	if cfg.TLSCertFile != "" {
+		if err := s.configureTLS(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// configureTLS загружает сертификат сервера и, если задан, пул удостоверяющих центров клиентов
+func (s *Server) configureTLS(cfg config.Config) error {
+	minVersion, err := tlsconfig.ParseVersion(cfg.TLSMinVersion)
+	if err != nil {
+		return err
+	}
+	cert, err := tlsconfig.NewReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if cfg.TLSClientCAFile != "" {
+		if clientCAs, err = tlsconfig.LoadCertPool(cfg.TLSClientCAFile); err != nil {
+			return fmt.Errorf("failed to load client CA: %w", err)
+		}
+	}
+
+	s.cert = cert
+	s.Serv.TLSConfig = tlsconfig.Server(cert, minVersion, clientCAs)
+	return nil
+}
+
+// newRateLimitMiddleware создает ограничение частоты запросов по конфигурации; без правил запросы не ограничиваются
+func newRateLimitMiddleware(cfg config.Config, handler *handlers.Handler) func(next http.Handler) http.Handler {
+	if len(cfg.RateLimitRules) == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimitStore == config.RateLimitPostgres {
+		store = ratelimit.StoreFunc(handler.Service.Repo.TakeRateLimitToken)
+	}
+	return middleware.RateLimitMiddleware(ratelimit.New(cfg.RateLimitRules, store))
 }
 
 func (s *Server) Start() {
+	if s.cert != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopReload = cancel
+		go s.cert.Watch(ctx, tlsconfig.ReloadInterval)
+	}
+
 	go func() {
-		logging.Logg.Info("Starting server", "address", s.Serv.Addr)
-		if err := s.Serv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logging.Logg.Info("Starting server", "address", s.Serv.Addr, "tls", s.cert != nil)
+		var err error
+		if s.cert != nil {
+			// Сертификат берется из TLSConfig.GetCertificate, поэтому пути к файлам не передаются
+			err = s.Serv.ListenAndServeTLS("", "")
+		} else {
+			err = s.Serv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logging.Logg.Error("Server failed to start", "error", err)
 			fmt.Println("Server failed to start:", err)
 			os.Exit(1)
@@ -61,8 +201,21 @@ func (s *Server) Start() {
 	}()
 }
 
+// Shutdown переводит сервер в неготовое состояние и, выждав период drain, пока балансировщик
+// перестает направлять запросы, останавливает сервер с ожиданием активных запросов
 func (s *Server) Shutdown(ctx context.Context) error {
-	logging.Logg.Info("Shutting down server gracefully")
+	logging.Logg.Info("Shutting down server gracefully", "drain", s.drain)
+	s.Health.SetShuttingDown()
+	if s.stopReload != nil {
+		s.stopReload()
+	}
+
+	drain := time.NewTimer(s.drain)
+	defer drain.Stop()
+	select {
+	case <-drain.C:
+	case <-ctx.Done():
+	}
 
 	// Отменяем контекст после таймаута
 	shutdownCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
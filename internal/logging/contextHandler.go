@@ -0,0 +1,33 @@
+package logging
+
+import (
+	"context"
+	"gopher-market/internal/trace"
+	"log/slog"
+)
+
+// contextHandler добавляет к записям идентификаторы запроса и трассы из контекста
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := trace.RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if span := trace.SpanFromContext(ctx); span != nil {
+		r.AddAttrs(
+			slog.String("trace_id", span.Context.TraceID.String()),
+			slog.String("span_id", span.Context.SpanID.String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -1,25 +1,32 @@
 package logging
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"time"
 )
 
 // Logger — это обертка над slog.Logger
 type Logger struct {
 	logger *slog.Logger
+	level  *slog.LevelVar // уровень, общий для всех обработчиков; меняется на лету через SetLevel
 }
 
+var ErrUnknownLevel = errors.New("unknown log level, expected debug, info, warn or error")
+
 var Logg *Logger
 
 // NewLogger создает новый экземпляр Logger с уровнем логирования, форматом и назначением
 func NewLogger(logLevel, consoleFormat, fileFormat, destination, filePattern string) *Logger {
 	// Определяем уровень логирования
-	level := getLogLevel(logLevel)
+	level := new(slog.LevelVar)
+	level.Set(getLogLevel(logLevel))
 
 	// Создаем обработчики для терминала и файла
 	var handlers []slog.Handler
@@ -76,7 +83,8 @@ func NewLogger(logLevel, consoleFormat, fileFormat, destination, filePattern str
 
 	// Создаем логгер с несколькими обработчиками
 	return &Logger{
-		logger: slog.New(NewMultiHandler(handlers...)),
+		logger: slog.New(contextHandler{NewMultiHandler(handlers...)}),
+		level:  level,
 	}
 }
 
@@ -97,6 +105,22 @@ func getLogLevel(level string) slog.Level {
 	}
 }
 
+// SetLevel меняет уровень логирования без перезапуска
+func (l *Logger) SetLevel(level string) error {
+	switch level {
+	case "debug", "info", "warn", "error":
+	default:
+		return ErrUnknownLevel
+	}
+	l.level.Set(getLogLevel(level))
+	return nil
+}
+
+// Level возвращает текущий уровень логирования
+func (l *Logger) Level() string {
+	return strings.ToLower(l.level.Level().String())
+}
+
 // generateFileName генерирует имя файла на основе шаблона и текущей даты
 func generateFileName(pattern string) string {
 	now := time.Now()
@@ -136,6 +160,26 @@ func (l *Logger) Debug(msg string, attrs ...any) {
 	l.logger.Debug(msg, attrs...)
 }
 
+// InfoContext логирует информационное сообщение с идентификаторами запроса и трассы из ctx
+func (l *Logger) InfoContext(ctx context.Context, msg string, attrs ...any) {
+	l.logger.InfoContext(ctx, msg, attrs...)
+}
+
+// WarnContext логирует предупреждение с идентификаторами запроса и трассы из ctx
+func (l *Logger) WarnContext(ctx context.Context, msg string, attrs ...any) {
+	l.logger.WarnContext(ctx, msg, attrs...)
+}
+
+// ErrorContext логирует сообщение об ошибке с идентификаторами запроса и трассы из ctx
+func (l *Logger) ErrorContext(ctx context.Context, msg string, attrs ...any) {
+	l.logger.ErrorContext(ctx, msg, attrs...)
+}
+
+// DebugContext логирует отладочное сообщение с идентификаторами запроса и трассы из ctx
+func (l *Logger) DebugContext(ctx context.Context, msg string, attrs ...any) {
+	l.logger.DebugContext(ctx, msg, attrs...)
+}
+
 // Маскировка чувствительных данных
 func MaskSensitiveData(body string) string {
 	re := regexp.MustCompile(`("(password|token)"\s*:\s*")([^"]*)`)
@@ -14,12 +14,12 @@ import (
 // TextHandler — это обработчик для текстового формата
 type TextHandler struct {
 	out       io.Writer
-	level     slog.Level
+	level     slog.Leveler
 	isColored bool
 }
 
 // NewTextHandler создает новый текстовый обработчик
-func newTextHandler(out io.Writer, level slog.Level) *TextHandler {
+func newTextHandler(out io.Writer, level slog.Leveler) *TextHandler {
 	// Проверяем, является ли вывод терминалом
 	isColored := false
 	if f, ok := out.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
@@ -35,7 +35,7 @@ func newTextHandler(out io.Writer, level slog.Level) *TextHandler {
 
 // Enabled проверяет, включен ли уровень логирования
 func (h *TextHandler) Enabled(ctx context.Context, level slog.Level) bool {
-	return level >= h.level
+	return level >= h.level.Level()
 }
 
 // Handle форматирует и записывает сообщение в текстовом формате
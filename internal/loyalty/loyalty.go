@@ -2,15 +2,20 @@ package loyalty
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"gopher-market/internal/logging"
+	"gopher-market/internal/metrics"
+	"gopher-market/internal/trace"
 	"io"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,6 +24,9 @@ var ErrOrderNotRegistered = errors.New("order not registered in the accrual syst
 const (
 	MaxWorkers = 10
 	RetryDelay = 1 * time.Second
+
+	BreakerThreshold = 5                // неудачных запросов подряд, после которых цепь размыкается
+	BreakerCooldown  = 30 * time.Second // через сколько после размыкания выполняется пробный запрос
 )
 
 type Task struct {
@@ -36,18 +44,58 @@ type WorkerPool struct {
 	cancel     context.CancelFunc
 	closed     bool
 	mu         sync.Mutex
+	inFlight   atomic.Int64 // задачи, которые обрабатываются прямо сейчас
+	breaker    *Breaker
+	client     *http.Client
+
+	stateMu    sync.Mutex
+	resumed    chan struct{}        // закрыт, пока пул не на паузе
+	queued     map[string]time.Time // номера заказов в очереди и время постановки
+	processing map[string]time.Time // номера заказов в обработке и время начала
+}
+
+// TaskInfo — заказ в очереди или в обработке
+type TaskInfo struct {
+	Order string    `json:"order"`
+	Since time.Time `json:"since"`
+}
+
+// PoolStatus — состояние пула для диагностики
+type PoolStatus struct {
+	Paused        bool         `json:"paused"`
+	Workers       int          `json:"workers"`
+	QueueLength   int          `json:"queue_length"`
+	QueueCapacity int          `json:"queue_capacity"`
+	InFlight      int          `json:"in_flight"`
+	Circuit       CircuitState `json:"circuit"`
+	Queued        []TaskInfo   `json:"queued"`
+	Processing    []TaskInfo   `json:"processing"`
 }
 
 func NewWorkerPool(ctx context.Context, maxWorkers int) *WorkerPool {
 	ctx, cancel := context.WithCancel(ctx)
+	resumed := make(chan struct{})
+	close(resumed)
 	return &WorkerPool{
 		tasks:      make(chan Task, 100),
 		maxWorkers: maxWorkers,
 		ctx:        ctx,
 		cancel:     cancel,
+		breaker:    NewBreaker(BreakerThreshold, BreakerCooldown),
+		client:     &http.Client{Timeout: 30 * time.Second},
+		resumed:    resumed,
+		queued:     make(map[string]time.Time),
+		processing: make(map[string]time.Time),
 	}
 }
 
+// SetTLSConfig задает TLS-настройки соединений с системой расчета; вызывается до Start
+func (wp *WorkerPool) SetTLSConfig(cfg *tls.Config) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	wp.client = &http.Client{Timeout: 30 * time.Second, Transport: transport}
+}
+
 func (wp *WorkerPool) Start() {
 	for i := 0; i < wp.maxWorkers; i++ {
 		go wp.worker()
@@ -92,26 +140,64 @@ func (wp *WorkerPool) AddTask(task Task) {
 		return
 	}
 
+	// Заказ, который уже в очереди или в обработке, повторно не ставится: результат придет и так
+	wp.stateMu.Lock()
+	_, queued := wp.queued[task.OrderNumber]
+	_, processing := wp.processing[task.OrderNumber]
+	if queued || processing {
+		wp.stateMu.Unlock()
+		logging.Logg.Debug("Task not added: order already queued", "order", task.OrderNumber)
+		return
+	}
+	wp.queued[task.OrderNumber] = time.Now()
+	wp.stateMu.Unlock()
+
 	wp.wg.Add(1)
 	select {
 	case wp.tasks <- task:
 	case <-wp.ctx.Done():
 		wp.wg.Done()
+		wp.dropQueued(task.OrderNumber)
 		logging.Logg.Warn("Task not added: context canceled")
 	}
 }
 
 func (wp *WorkerPool) worker() {
 	for {
+		// На паузе задачи остаются в очереди до возобновления
+		select {
+		case <-wp.resumedChan():
+		case <-wp.ctx.Done():
+			return
+		}
+
 		select {
 		case task, ok := <-wp.tasks:
 			if !ok {
 				return
 			}
+			// Пауза могла начаться, пока обработчик ждал задачу: задача придерживается до возобновления
+			select {
+			case <-wp.resumedChan():
+			case <-wp.ctx.Done():
+				wp.dropQueued(task.OrderNumber)
+				return
+			}
 			wp.wg.Add(1)
+			wp.startProcessing(task.OrderNumber)
 			go func(t Task) {
 				defer wp.wg.Done()
-				if err := wp.processTask(t); err != nil {
+				wp.inFlight.Add(1)
+				defer wp.inFlight.Add(-1)
+				defer wp.finishProcessing(t.OrderNumber)
+
+				ctx, span := trace.Start(wp.ctx, "accrual.process")
+				span.SetAttr("order", t.OrderNumber)
+				err := wp.processTask(ctx, t)
+				span.RecordError(err)
+				span.Finish()
+				metrics.WorkerTasks.With(taskOutcome(err)).Inc()
+				if err != nil {
 					t.ErrorChan <- err
 				}
 			}(task)
@@ -122,9 +208,9 @@ func (wp *WorkerPool) worker() {
 	}
 }
 
-func (wp *WorkerPool) processTask(task Task) error {
+func (wp *WorkerPool) processTask(ctx context.Context, task Task) error {
 	url := fmt.Sprintf("%s/api/orders/%s", task.BaseURL, task.OrderNumber)
-	logging.Logg.Info("Processing task", "url", url)
+	logging.Logg.InfoContext(ctx, "Processing task", "url", url)
 
 	var lastErr error
 	for i := 0; i < 3; i++ {
@@ -135,7 +221,7 @@ func (wp *WorkerPool) processTask(task Task) error {
 		default:
 		}
 
-		err := wp.attemptRequest(task, url)
+		err := wp.attemptRequest(ctx, task, url, i+1)
 		if err == nil {
 			return nil
 		}
@@ -143,12 +229,20 @@ func (wp *WorkerPool) processTask(task Task) error {
 		lastErr = err
 		time.Sleep((1 << i) * time.Second)
 	}
-	logging.Logg.Warn("All retry attempts failed", "error", lastErr)
+	logging.Logg.WarnContext(ctx, "All retry attempts failed", "error", lastErr)
 	return fmt.Errorf("failed after retries: %w", lastErr)
 }
 
-func (wp *WorkerPool) attemptRequest(task Task, url string) error {
-	ctxWithTimeout, cancel := context.WithTimeout(wp.ctx, 5*time.Second)
+func (wp *WorkerPool) attemptRequest(ctx context.Context, task Task, url string, attempt int) (err error) {
+	ctx, span := trace.Start(ctx, "accrual.request")
+	span.SetAttr("http.url", url)
+	span.SetAttr("attempt", attempt)
+	defer func() {
+		span.RecordError(err)
+		span.Finish()
+	}()
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctxWithTimeout, http.MethodGet, url, nil)
@@ -157,21 +251,36 @@ func (wp *WorkerPool) attemptRequest(task Task, url string) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	if !wp.breaker.Allow() {
+		return ErrCircuitOpen
+	}
+	req.Header.Set("traceparent", span.Context.Traceparent())
+
+	start := time.Now()
+	resp, err := wp.client.Do(req)
+	metrics.AccrualDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
+		wp.breaker.Failure()
+		metrics.AccrualRequests.With("error").Inc()
 		logging.Logg.Error("Failed to send request", "error", err)
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
+	metrics.AccrualRequests.With(strconv.Itoa(resp.StatusCode)).Inc()
+	span.SetAttr("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		wp.breaker.Failure()
+	} else {
+		wp.breaker.Success()
+	}
 
-	return wp.handleResponse(task, resp)
+	return wp.handleResponse(ctx, task, resp)
 }
 
-func (wp *WorkerPool) handleResponse(task Task, resp *http.Response) error {
+func (wp *WorkerPool) handleResponse(ctx context.Context, task Task, resp *http.Response) error {
 	switch resp.StatusCode {
 	case http.StatusOK:
-		return wp.handleSuccessResponse(task, resp)
+		return wp.handleSuccessResponse(ctx, task, resp)
 
 	case http.StatusNoContent:
 		logging.Logg.Info("Order not registered in loyalty system")
@@ -190,13 +299,16 @@ func (wp *WorkerPool) handleResponse(task Task, resp *http.Response) error {
 	}
 }
 
-func (wp *WorkerPool) handleSuccessResponse(task Task, resp *http.Response) error {
+func (wp *WorkerPool) handleSuccessResponse(ctx context.Context, task Task, resp *http.Response) error {
 	var accrualResponse Accrual
 	err := json.NewDecoder(resp.Body).Decode(&accrualResponse)
 	if err != nil {
-		logging.Logg.Error("Failed to decode response", "error", err)
+		logging.Logg.ErrorContext(ctx, "Failed to decode response", "error", err)
 		return fmt.Errorf("failed to decode response: %w", err)
 	}
+	if span := trace.SpanFromContext(ctx); span != nil {
+		accrualResponse.Trace = span.Context
+	}
 
 	select {
 	case <-wp.ctx.Done():
@@ -237,6 +349,119 @@ func parseRetryAfter(retryAfter string) time.Duration {
 	return 1 * time.Second
 }
 
+func (wp *WorkerPool) startProcessing(orderNumber string) {
+	wp.stateMu.Lock()
+	defer wp.stateMu.Unlock()
+	delete(wp.queued, orderNumber)
+	wp.processing[orderNumber] = time.Now()
+}
+
+func (wp *WorkerPool) dropQueued(orderNumber string) {
+	wp.stateMu.Lock()
+	defer wp.stateMu.Unlock()
+	delete(wp.queued, orderNumber)
+}
+
+func (wp *WorkerPool) finishProcessing(orderNumber string) {
+	wp.stateMu.Lock()
+	defer wp.stateMu.Unlock()
+	delete(wp.processing, orderNumber)
+}
+
+func (wp *WorkerPool) resumedChan() chan struct{} {
+	wp.stateMu.Lock()
+	defer wp.stateMu.Unlock()
+	return wp.resumed
+}
+
+// Pause приостанавливает выдачу задач обработчикам; уже начатые задачи завершаются
+func (wp *WorkerPool) Pause() {
+	wp.stateMu.Lock()
+	defer wp.stateMu.Unlock()
+	select {
+	case <-wp.resumed:
+		wp.resumed = make(chan struct{})
+		logging.Logg.Info("Worker pool paused")
+	default:
+	}
+}
+
+// Resume возобновляет обработку задач после Pause
+func (wp *WorkerPool) Resume() {
+	wp.stateMu.Lock()
+	defer wp.stateMu.Unlock()
+	select {
+	case <-wp.resumed:
+	default:
+		close(wp.resumed)
+		logging.Logg.Info("Worker pool resumed")
+	}
+}
+
+// Paused сообщает, что пул на паузе
+func (wp *WorkerPool) Paused() bool {
+	select {
+	case <-wp.resumedChan():
+		return false
+	default:
+		return true
+	}
+}
+
+// Status возвращает состояние пула: очередь, задачи в обработке и состояние цепи
+func (wp *WorkerPool) Status() PoolStatus {
+	status := PoolStatus{
+		Paused:        wp.Paused(),
+		Workers:       wp.maxWorkers,
+		QueueLength:   len(wp.tasks),
+		QueueCapacity: cap(wp.tasks),
+		InFlight:      wp.InFlight(),
+		Circuit:       wp.CircuitState(),
+	}
+
+	wp.stateMu.Lock()
+	defer wp.stateMu.Unlock()
+	status.Queued = taskInfos(wp.queued)
+	status.Processing = taskInfos(wp.processing)
+	return status
+}
+
+func taskInfos(m map[string]time.Time) []TaskInfo {
+	infos := make([]TaskInfo, 0, len(m))
+	for order, since := range m {
+		infos = append(infos, TaskInfo{Order: order, Since: since})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Since.Before(infos[j].Since) })
+	return infos
+}
+
+// CircuitState возвращает состояние автомата защиты обращений к системе расчета
+func (wp *WorkerPool) CircuitState() CircuitState {
+	return wp.breaker.State()
+}
+
+// QueueLength возвращает число задач, ожидающих свободного обработчика
+func (wp *WorkerPool) QueueLength() int {
+	return len(wp.tasks)
+}
+
+// InFlight возвращает число задач, которые обрабатываются прямо сейчас
+func (wp *WorkerPool) InFlight() int {
+	return int(wp.inFlight.Load())
+}
+
+func taskOutcome(err error) string {
+	switch {
+	case err == nil:
+		return metrics.OutcomeSuccess
+	case errors.Is(err, ErrOrderNotRegistered):
+		return metrics.OutcomeNotRegistered
+	case errors.Is(err, context.Canceled):
+		return metrics.OutcomeCanceled
+	}
+	return metrics.OutcomeFailed
+}
+
 func (wp *WorkerPool) Wait() {
 	wp.wg.Wait()
 }
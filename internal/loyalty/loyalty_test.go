@@ -0,0 +1,122 @@
+package loyalty
+
+import (
+	"context"
+	"encoding/json"
+	"gopher-market/internal/logging"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	logging.Logg = logging.NewLogger("error", "text", "text", "console", "")
+	os.Exit(m.Run())
+}
+
+// newAccrualServer отвечает на запросы расчета статусом PROCESSED и считает обращения
+func newAccrualServer(t *testing.T, requests *atomic.Int64) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		order := strings.TrimPrefix(r.URL.Path, "/api/orders/")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Accrual{Order: order, Status: "PROCESSED", Accrual: 100})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestPool(t *testing.T, workers int) *WorkerPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	pool := NewWorkerPool(ctx, workers)
+	pool.Start()
+	return pool
+}
+
+func TestPauseResume(t *testing.T) {
+	var requests atomic.Int64
+	srv := newAccrualServer(t, &requests)
+	pool := newTestPool(t, 1)
+	results := make(chan *Accrual, 1)
+	errs := make(chan error, 1)
+
+	// Обработчик уже ждет задачу, когда пул ставится на паузу
+	time.Sleep(50 * time.Millisecond)
+	pool.Pause()
+	if !pool.Paused() {
+		t.Fatal("Expected pool to be paused")
+	}
+	pool.AddTask(Task{BaseURL: srv.URL, OrderNumber: "12345678903", ResultChan: results, ErrorChan: errs})
+
+	select {
+	case res := <-results:
+		t.Fatalf("Task processed while paused: %+v", res)
+	case err := <-errs:
+		t.Fatalf("Task processed while paused: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if n := requests.Load(); n != 0 {
+		t.Fatalf("Expected no accrual requests while paused, got %d", n)
+	}
+	if status := pool.Status(); len(status.Queued) != 1 || len(status.Processing) != 0 {
+		t.Fatalf("Expected task to stay queued, got %+v", status)
+	}
+
+	pool.Resume()
+	select {
+	case res := <-results:
+		if res.Order != "12345678903" || res.Status != "PROCESSED" {
+			t.Errorf("Unexpected result %+v", res)
+		}
+	case err := <-errs:
+		t.Fatalf("Unexpected error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Task not processed after resume")
+	}
+	if pool.Paused() {
+		t.Error("Expected pool to be resumed")
+	}
+}
+
+func TestAddTaskDeduplicates(t *testing.T) {
+	var requests atomic.Int64
+	srv := newAccrualServer(t, &requests)
+	pool := newTestPool(t, 1)
+	results := make(chan *Accrual, 2)
+	errs := make(chan error, 2)
+
+	pool.Pause()
+	for _, order := range []string{"12345678903", "12345678903", "9278923470"} {
+		pool.AddTask(Task{BaseURL: srv.URL, OrderNumber: order, ResultChan: results, ErrorChan: errs})
+	}
+	if status := pool.Status(); len(status.Queued) != 2 {
+		t.Fatalf("Expected 2 queued orders, got %+v", status.Queued)
+	}
+
+	pool.Resume()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-results:
+		case err := <-errs:
+			t.Fatalf("Unexpected error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Tasks not processed")
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for status := pool.Status(); len(status.Queued)+len(status.Processing) > 0; status = pool.Status() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected no tracked tasks, got %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("Expected 2 accrual requests, got %d", n)
+	}
+}
@@ -1,7 +1,11 @@
 package loyalty
 
+import "gopher-market/internal/trace"
+
 type Accrual struct {
 	Order   string  `json:"order"`
 	Status  string  `json:"status"`
 	Accrual float32 `json:"accrual"`
+
+	Trace trace.SpanContext `json:"-"` // спан опроса, чтобы обработка ответа продолжила ту же трассу
 }
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"database/sql"
+)
+
+// Метрики HTTP-сервера
+var (
+	HTTPRequests = Default.Counter("gophermart_http_requests_total",
+		"Total HTTP requests by method, route and status code.", "method", "route", "code")
+	HTTPDuration = Default.Histogram("gophermart_http_request_duration_seconds",
+		"HTTP request latency by method and route.", DefaultBuckets, "method", "route")
+	HTTPInFlight = Default.Gauge("gophermart_http_requests_in_flight",
+		"HTTP requests currently being served.").With()
+)
+
+// Метрики обращений к системе расчета начислений
+var (
+	AccrualRequests = Default.Counter("gophermart_accrual_requests_total",
+		"Requests to the accrual system by response status code, \"error\" for transport failures.", "code")
+	AccrualDuration = Default.Histogram("gophermart_accrual_request_duration_seconds",
+		"Accrual system request latency.", DefaultBuckets)
+	WorkerTasks = Default.Counter("gophermart_worker_tasks_total",
+		"Accrual tasks finished by the worker pool by outcome.", "outcome")
+)
+
+// Бизнес-метрики
+var (
+	PointsAccrued = Default.Counter("gophermart_points_accrued_total",
+		"Points accrued for processed orders, including bonuses.").With()
+	PointsWithdrawn = Default.Counter("gophermart_points_withdrawn_total",
+		"Points withdrawn, including captured holds.").With()
+	OrdersUploaded = Default.Counter("gophermart_orders_uploaded_total",
+		"Orders accepted for accrual processing.").With()
+)
+
+// итоги задач пула обработчиков
+const (
+	OutcomeSuccess       = "success"
+	OutcomeNotRegistered = "not_registered"
+	OutcomeFailed        = "failed"
+	OutcomeCanceled      = "canceled"
+)
+
+// RegisterDBStats публикует статистику пула соединений с базой данных
+func RegisterDBStats(db *sql.DB) {
+	Default.GaugeFunc("gophermart_db_open_connections", "Established database connections, in use and idle.",
+		func() float64 { return float64(db.Stats().OpenConnections) })
+	Default.GaugeFunc("gophermart_db_in_use_connections", "Database connections currently in use.",
+		func() float64 { return float64(db.Stats().InUse) })
+	Default.GaugeFunc("gophermart_db_idle_connections", "Idle database connections.",
+		func() float64 { return float64(db.Stats().Idle) })
+	Default.GaugeFunc("gophermart_db_max_open_connections", "Maximum number of open database connections.",
+		func() float64 { return float64(db.Stats().MaxOpenConnections) })
+	Default.CounterFunc("gophermart_db_wait_count_total", "Total connections waited for.",
+		func() float64 { return float64(db.Stats().WaitCount) })
+	Default.CounterFunc("gophermart_db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.",
+		func() float64 { return db.Stats().WaitDuration.Seconds() })
+}
@@ -0,0 +1,289 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets — границы гистограмм длительности в секундах
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// collector выводит одну метрику вместе с заголовками HELP и TYPE
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry — набор метрик, который отдается в текстовом формате Prometheus
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default — реестр метрик приложения
+var Default = NewRegistry()
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Counter регистрирует монотонно растущий счетчик с метками labels
+func (r *Registry) Counter(name, help string, labels ...string) *Vec {
+	v := newVec(name, help, "counter", labels)
+	r.register(v)
+	return v
+}
+
+// Gauge регистрирует значение, которое может как расти, так и уменьшаться
+func (r *Registry) Gauge(name, help string, labels ...string) *Vec {
+	v := newVec(name, help, "gauge", labels)
+	r.register(v)
+	return v
+}
+
+// GaugeFunc регистрирует значение, которое вычисляется при каждом запросе метрик
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	r.register(&funcMetric{name: name, help: help, typ: "gauge", f: f})
+}
+
+// CounterFunc регистрирует счетчик, который ведется вне реестра и читается при каждом запросе метрик
+func (r *Registry) CounterFunc(name, help string, f func() float64) {
+	r.register(&funcMetric{name: name, help: help, typ: "counter", f: f})
+}
+
+// Histogram регистрирует гистограмму с границами buckets
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*histogram),
+	}
+	r.register(h)
+	return h
+}
+
+// WriteText выводит все метрики в текстовом формате Prometheus
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler отдает метрики реестра
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// Vec — счетчик или значение с набором меток
+type Vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64
+}
+
+func newVec(name, help, typ string, labels []string) *Vec {
+	return &Vec{name: name, help: help, typ: typ, labels: labels, series: make(map[string]*series)}
+}
+
+// Metric — значение для конкретного набора меток
+type Metric struct {
+	vec *Vec
+	s   *series
+}
+
+// With возвращает значение для меток values, перечисленных в том же порядке, что и при регистрации
+func (v *Vec) With(values ...string) Metric {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: values}
+		v.series[key] = s
+	}
+	return Metric{vec: v, s: s}
+}
+
+// Add увеличивает значение на delta
+func (m Metric) Add(delta float64) {
+	m.vec.mu.Lock()
+	m.s.value += delta
+	m.vec.mu.Unlock()
+}
+
+func (m Metric) Inc() { m.Add(1) }
+func (m Metric) Dec() { m.Add(-1) }
+
+// Set задает значение; для счетчиков не используется
+func (m Metric) Set(value float64) {
+	m.vec.mu.Lock()
+	m.s.value = value
+	m.vec.mu.Unlock()
+}
+
+func (v *Vec) write(w *bufio.Writer) {
+	writeHeader(w, v.name, v.help, v.typ)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range sortedKeys(v.series) {
+		s := v.series[key]
+		writeSample(w, v.name, formatLabels(v.labels, s.values, "", ""), s.value)
+	}
+}
+
+type funcMetric struct {
+	name string
+	help string
+	typ  string
+	f    func() float64
+}
+
+func (m *funcMetric) write(w *bufio.Writer) {
+	writeHeader(w, m.name, m.help, m.typ)
+	writeSample(w, m.name, "", m.f())
+}
+
+// HistogramVec — гистограмма с набором меток
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	values []string
+	counts []uint64 // число наблюдений в каждом интервале, без накопления
+	count  uint64
+	sum    float64
+}
+
+// Observe учитывает наблюдение value для меток values
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	if len(values) != len(h.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", h.name, len(h.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{values: values, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			writeSample(w, h.name+"_bucket", formatLabels(h.labels, s.values, "le", formatFloat(bound)), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", formatLabels(h.labels, s.values, "le", "+Inf"), float64(s.count))
+		writeSample(w, h.name+"_sum", formatLabels(h.labels, s.values, "", ""), s.sum)
+		writeSample(w, h.name+"_count", formatLabels(h.labels, s.values, "", ""), float64(s.count))
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help), name, typ)
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(value))
+}
+
+// formatLabels собирает метки в виде {a="1",b="2"}; extraName добавляет служебную метку, например le
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	escape := strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, name, escape.Replace(values[i]))
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, extraName, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
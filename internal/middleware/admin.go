@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"gopher-market/internal/config"
+	"gopher-market/internal/logging"
+	"net/http"
+)
+
+const (
+	AdminTokenHeader   = "X-Admin-Token"
+	PartnerTokenHeader = "X-Partner-Token"
+)
+
+// AdminMiddleware пропускает только запросы с токеном администратора из конфигурации.
+// Если токен не задан, административный API недоступен.
+func AdminMiddleware(cfg *config.Config) func(next http.Handler) http.Handler {
+	return tokenMiddleware(AdminTokenHeader, cfg.AdminToken, "Admin")
+}
+
+// PartnerMiddleware пропускает только запросы партнерской интеграции с токеном из конфигурации
+func PartnerMiddleware(cfg *config.Config) func(next http.Handler) http.Handler {
+	return tokenMiddleware(PartnerTokenHeader, cfg.PartnerToken, "Partner")
+}
+
+func tokenMiddleware(header, expected, name string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if expected == "" {
+				http.Error(w, name+" API is disabled", http.StatusNotFound)
+				return
+			}
+
+			token := r.Header.Get(header)
+			if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+				logging.Logg.Warn("Invalid API token", "api", name, "remote_addr", r.RemoteAddr)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientCertMiddleware требует проверенный клиентский сертификат, если в конфигурации задан
+// удостоверяющий центр клиентов. Без него маршруты защищены только токеном.
+func ClientCertMiddleware(cfg *config.Config) func(next http.Handler) http.Handler {
+	required := cfg.TLSClientCAFile != ""
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if required && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+				logging.Logg.Warn("Client certificate required", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+				http.Error(w, "Client certificate required", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
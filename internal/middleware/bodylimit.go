@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	// DefaultBodyLimit — предел тела запроса для маршрутов без собственного ограничения
+	DefaultBodyLimit = 1 << 20
+	// SmallBodyLimit — предел для маршрутов с короткими JSON-телами: регистрация, вход, списание
+	SmallBodyLimit = 4 << 10
+)
+
+// BodyLimitMiddleware ограничивает размер тела запроса limit байтами. Запрос с большим Content-Length
+// отклоняется сразу; тело без длины обрывается при чтении с *http.MaxBytesError.
+// Вложенные ограничения складываются: действует наименьшее.
+func BodyLimitMiddleware(limit int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				http.Error(w, "Request body too large, max "+strconv.FormatInt(limit, 10)+" bytes", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -3,9 +3,13 @@ package middleware
 import (
 	"bytes"
 	"gopher-market/internal/logging"
+	"gopher-market/internal/metrics"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/go-chi/chi"
 )
 
 // responseWriterWrapper — это обертка для ResponseWriter, которая записывает HTTP-статус
@@ -20,6 +24,27 @@ func (rw *responseWriterWrapper) WriteHeader(statusCode int) {
 	rw.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Flush пробрасывает Flush исходному ResponseWriter, если он его поддерживает
+func (rw *responseWriterWrapper) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap позволяет http.ResponseController добраться до исходного ResponseWriter
+func (rw *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// maxLoggedBody — сколько байт тела запроса попадает в лог
+const maxLoggedBody = 2 << 10
+
+// replayBody отдает прочитанное для лога начало тела, затем остаток исходного потока
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
 // LoggingMiddleware логирование HTTP-запросов
 func LoggingMiddleware(logger *logging.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -40,30 +65,41 @@ func LoggingMiddleware(logger *logging.Logger) func(http.Handler) http.Handler {
 				username = "unknown" // Если username отсутствует, используем "unknown"
 			}
 
-			// Чтение тела запроса
+			// Для лога читаем только начало тела, остальное обработчик дочитает из исходного потока
 			var bodyBytes []byte
+			truncated := false
 			if r.Body != nil {
-				bodyBytes, _ = io.ReadAll(r.Body)
+				bodyBytes, _ = io.ReadAll(io.LimitReader(r.Body, maxLoggedBody+1))
+				if len(bodyBytes) > maxLoggedBody {
+					truncated = true
+				}
 				// Восстанавливаем тело запроса, чтобы оно могло быть использовано дальше
-				r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+				r.Body = replayBody{Reader: io.MultiReader(bytes.NewReader(bodyBytes), r.Body), Closer: r.Body}
+			}
+			if truncated {
+				bodyBytes = bodyBytes[:maxLoggedBody]
 			}
 
 			maskedBody := logging.MaskSensitiveData(string(bodyBytes))
 
-			logger.Info("incoming request",
+			logger.InfoContext(r.Context(), "incoming request",
 				"username", username,
 				"method", r.Method,
 				"url", r.URL.String(),
 				"remote_addr", r.RemoteAddr,
 				"body", maskedBody, // Логируем тело запроса
+				"body_truncated", truncated,
 			)
 
 			rww := &responseWriterWrapper{ResponseWriter: w}
 
+			metrics.HTTPInFlight.Inc()
 			next.ServeHTTP(rww, r)
+			metrics.HTTPInFlight.Dec()
 
 			duration := time.Since(start)
-			logger.Info("request completed",
+			observeRequest(r, rww.statusCode, duration)
+			logger.InfoContext(r.Context(), "request completed",
 				"username", username,
 				"method", r.Method,
 				"url", r.URL.String(),
@@ -73,3 +109,17 @@ func LoggingMiddleware(logger *logging.Logger) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// observeRequest учитывает запрос в метриках. Маршрут берется из шаблона chi, а не из URL,
+// чтобы номера заказов и идентификаторы не порождали отдельные серии.
+func observeRequest(r *http.Request, statusCode int, duration time.Duration) {
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	route := "unmatched"
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		route = rctx.RoutePattern()
+	}
+	metrics.HTTPRequests.With(r.Method, route, strconv.Itoa(statusCode)).Inc()
+	metrics.HTTPDuration.Observe(duration.Seconds(), r.Method, route)
+}
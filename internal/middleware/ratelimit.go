@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"gopher-market/internal/logging"
+	"gopher-market/internal/ratelimit"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimitMiddleware ограничивает частоту запросов по правилам limiter. Запросы аутентифицированного
+// пользователя учитываются по его логину, остальные — по IP-адресу клиента, поэтому для
+// пользовательских маршрутов middleware подключается после AuthMiddleware.
+// Если хранилище корзин недоступно, запрос пропускается.
+func RateLimitMiddleware(limiter *ratelimit.Limiter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := rateLimitClient(r)
+			res, matched, err := limiter.Allow(r.Method, r.URL.Path, client)
+			if err != nil {
+				logging.Logg.Error("Rate limit check failed", "client", client, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !matched {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit.Burst))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+			h.Set("RateLimit-Policy", strconv.Itoa(res.Limit.Burst)+";w="+strconv.Itoa(ceilSeconds(res.Limit.Window())))
+
+			if !res.Allowed {
+				logging.Logg.Warn("Rate limit exceeded", "client", client, "method", r.Method, "url", r.URL.Path)
+				h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitClient возвращает ключ клиента: логин пользователя или IP-адрес
+func rateLimitClient(r *http.Request) string {
+	if username, ok := r.Context().Value(UserContextKey).(string); ok {
+		return "user:" + username
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ceilSeconds округляет длительность вверх до целых секунд, как того требуют заголовки
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"fmt"
+	"gopher-market/internal/trace"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	RequestIDHeader   = "X-Request-ID"
+	TraceparentHeader = "traceparent"
+)
+
+// TraceMiddleware присваивает запросу идентификатор и открывает серверный спан вокруг обработчика.
+// Идентификатор запроса берется из X-Request-ID клиента, трасса продолжается из traceparent;
+// оба значения возвращаются клиенту в заголовках ответа.
+func TraceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, err := trace.ParseTraceparent(r.Header.Get(TraceparentHeader)); err == nil {
+			ctx = trace.ContextWithRemote(ctx, sc)
+		}
+		ctx, span := trace.Start(ctx, r.Method+" "+r.URL.Path)
+		defer span.Finish()
+
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = trace.NewRequestID()
+		}
+		ctx = trace.ContextWithRequestID(ctx, requestID)
+
+		w.Header().Set(RequestIDHeader, requestID)
+		w.Header().Set(TraceparentHeader, span.Context.Traceparent())
+		span.SetAttr("request_id", requestID)
+		span.SetAttr("http.method", r.Method)
+		span.SetAttr("http.target", r.URL.Path)
+
+		rww := &responseWriterWrapper{ResponseWriter: w}
+		next.ServeHTTP(rww, r.WithContext(ctx))
+
+		statusCode := rww.statusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		span.SetAttr("http.status_code", statusCode)
+		if statusCode >= http.StatusInternalServerError {
+			span.RecordError(fmt.Errorf("HTTP %d", statusCode))
+		}
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+		}
+	})
+}
+
+// validRequestID пропускает только короткие идентификаторы из безопасных символов, чтобы
+// клиент не мог подставить в логи и заголовки произвольные данные
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -1,12 +1,38 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
 
 type User struct {
 	ID           int     `json:"user_id,omitempty"`         //  уникальный идентификатор пользователя
 	Username     string  `json:"login,omitempty"`           // имя пользователя
 	PasswordHash string  `json:"password_hash,omitempty"`   // хэш пароля пользователя
 	Balance      float32 `json:"current_balance,omitempty"` // текущий баланс пользователя
+	Tier         string  `json:"tier,omitempty"`            // уровень программы лояльности, пустой — базовый
+}
+
+type Tier struct {
+	Name       string  `json:"name"`       // название уровня
+	Threshold  float32 `json:"threshold"`  // сумма начислений за скользящее окно, с которой присваивается уровень
+	Multiplier float32 `json:"multiplier"` // множитель начисления от системы расчёта
+	Bonus      float32 `json:"bonus"`      // фиксированный бонус за каждый начисленный заказ
+}
+
+type TierChange struct {
+	From      string    `json:"from"`       // прежний уровень
+	To        string    `json:"to"`         // новый уровень
+	Points    float32   `json:"points"`     // сумма начислений за окно на момент пересчета
+	ChangedAt time.Time `json:"changed_at"` // время смены уровня time.RFC3339
+}
+
+// Bonus — дополнительное начисление за заказ сверх вознаграждения системы расчёта
+type Bonus struct {
+	Type   TType   // тип транзакции бонуса
+	Amount float32 // сумма бонуса
 }
 
 type Status string
@@ -20,27 +46,321 @@ const (
 )
 
 type Order struct {
-	ID          int       `json:"id,omitempty"`          //  уникальный идентификатор заказа
-	UserID      int       `json:"user_id,omitempty"`     // уникальный идентификатор пользователя
-	OrderNumber string    `json:"number,omitempty"`      // номер заказа
-	Accrual     float32   `json:"accrual,omitempty"`     // вознаграждение за заказ
-	UploadedAt  time.Time `json:"uploaded_at,omitempty"` // время загрузки номера заказа time.RFC3339
-	Status      Status    `json:"status,omitempty"`      // статус обработки заказа
+	ID          int        `json:"id,omitempty"`          //  уникальный идентификатор заказа
+	UserID      int        `json:"user_id,omitempty"`     // уникальный идентификатор пользователя
+	OrderNumber string     `json:"number,omitempty"`      // номер заказа
+	Accrual     float32    `json:"accrual,omitempty"`     // вознаграждение за заказ
+	UploadedAt  time.Time  `json:"uploaded_at,omitempty"` // время загрузки номера заказа time.RFC3339
+	Status      Status     `json:"status,omitempty"`      // статус обработки заказа
+	ProcessedAt *time.Time `json:"-"`                     // время перехода в финальный статус
 }
 
 type TType string // тип транзакции
 
 const (
-	Accrual  TType = "accrual"  // пополнение
-	Withdraw TType = "withdraw" // снятие
+	Accrual       TType = "accrual"        // пополнение
+	Withdraw      TType = "withdraw"       // снятие
+	Expire        TType = "expire"         // сгорание баллов по истечении срока
+	TierBonus     TType = "tier_bonus"     // надбавка за уровень программы лояльности
+	TransferOut   TType = "transfer_out"   // перевод баллов другому пользователю
+	TransferIn    TType = "transfer_in"    // получение перевода или возврат отклоненного перевода
+	Reversal      TType = "reversal"       // возврат отмененного списания
+	Adjustment    TType = "adjustment"     // доначисление после пересмотра вознаграждения системой расчёта
+	Clawback      TType = "clawback"       // возврат излишне начисленного после пересмотра вознаграждения
+	CampaignBonus TType = "campaign_bonus" // бонус маркетинговой акции
+	ReferralBonus TType = "referral_bonus" // вознаграждение за приглашение пользователя
 )
 
+// DebitTypes — типы транзакций, уменьшающих баланс
+var DebitTypes = []TType{Withdraw, Expire, TransferOut, Clawback}
+
+// IsDebit сообщает, уменьшает ли транзакция этого типа баланс. Сумма транзакции всегда хранится положительной.
+func (t TType) IsDebit() bool {
+	return slices.Contains(DebitTypes, t)
+}
+
 type Transaction struct {
-	ID               int       `json:"id,omitempty"`                //  уникальный идентификатор транзакции
-	UserID           string    `json:"user_id,omitempty"`           // уникальный идентификатор пользователя
-	OrderNumber      string    `json:"order,omitempty"`             // номер заказа
-	Amount           float32   `json:"sum,omitempty"`               // сумма транзакции,  либо начисление (положительная, accrual), либо изъятие (отрицательная, withdrawn)
-	TransactionsType TType     `json:"transactions_type,omitempty"` // тип транзакции
-	UpdatedAt        time.Time `json:"processed_at,omitempty"`      // дата последнего обновления баланса time.RFC3339
+	ID               int        `json:"id,omitempty"`                //  уникальный идентификатор транзакции
+	UserID           string     `json:"user_id,omitempty"`           // уникальный идентификатор пользователя
+	OrderNumber      string     `json:"order,omitempty"`             // номер заказа
+	Amount           float32    `json:"sum,omitempty"`               // сумма транзакции,  либо начисление (положительная, accrual), либо изъятие (отрицательная, withdrawn)
+	TransactionsType TType      `json:"transactions_type,omitempty"` // тип транзакции
+	UpdatedAt        time.Time  `json:"processed_at,omitempty"`      // дата последнего обновления баланса time.RFC3339
+	ReversedAt       *time.Time `json:"reversed_at,omitempty"`       // время отмены списания time.RFC3339
+	ReversalOf       int        `json:"reversal_of,omitempty"`       // транзакция, которую компенсирует эта
+}
+
+type OrderEvent struct {
+	ID          int       `json:"-"`                 // уникальный идентификатор события
+	OrderNumber string    `json:"-"`                 // номер заказа
+	Status      Status    `json:"status"`            // статус, полученный от системы расчёта
+	Accrual     float32   `json:"accrual,omitempty"` // вознаграждение, полученное от системы расчёта
+	CreatedAt   time.Time `json:"created_at"`        // время получения ответа time.RFC3339
+	Note        string    `json:"note,omitempty"`    // пояснение, например о корректировке начисления
+}
+
+type OrderDetails struct {
+	Order
+	History     []OrderEvent  `json:"history"`                       // история опросов системы расчёта
+	AccrualTx   *Transaction  `json:"accrual_transaction,omitempty"` // транзакция начисления за заказ
+	Withdrawals []Transaction `json:"withdrawals,omitempty"`         // списания в счёт заказа
+}
+
+type UploadStatus string // результат загрузки номера заказа в пакете
+
+const (
+	UploadAccepted  UploadStatus = "accepted"  // номер принят в обработку
+	UploadDuplicate UploadStatus = "duplicate" // номер уже был загружен этим пользователем
+	UploadConflict  UploadStatus = "conflict"  // номер уже загружен другим пользователем
+	UploadInvalid   UploadStatus = "invalid"   // неверный формат номера или не прошла проверка Луна
+	UploadBlocked   UploadStatus = "blocked"   // загрузка отклонена риск-движком
+)
+
+type OrderUploadResult struct {
+	OrderNumber string       `json:"number"`            // номер заказа
+	Status      UploadStatus `json:"status"`            // результат загрузки
+	Message     string       `json:"message,omitempty"` // пояснение к результату
+}
+
+type UserEvent struct {
+	ID        int64           `json:"id"`         // уникальный идентификатор события, используется как Last-Event-ID
+	UserID    int             `json:"-"`          // уникальный идентификатор пользователя
+	Type      string          `json:"type"`       // тип события
+	Data      json.RawMessage `json:"data"`       // содержимое события
+	CreatedAt time.Time       `json:"created_at"` // время создания события time.RFC3339
+}
+
+// события, на которые можно подписать вебхук
+const (
+	WebhookOrderProcessed = "order.processed"
+	WebhookOrderInvalid   = "order.invalid"
+	WebhookOrderAdjusted  = "order.adjusted"
+	WebhookWithdrawal     = "withdrawal.created"
+	WebhookBalanceChanged = "balance.changed"
+)
+
+// статусы доставки вебхука
+const (
+	WebhookPending    = "pending"   // ожидает отправки или повторной попытки
+	WebhookDelivered  = "delivered" // получатель ответил 2xx
+	WebhookDeadLetter = "dead"      // попытки исчерпаны
+)
+
+var WebhookEvents = []string{WebhookOrderProcessed, WebhookOrderInvalid, WebhookOrderAdjusted, WebhookWithdrawal, WebhookBalanceChanged}
+
+type WebhookEndpoint struct {
+	ID        int       `json:"id"`               // уникальный идентификатор подписки
+	URL       string    `json:"url"`              // адрес, на который отправляются события
+	Secret    string    `json:"secret,omitempty"` // ключ подписи HMAC, отдается только при создании
+	Events    []string  `json:"events"`           // типы событий подписки
+	Active    bool      `json:"active"`           // подписка включена
+	CreatedAt time.Time `json:"created_at"`       // время создания подписки time.RFC3339
+}
+
+type WebhookEvent struct {
+	ID        string    `json:"id"`         // уникальный идентификатор события, общий для всех подписок
+	Type      string    `json:"type"`       // тип события
+	CreatedAt time.Time `json:"created_at"` // время возникновения события time.RFC3339
+	Data      any       `json:"data"`       // содержимое события
+}
+
+type WebhookDelivery struct {
+	ID             int             `json:"id"`                         // уникальный идентификатор доставки
+	EndpointID     int             `json:"endpoint_id"`                // подписка, в которую доставляется событие
+	URL            string          `json:"url"`                        // адрес подписки
+	Secret         string          `json:"-"`                          // ключ подписи
+	EventType      string          `json:"event_type"`                 // тип события
+	Payload        json.RawMessage `json:"payload"`                    // тело запроса
+	Status         string          `json:"status"`                     // pending, delivered или dead
+	Attempts       int             `json:"attempts"`                   // количество выполненных попыток
+	LastError      string          `json:"last_error,omitempty"`       // ошибка последней попытки
+	LastStatusCode int             `json:"last_status_code,omitempty"` // HTTP-статус последней попытки
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`            // время следующей попытки
+	CreatedAt      time.Time       `json:"created_at"`                 // время постановки в очередь
+}
+
+type UserPoints struct {
+	UserID int     // уникальный идентификатор пользователя
+	Tier   string  // текущий уровень пользователя
+	Points float32 // сумма начислений за окно
+}
+
+type TransferStatus string
+
+const (
+	TransferPending   TransferStatus = "PENDING"   // баллы списаны у отправителя и ждут подтверждения получателя
+	TransferCompleted TransferStatus = "COMPLETED" // баллы зачислены получателю
+	TransferDeclined  TransferStatus = "DECLINED"  // получатель отказался или не ответил вовремя, баллы возвращены отправителю
+)
+
+type Transfer struct {
+	ID          int            `json:"id"`                     // уникальный идентификатор перевода
+	From        string         `json:"from"`                   // логин отправителя
+	To          string         `json:"to"`                     // логин получателя
+	Amount      float32        `json:"sum"`                    // сумма перевода
+	Status      TransferStatus `json:"status"`                 // статус перевода
+	CreatedAt   time.Time      `json:"created_at"`             // время создания time.RFC3339
+	ExpiresAt   *time.Time     `json:"expires_at,omitempty"`   // до какого времени получатель может подтвердить перевод time.RFC3339
+	CompletedAt *time.Time     `json:"completed_at,omitempty"` // время зачисления или отказа time.RFC3339
+}
+
+// Reference возвращает значение, которое записывается в order_number транзакций перевода
+func (t *Transfer) Reference() string {
+	return fmt.Sprintf("transfer-%d", t.ID)
+}
+
+type HoldStatus string
+
+const (
+	HoldActive   HoldStatus = "ACTIVE"   // баллы зарезервированы
+	HoldCaptured HoldStatus = "CAPTURED" // резерв списан в счет заказа
+	HoldReleased HoldStatus = "RELEASED" // резерв снят по запросу
+	HoldExpired  HoldStatus = "EXPIRED"  // резерв снят по истечении срока
+)
+
+type Hold struct {
+	ID          int        `json:"id"`                    // уникальный идентификатор удержания
+	OrderNumber string     `json:"order"`                 // номер заказа, под который зарезервированы баллы
+	Amount      float32    `json:"sum"`                   // зарезервированная сумма
+	Status      HoldStatus `json:"status"`                // статус удержания
+	ExpiresAt   time.Time  `json:"expires_at"`            // время автоматического снятия резерва time.RFC3339
+	CreatedAt   time.Time  `json:"created_at"`            // время создания time.RFC3339
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"` // время списания или снятия резерва time.RFC3339
+}
+
+// политика обработки возврата начисления, превышающего баланс пользователя
+const (
+	ClawbackAllow = "allow" // списать полностью, баланс может стать отрицательным
+	ClawbackClamp = "clamp" // списать не больше текущего баланса, остаток списать в убыток
+	ClawbackSkip  = "skip"  // не списывать ничего, если баланса недостаточно
+)
+
+type AccrualCorrection struct {
+	UserID     int     // владелец заказа
+	OldStatus  Status  // статус до пересмотра
+	NewStatus  Status  // статус после пересмотра
+	OldAccrual float32 // ранее начисленное вознаграждение
+	NewAccrual float32 // вознаграждение после пересмотра
+	OldBonus   float32 // ранее начисленные бонусы уровня и акций
+	NewBonus   float32 // бонусы уровня и акций после пересмотра
+	ReferrerID int     // пригласивший, чье вознаграждение отозвано при пересмотре; 0 — не затронут
+	Delta      float32 // требуемое изменение баланса
+	Applied    float32 // фактическое изменение баланса
+	WrittenOff float32 // часть возврата, не взысканная из-за политики
+}
+
+type Campaign struct {
+	ID          int       `json:"id"`                     // уникальный идентификатор акции
+	Name        string    `json:"name"`                   // название акции
+	StartsAt    time.Time `json:"starts_at"`              // начало действия time.RFC3339
+	EndsAt      time.Time `json:"ends_at"`                // окончание действия (не включительно) time.RFC3339
+	FirstOrder  bool      `json:"first_order"`            // только за первый рассчитанный заказ пользователя
+	Tiers       []string  `json:"tiers,omitempty"`        // уровни, для которых действует акция, пусто — для всех
+	OrderPrefix string    `json:"order_prefix,omitempty"` // префикс номера заказа, пусто — любой заказ
+	Multiplier  float32   `json:"multiplier"`             // множитель вознаграждения системы расчёта, 1 — без надбавки
+	FixedBonus  float32   `json:"fixed_bonus"`            // фиксированный бонус за заказ
+	Active      bool      `json:"active"`                 // выключенная акция не применяется
+	CreatedAt   time.Time `json:"created_at"`             // время создания time.RFC3339
+}
+
+// статусы приглашения
+const (
+	ReferralPending  = "PENDING"  // приглашенный еще не получил рассчитанного заказа
+	ReferralRewarded = "REWARDED" // вознаграждение начислено
+)
+
+// ReferralTerms — условия вознаграждения за приглашение
+type ReferralTerms struct {
+	ReferrerBonus float32 // бонус пригласившему
+	RefereeBonus  float32 // бонус приглашенному
+	MaxRewards    int     // сколько приглашений может вознаградить один пользователь, 0 — без ограничения
+	MinAccrual    float32 // минимальное вознаграждение за заказ, при котором приглашение засчитывается
+}
+
+// AccrualTerms — условия начисления баллов: срок жизни партий и вознаграждение за приглашение
+type AccrualTerms struct {
+	ExpireAfterMonths int           // срок жизни начисленных баллов в месяцах, 0 — баллы не сгорают
+	Referral          ReferralTerms // условия вознаграждения за приглашение
+}
+
+type Referral struct {
+	Referee    string     `json:"referee"`               // логин приглашенного
+	Status     string     `json:"status"`                // статус приглашения
+	Bonus      float32    `json:"bonus"`                 // начисленный пригласившему бонус
+	CreatedAt  time.Time  `json:"created_at"`            // время регистрации приглашенного time.RFC3339
+	RewardedAt *time.Time `json:"rewarded_at,omitempty"` // время начисления вознаграждения time.RFC3339
+}
+
+type ReferralSummary struct {
+	Code      string     `json:"code"`      // реферальный код пользователя
+	Invited   int        `json:"invited"`   // число зарегистрировавшихся по коду
+	Rewarded  int        `json:"rewarded"`  // число вознагражденных приглашений
+	Earned    float32    `json:"earned"`    // сумма бонусов за приглашения
+	Referrals []Referral `json:"referrals"` // приглашенные пользователи
+}
+
+// WithdrawalLimits — ограничения списаний, нулевое значение означает отсутствие ограничения
+type WithdrawalLimits struct {
+	MinAmount      float32 `json:"min_amount"`      // минимальная сумма одного списания
+	PerTransaction float32 `json:"per_transaction"` // максимальная сумма одного списания
+	Daily          float32 `json:"daily"`           // предельная сумма списаний за календарные сутки
+	Monthly        float32 `json:"monthly"`         // предельная сумма списаний за календарный месяц
+}
+
+// WithdrawalLimitOverride — индивидуальные ограничения пользователя, nil — действует общее ограничение
+type WithdrawalLimitOverride struct {
+	MinAmount      *float32 `json:"min_amount,omitempty"`      // минимальная сумма одного списания
+	PerTransaction *float32 `json:"per_transaction,omitempty"` // максимальная сумма одного списания
+	Daily          *float32 `json:"daily,omitempty"`           // предельная сумма за сутки
+	Monthly        *float32 `json:"monthly,omitempty"`         // предельная сумма за месяц
+}
+
+// Apply возвращает ограничения limits с учетом индивидуальных значений
+func (o *WithdrawalLimitOverride) Apply(limits WithdrawalLimits) WithdrawalLimits {
+	if o == nil {
+		return limits
+	}
+	for _, f := range []struct {
+		override *float32
+		limit    *float32
+	}{
+		{o.MinAmount, &limits.MinAmount},
+		{o.PerTransaction, &limits.PerTransaction},
+		{o.Daily, &limits.Daily},
+		{o.Monthly, &limits.Monthly},
+	} {
+		if f.override != nil {
+			*f.limit = *f.override
+		}
+	}
+	return limits
+}
+
+type UserWithdrawalLimits struct {
+	Login      string                   `json:"login"`              // пользователь
+	Limits     WithdrawalLimits         `json:"limits"`             // действующие ограничения
+	Override   *WithdrawalLimitOverride `json:"override,omitempty"` // индивидуальные ограничения
+	SpentDay   float32                  `json:"spent_day"`          // списано и удержано за текущие сутки
+	SpentMonth float32                  `json:"spent_month"`        // списано и удержано за текущий месяц
+}
+
+// статусы проверки подозрительной операции
+const (
+	ReviewOpen     = "OPEN"     // ожидает решения администратора
+	ReviewApproved = "APPROVED" // операция признана легитимной
+	ReviewRejected = "REJECTED" // операция признана мошеннической
+)
 
+type RiskReview struct {
+	ID          int        `json:"id"`                    // уникальный идентификатор проверки
+	Login       string     `json:"login"`                 // пользователь
+	Kind        string     `json:"kind"`                  // вид операции
+	OrderNumber string     `json:"order"`                 // номер заказа операции
+	Amount      float32    `json:"sum,omitempty"`         // сумма списания
+	Action      string     `json:"action"`                // решение движка: flag или block
+	Reasons     []string   `json:"reasons"`               // сработавшие правила
+	Status      string     `json:"status"`                // статус проверки
+	Note        string     `json:"note,omitempty"`        // комментарий администратора
+	CreatedAt   time.Time  `json:"created_at"`            // время операции time.RFC3339
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"` // время решения time.RFC3339
 }
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestWithdrawalLimitOverrideApply(t *testing.T) {
+	limits := WithdrawalLimits{MinAmount: 10, PerTransaction: 500, Daily: 1000, Monthly: 5000}
+
+	t.Run("Without override", func(t *testing.T) {
+		var override *WithdrawalLimitOverride
+		if got := override.Apply(limits); got != limits {
+			t.Errorf("Expected %+v, got %+v", limits, got)
+		}
+	})
+
+	t.Run("Partial override", func(t *testing.T) {
+		daily, perTransaction := float32(2000), float32(0)
+		got := (&WithdrawalLimitOverride{Daily: &daily, PerTransaction: &perTransaction}).Apply(limits)
+		want := WithdrawalLimits{MinAmount: 10, PerTransaction: 0, Daily: 2000, Monthly: 5000}
+		if got != want {
+			t.Errorf("Expected %+v, got %+v", want, got)
+		}
+	})
+
+	t.Run("Defaults stay intact", func(t *testing.T) {
+		monthly := float32(100)
+		(&WithdrawalLimitOverride{Monthly: &monthly}).Apply(limits)
+		if limits.Monthly != 5000 {
+			t.Errorf("Expected defaults to stay unchanged, got %+v", limits)
+		}
+	})
+}
@@ -0,0 +1,242 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed openapi.json
+var document []byte
+
+var (
+	ErrUndocumented = errors.New("undocumented")
+	ErrMismatch     = errors.New("does not match schema")
+)
+
+// Handler отдает OpenAPI-описание API
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write(document)
+}
+
+// Schema — подмножество JSON Schema, которое используется в описании API
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Nullable             bool               `json:"nullable"`
+	Enum                 []any              `json:"enum"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	Items                *Schema            `json:"items"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Ref     string               `json:"$ref"`
+	Content map[string]MediaType `json:"content"`
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Document — разобранное описание API
+type Document struct {
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components struct {
+		Schemas   map[string]*Schema   `json:"schemas"`
+		Responses map[string]*Response `json:"responses"`
+	} `json:"components"`
+}
+
+// Load разбирает встроенное описание API
+func Load() (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Routes возвращает описанные маршруты в виде "METHOD /path" в шаблонном виде chi
+func (d *Document) Routes() []string {
+	var routes []string
+	for path, item := range d.Paths {
+		for method := range item {
+			routes = append(routes, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// ValidateResponse проверяет, что ответ на запрос method route описан в документе: статус,
+// тип содержимого и, для JSON, тело по схеме. Свойства объектов, не описанные в схеме,
+// считаются расхождением, если схема явно не разрешает их через additionalProperties.
+func (d *Document) ValidateResponse(method, route string, status int, contentType string, body []byte) error {
+	op := d.Paths[route][strings.ToLower(method)]
+	if op == nil {
+		return fmt.Errorf("%w: %s %s", ErrUndocumented, method, route)
+	}
+	resp := op.Responses[strconv.Itoa(status)]
+	if resp == nil {
+		return fmt.Errorf("%w: %s %s status %d", ErrUndocumented, method, route, status)
+	}
+	if resp.Ref != "" {
+		resp = d.Components.Responses[strings.TrimPrefix(resp.Ref, "#/components/responses/")]
+		if resp == nil {
+			return fmt.Errorf("%w: response %s", ErrUndocumented, op.Responses[strconv.Itoa(status)].Ref)
+		}
+	}
+
+	if len(resp.Content) == 0 {
+		if len(body) != 0 {
+			return fmt.Errorf("%w: %s %s status %d must have no body", ErrMismatch, method, route, status)
+		}
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: %s %s status %d: content type %q", ErrMismatch, method, route, status, contentType)
+	}
+	media, ok := resp.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("%w: %s %s status %d: content type %s", ErrUndocumented, method, route, status, mediaType)
+	}
+	if mediaType != "application/json" || media.Schema == nil {
+		return nil
+	}
+
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Errorf("%w: %s %s status %d: invalid JSON: %v", ErrMismatch, method, route, status, err)
+	}
+	return d.validate(media.Schema, v, "body")
+}
+
+func (d *Document) resolve(s *Schema) (*Schema, error) {
+	for s.Ref != "" {
+		next := d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if next == nil {
+			return nil, fmt.Errorf("%w: schema %s", ErrUndocumented, s.Ref)
+		}
+		s = next
+	}
+	return s, nil
+}
+
+func (d *Document) validate(s *Schema, v any, at string) error {
+	s, err := d.resolve(s)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return fmt.Errorf("%w: %s must not be null", ErrMismatch, at)
+	}
+	if len(s.Enum) > 0 && !slices.Contains(s.Enum, v) {
+		return fmt.Errorf("%w: %s: %v is not one of %v", ErrMismatch, at, v, s.Enum)
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("%w: %s must be a string", ErrMismatch, at)
+		}
+	case "number", "integer":
+		n, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("%w: %s must be a number", ErrMismatch, at)
+		}
+		if s.Type == "integer" && n != math.Trunc(n) {
+			return fmt.Errorf("%w: %s must be an integer", ErrMismatch, at)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%w: %s must be a boolean", ErrMismatch, at)
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%w: %s must be an array", ErrMismatch, at)
+		}
+		for i, item := range items {
+			if err := d.validate(s.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		return d.validateObject(s, v, at)
+	default:
+		return fmt.Errorf("%w: %s: unsupported schema type %s", ErrUndocumented, at, s.Type)
+	}
+	return nil
+}
+
+func (d *Document) validateObject(s *Schema, v any, at string) error {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%w: %s must be an object", ErrMismatch, at)
+	}
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			return fmt.Errorf("%w: %s.%s is required", ErrMismatch, at, name)
+		}
+	}
+
+	// additionalProperties: отсутствует — запрещены, если описаны свойства; true — разрешены; схема — проверяются
+	var additional *Schema
+	allowAdditional := len(s.Properties) == 0
+	if len(s.AdditionalProperties) > 0 {
+		if err := json.Unmarshal(s.AdditionalProperties, &allowAdditional); err != nil {
+			additional = &Schema{}
+			if err := json.Unmarshal(s.AdditionalProperties, additional); err != nil {
+				return err
+			}
+			allowAdditional = true
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop, ok := s.Properties[name]
+		if !ok && additional != nil {
+			prop = additional
+		}
+		if prop == nil {
+			if !allowAdditional {
+				return fmt.Errorf("%w: %s.%s is not described", ErrMismatch, at, name)
+			}
+			continue
+		}
+		if err := d.validate(prop, obj[name], at+"."+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
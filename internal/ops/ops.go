@@ -0,0 +1,154 @@
+package ops
+
+import (
+	"context"
+	"encoding/json"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/loyalty"
+	"gopher-market/internal/metrics"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// Server — служебный HTTP-сервер для профилирования, метрик и управления процессом.
+// Он слушает отдельный адрес, по умолчанию только localhost, и не доступен через публичный API.
+type Server struct {
+	Serv    *http.Server
+	pool    *loyalty.WorkerPool
+	started time.Time
+}
+
+func New(addr string, pool *loyalty.WorkerPool) *Server {
+	s := &Server{pool: pool, started: time.Now()}
+
+	r := chi.NewRouter()
+	r.Get("/debug/pprof/*", pprof.Index)
+	r.Get("/debug/pprof/cmdline", pprof.Cmdline)
+	r.Get("/debug/pprof/profile", pprof.Profile)
+	r.Get("/debug/pprof/symbol", pprof.Symbol)
+	r.Post("/debug/pprof/symbol", pprof.Symbol)
+	r.Get("/debug/pprof/trace", pprof.Trace)
+
+	r.Get("/metrics", metrics.Default.Handler().ServeHTTP)
+	r.Get("/runtime", s.runtimeInfo)
+
+	r.Get("/log-level", s.getLogLevel)
+	r.Put("/log-level", s.setLogLevel)
+
+	r.Get("/workers", s.workers)
+	r.Post("/workers/pause", s.pauseWorkers)
+	r.Post("/workers/resume", s.resumeWorkers)
+
+	s.Serv = &http.Server{
+		Addr:        addr,
+		Handler:     r,
+		ReadTimeout: 15 * time.Second,
+		// профили CPU и трассы пишутся дольше обычного запроса
+		WriteTimeout: 5 * time.Minute,
+		IdleTimeout:  60 * time.Second,
+	}
+	return s
+}
+
+func (s *Server) Start() {
+	go func() {
+		logging.Logg.Info("Starting ops server", "address", s.Serv.Addr)
+		if err := s.Serv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logging.Logg.Error("Ops server failed", "error", err)
+		}
+	}()
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.Serv.Shutdown(ctx)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+type runtimeInfo struct {
+	GoVersion    string  `json:"go_version"`
+	Revision     string  `json:"revision,omitempty"`
+	Uptime       string  `json:"uptime"`
+	NumCPU       int     `json:"num_cpu"`
+	GOMAXPROCS   int     `json:"gomaxprocs"`
+	Goroutines   int     `json:"goroutines"`
+	HeapAlloc    uint64  `json:"heap_alloc_bytes"`
+	HeapObjects  uint64  `json:"heap_objects"`
+	Sys          uint64  `json:"sys_bytes"`
+	NumGC        uint32  `json:"num_gc"`
+	PauseTotalMS float64 `json:"gc_pause_total_ms"`
+	LogLevel     string  `json:"log_level"`
+}
+
+func (s *Server) runtimeInfo(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	info := runtimeInfo{
+		GoVersion:    runtime.Version(),
+		Uptime:       time.Since(s.started).Round(time.Second).String(),
+		NumCPU:       runtime.NumCPU(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    mem.HeapAlloc,
+		HeapObjects:  mem.HeapObjects,
+		Sys:          mem.Sys,
+		NumGC:        mem.NumGC,
+		PauseTotalMS: float64(mem.PauseTotalNs) / 1e6,
+		LogLevel:     logging.Logg.Level(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Revision = setting.Value
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+func (s *Server) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, logLevel{Level: logging.Logg.Level()})
+}
+
+// setLogLevel меняет уровень логирования до перезапуска процесса
+func (s *Server) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req logLevel
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := logging.Logg.SetLevel(req.Level); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logging.Logg.Warn("Log level changed", "level", req.Level, "remote_addr", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, logLevel{Level: logging.Logg.Level()})
+}
+
+func (s *Server) workers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.pool.Status())
+}
+
+func (s *Server) pauseWorkers(w http.ResponseWriter, r *http.Request) {
+	s.pool.Pause()
+	writeJSON(w, http.StatusOK, s.pool.Status())
+}
+
+func (s *Server) resumeWorkers(w http.ResponseWriter, r *http.Request) {
+	s.pool.Resume()
+	writeJSON(w, http.StatusOK, s.pool.Status())
+}
@@ -0,0 +1,99 @@
+package ops
+
+import (
+	"context"
+	"encoding/json"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/loyalty"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	logging.Logg = logging.NewLogger("error", "text", "text", "console", "")
+	os.Exit(m.Run())
+}
+
+func serve(t *testing.T, s *Server, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.Serv.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+func TestWorkers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := New("127.0.0.1:0", loyalty.NewWorkerPool(ctx, 2))
+
+	for _, tt := range []struct {
+		method, path string
+		paused       bool
+	}{
+		{http.MethodGet, "/workers", false},
+		{http.MethodPost, "/workers/pause", true},
+		{http.MethodGet, "/workers", true},
+		{http.MethodPost, "/workers/pause", true},
+		{http.MethodPost, "/workers/resume", false},
+		{http.MethodPost, "/workers/resume", false},
+	} {
+		rec := serve(t, s, tt.method, tt.path, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: expected status 200, got %d", tt.method, tt.path, rec.Code)
+		}
+		var status loyalty.PoolStatus
+		if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+			t.Fatalf("%s %s: invalid body: %v", tt.method, tt.path, err)
+		}
+		if status.Paused != tt.paused || status.Workers != 2 || status.Circuit != loyalty.CircuitClosed {
+			t.Errorf("%s %s: unexpected status %+v", tt.method, tt.path, status)
+		}
+	}
+
+	if rec := serve(t, s, http.MethodGet, "/workers/pause", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET pause to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	s := New("127.0.0.1:0", nil)
+	t.Cleanup(func() { logging.Logg.SetLevel("error") })
+
+	tests := []struct {
+		method, body string
+		status       int
+		level        string
+	}{
+		{http.MethodGet, "", http.StatusOK, "error"},
+		{http.MethodPut, `{"level":"debug"}`, http.StatusOK, "debug"},
+		{http.MethodPut, `{"level":"verbose"}`, http.StatusBadRequest, "debug"},
+		{http.MethodPut, `not json`, http.StatusBadRequest, "debug"},
+		{http.MethodGet, "", http.StatusOK, "debug"},
+	}
+	for _, tt := range tests {
+		rec := serve(t, s, tt.method, "/log-level", tt.body)
+		if rec.Code != tt.status {
+			t.Errorf("%s %q: expected status %d, got %d", tt.method, tt.body, tt.status, rec.Code)
+		}
+		if level := logging.Logg.Level(); level != tt.level {
+			t.Errorf("%s %q: expected level %s, got %s", tt.method, tt.body, tt.level, level)
+		}
+	}
+}
+
+func TestRuntimeAndMetrics(t *testing.T) {
+	s := New("127.0.0.1:0", nil)
+
+	rec := serve(t, s, http.MethodGet, "/runtime", "")
+	var info runtimeInfo
+	if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&info) != nil || info.GoVersion == "" {
+		t.Errorf("Unexpected runtime response %d %q", rec.Code, rec.Body.String())
+	}
+
+	if rec := serve(t, s, http.MethodGet, "/metrics", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected metrics on the ops listener, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,272 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSpec — рекомендуемые ограничения в формате [METHOD ]path=requests/period[,burst].
+// По умолчанию ограничения выключены и включаются явной спецификацией, например этой.
+const DefaultSpec = "POST /api/user/register=5/1m,10;" +
+	"POST /api/user/login=10/1m,20;" +
+	"POST /api/user/orders=10/1s,20;" +
+	"POST /api/user/orders/batch=1/1s,5;" +
+	"/api=50/1s,100"
+
+var ErrEmptySpec = errors.New("rate limit specification is empty")
+
+// Limit — параметры корзины токенов
+type Limit struct {
+	Rate  float64 // скорость пополнения, токенов в секунду
+	Burst int     // емкость корзины — сколько запросов можно сделать подряд
+}
+
+// Result — итог попытки взять токен
+type Result struct {
+	Limit      Limit // ограничение, по которому принято решение
+	Allowed    bool
+	Remaining  int           // сколько запросов еще можно сделать без ожидания
+	RetryAfter time.Duration // через сколько появится следующий токен, если запрос отклонен
+	Reset      time.Duration // через сколько корзина заполнится полностью
+}
+
+// Result вычисляет итог по числу токенов, оставшихся в корзине после попытки
+func (l Limit) Result(tokens float64, allowed bool) Result {
+	res := Result{
+		Limit:     l,
+		Allowed:   allowed,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     l.wait(float64(l.Burst) - tokens),
+	}
+	if !allowed {
+		res.RetryAfter = l.wait(1 - tokens)
+	}
+	return res
+}
+
+// Window возвращает время, за которое пустая корзина заполняется полностью
+func (l Limit) Window() time.Duration {
+	return l.wait(float64(l.Burst))
+}
+
+// wait возвращает время, за которое корзина пополнится на tokens токенов
+func (l Limit) wait(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.Rate * float64(time.Second))
+}
+
+// Rule — ограничение для запросов, путь которых начинается с Path
+type Rule struct {
+	Method string // пустой метод соответствует любому
+	Path   string
+	Limit  Limit
+}
+
+// Key возвращает идентификатор правила, отделяющий его корзины от корзин других правил
+func (r Rule) Key() string {
+	if r.Method == "" {
+		return r.Path
+	}
+	return r.Method + " " + r.Path
+}
+
+// matches проверяет, что запрос подпадает под правило; префикс совпадает только по границе сегмента пути
+func (r Rule) matches(method, path string) bool {
+	if r.Method != "" && r.Method != method {
+		return false
+	}
+	if !strings.HasPrefix(path, r.Path) {
+		return false
+	}
+	return len(path) == len(r.Path) || strings.HasSuffix(r.Path, "/") || path[len(r.Path)] == '/'
+}
+
+// Parse разбирает правила через точку с запятой, например "POST /api/user/orders=10/1s,20;/api=50/1s".
+// Без burst емкость корзины равна числу запросов за период.
+func Parse(spec string) ([]Rule, error) {
+	var rules []Rule
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		route, limit, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q: expected [METHOD ]path=requests/period[,burst]", part)
+		}
+
+		var rule Rule
+		fields := strings.Fields(route)
+		switch len(fields) {
+		case 1:
+			rule.Path = fields[0]
+		case 2:
+			rule.Method, rule.Path = strings.ToUpper(fields[0]), fields[1]
+		default:
+			return nil, fmt.Errorf("invalid rate limit %q: bad route %q", part, route)
+		}
+		if !strings.HasPrefix(rule.Path, "/") {
+			return nil, fmt.Errorf("invalid rate limit %q: path must start with /", part)
+		}
+
+		l, err := parseLimit(limit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit %q: %w", part, err)
+		}
+		rule.Limit = l
+		rules = append(rules, rule)
+	}
+
+	if len(rules) == 0 {
+		return nil, ErrEmptySpec
+	}
+	return rules, nil
+}
+
+func parseLimit(s string) (Limit, error) {
+	s, burstStr, hasBurst := strings.Cut(s, ",")
+	countStr, periodStr, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, errors.New("expected requests/period")
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(countStr))
+	if err != nil || count <= 0 {
+		return Limit{}, fmt.Errorf("bad request count %q", countStr)
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(periodStr))
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("bad period %q", periodStr)
+	}
+
+	l := Limit{Rate: float64(count) / period.Seconds(), Burst: count}
+	if hasBurst {
+		burst, err := strconv.Atoi(strings.TrimSpace(burstStr))
+		if err != nil || burst <= 0 {
+			return Limit{}, fmt.Errorf("bad burst %q", burstStr)
+		}
+		l.Burst = burst
+	}
+	return l, nil
+}
+
+// MaxWindow возвращает наибольшее время заполнения корзины среди правил: корзина, не использовавшаяся
+// дольше, гарантированно полна, и ее можно удалить без изменения решений
+func MaxWindow(rules []Rule) time.Duration {
+	var window time.Duration
+	for _, r := range rules {
+		window = max(window, r.Limit.Window())
+	}
+	return window
+}
+
+// Match возвращает правило с самым длинным совпадающим путем; при равных путях правило с методом важнее
+func Match(rules []Rule, method, path string) (Rule, bool) {
+	var best Rule
+	found := false
+	for _, r := range rules {
+		if !r.matches(method, path) {
+			continue
+		}
+		if !found || len(r.Path) > len(best.Path) || (len(r.Path) == len(best.Path) && best.Method == "" && r.Method != "") {
+			best, found = r, true
+		}
+	}
+	return best, found
+}
+
+// Store хранит корзины токенов. Take атомарно пополняет корзину key и берет из нее токен, если он есть.
+type Store interface {
+	Take(key string, limit Limit) (Result, error)
+}
+
+// StoreFunc позволяет использовать функцию как Store
+type StoreFunc func(key string, limit Limit) (Result, error)
+
+func (f StoreFunc) Take(key string, limit Limit) (Result, error) {
+	return f(key, limit)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	fullAt  time.Time // время, когда корзина заполнится и ее можно забыть
+}
+
+// MemoryStore хранит корзины в памяти процесса
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryStore) Take(key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	res := limit.Result(b.tokens, allowed)
+	b.fullAt = now.Add(res.Reset)
+	return res, nil
+}
+
+// sweep раз в минуту удаляет заполненные корзины, чтобы карта не росла бесконечно
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if !now.Before(b.fullAt) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// Limiter сопоставляет запросы с правилами и берет токены из корзин клиентов
+type Limiter struct {
+	rules []Rule
+	store Store
+}
+
+func New(rules []Rule, store Store) *Limiter {
+	return &Limiter{rules: rules, store: store}
+}
+
+// Allow берет токен для клиента client. Если ни одно правило не подходит, matched == false и запрос не ограничивается.
+func (l *Limiter) Allow(method, path, client string) (res Result, matched bool, err error) {
+	rule, ok := Match(l.rules, method, path)
+	if !ok {
+		return Result{Allowed: true}, false, nil
+	}
+	res, err = l.store.Take(rule.Key()+"|"+client, rule.Limit)
+	return res, true, err
+}
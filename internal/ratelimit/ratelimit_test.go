@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	rules, err := Parse("POST /api/user/orders=10/1s,20; /api=60/1m")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(rules))
+	}
+	if r := rules[0]; r.Method != "POST" || r.Path != "/api/user/orders" || r.Limit.Rate != 10 || r.Limit.Burst != 20 {
+		t.Errorf("Unexpected first rule %+v", r)
+	}
+	if r := rules[1]; r.Method != "" || r.Path != "/api" || r.Limit.Rate != 1 || r.Limit.Burst != 60 {
+		t.Errorf("Unexpected second rule %+v", r)
+	}
+
+	if _, err := Parse(DefaultSpec); err != nil {
+		t.Errorf("Default spec is invalid: %v", err)
+	}
+	for _, spec := range []string{"", "/api", "api=1/1s", "/api=0/1s", "/api=1/x", "/api=1/1s,0", "GET POST /api=1/1s"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestMaxWindow(t *testing.T) {
+	rules, _ := Parse("POST /api/user/orders=10/1s,20; /api/user/register=5/1h,120; /api=60/1m")
+	if w := MaxWindow(rules); w != 24*time.Hour {
+		t.Errorf("Expected 24h window, got %v", w)
+	}
+	if w := MaxWindow(nil); w != 0 {
+		t.Errorf("Expected zero window without rules, got %v", w)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rules, _ := Parse("POST /api/user/orders=1/1s; /api/user/orders=2/1s; /api=3/1s")
+
+	tests := []struct {
+		method, path string
+		want         string
+		ok           bool
+	}{
+		{"POST", "/api/user/orders", "POST /api/user/orders", true},
+		{"GET", "/api/user/orders", "/api/user/orders", true},
+		{"POST", "/api/user/orders/batch", "POST /api/user/orders", true},
+		{"GET", "/api/user/ordersx", "/api", true},
+		{"GET", "/api/user/balance", "/api", true},
+		{"GET", "/metrics", "", false},
+	}
+	for _, tt := range tests {
+		rule, ok := Match(rules, tt.method, tt.path)
+		if ok != tt.ok || (ok && rule.Key() != tt.want) {
+			t.Errorf("Match(%s %s) = %q, %v; expected %q, %v", tt.method, tt.path, rule.Key(), ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+
+	for i, want := range []int{1, 0} {
+		res, _ := store.Take("a", limit)
+		if !res.Allowed || res.Remaining != want {
+			t.Fatalf("Request %d: expected allowed with %d remaining, got %+v", i, want, res)
+		}
+	}
+
+	res, _ := store.Take("a", limit)
+	if res.Allowed || res.RetryAfter != time.Second || res.Reset != 2*time.Second {
+		t.Fatalf("Expected rejection with 1s retry and 2s reset, got %+v", res)
+	}
+
+	if res, _ := store.Take("b", limit); !res.Allowed {
+		t.Errorf("Buckets of different keys must be independent, got %+v", res)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if res, _ := store.Take("a", limit); res.Allowed || res.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Expected rejection with 500ms retry, got %+v", res)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if res, _ := store.Take("a", limit); !res.Allowed {
+		t.Errorf("Expected a refilled token, got %+v", res)
+	}
+
+	now = now.Add(time.Hour)
+	store.Take("c", limit)
+	if _, ok := store.buckets["a"]; ok {
+		t.Errorf("Expected full bucket to be swept")
+	}
+}
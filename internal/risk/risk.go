@@ -0,0 +1,138 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Action — решение по операции
+type Action string
+
+const (
+	Allow Action = "allow" // операция выполняется
+	Flag  Action = "flag"  // операция выполняется, но попадает в очередь проверки
+	Block Action = "block" // операция отклоняется и попадает в очередь проверки
+)
+
+// виды проверяемых операций
+const (
+	KindUpload     = "order_upload"   // загрузка нового номера заказа
+	KindConflict   = "order_conflict" // попытка загрузить номер, уже принадлежащий другому пользователю
+	KindWithdrawal = "withdrawal"     // списание или резервирование баллов
+)
+
+var (
+	ErrNewAccountAction = errors.New("new account action must be allow, flag or block")
+	ErrThresholds       = errors.New("risk thresholds must not be negative")
+)
+
+// Config — пороги правил. Нулевой порог отключает правило.
+type Config struct {
+	Window time.Duration // окно, за которое считаются операции пользователя
+
+	UploadFlag  int // число загрузок за окно, после которого загрузки помечаются
+	UploadBlock int // число загрузок за окно, после которого загрузки отклоняются
+
+	WithdrawalFlag  int // число списаний за окно, после которого списания помечаются
+	WithdrawalBlock int // число списаний за окно, после которого списания отклоняются
+
+	ConflictMinAttempts int     // минимальное число попыток загрузки за окно, с которого оценивается доля конфликтов
+	ConflictFlag        float64 // доля конфликтных попыток, после которой загрузки помечаются
+	ConflictBlock       float64 // доля конфликтных попыток, после которой загрузки отклоняются
+
+	NewAccountAge    time.Duration // возраст учетной записи, до которого она считается новой
+	NewAccountAction Action        // решение по списаниям новой учетной записи
+}
+
+// Validate проверяет согласованность порогов
+func (c Config) Validate() error {
+	switch c.NewAccountAction {
+	case Allow, Flag, Block:
+	default:
+		return ErrNewAccountAction
+	}
+	if c.Window < 0 || c.UploadFlag < 0 || c.UploadBlock < 0 || c.WithdrawalFlag < 0 || c.WithdrawalBlock < 0 ||
+		c.ConflictMinAttempts < 0 || c.ConflictFlag < 0 || c.ConflictBlock < 0 || c.NewAccountAge < 0 {
+		return ErrThresholds
+	}
+	return nil
+}
+
+// Signals — сведения об операции и недавней активности пользователя, включая текущую операцию
+type Signals struct {
+	Kind        string        // вид операции
+	Uploads     int           // загрузки новых номеров за окно
+	Conflicts   int           // конфликтные попытки загрузки за окно
+	Withdrawals int           // списания за окно
+	AccountAge  time.Duration // возраст учетной записи
+}
+
+type Decision struct {
+	Action  Action   // итоговое решение — самое строгое из решений сработавших правил
+	Reasons []string // сработавшие правила
+}
+
+func (d *Decision) apply(action Action, reason string) {
+	d.Reasons = append(d.Reasons, reason)
+	if severity(action) > severity(d.Action) {
+		d.Action = action
+	}
+}
+
+func severity(a Action) int {
+	switch a {
+	case Block:
+		return 2
+	case Flag:
+		return 1
+	}
+	return 0
+}
+
+// threshold возвращает решение для значения value при порогах flag и block
+func threshold(value, flag, block int) Action {
+	switch {
+	case block > 0 && value >= block:
+		return Block
+	case flag > 0 && value >= flag:
+		return Flag
+	}
+	return Allow
+}
+
+// Evaluate применяет правила к операции
+func Evaluate(cfg Config, s Signals) Decision {
+	d := Decision{Action: Allow}
+
+	switch s.Kind {
+	case KindUpload, KindConflict:
+		if action := threshold(s.Uploads+s.Conflicts, cfg.UploadFlag, cfg.UploadBlock); action != Allow {
+			d.apply(action, fmt.Sprintf("velocity: %d order uploads within %s", s.Uploads+s.Conflicts, cfg.Window))
+		}
+
+		attempts := s.Uploads + s.Conflicts
+		if attempts > 0 && attempts >= cfg.ConflictMinAttempts {
+			ratio := float64(s.Conflicts) / float64(attempts)
+			action := Allow
+			switch {
+			case cfg.ConflictBlock > 0 && ratio >= cfg.ConflictBlock:
+				action = Block
+			case cfg.ConflictFlag > 0 && ratio >= cfg.ConflictFlag:
+				action = Flag
+			}
+			if action != Allow {
+				d.apply(action, fmt.Sprintf("conflict ratio: %d of %d uploads belong to other users", s.Conflicts, attempts))
+			}
+		}
+
+	case KindWithdrawal:
+		if action := threshold(s.Withdrawals, cfg.WithdrawalFlag, cfg.WithdrawalBlock); action != Allow {
+			d.apply(action, fmt.Sprintf("velocity: %d withdrawals within %s", s.Withdrawals, cfg.Window))
+		}
+		if cfg.NewAccountAge > 0 && s.AccountAge < cfg.NewAccountAge && cfg.NewAccountAction != Allow {
+			d.apply(cfg.NewAccountAction, fmt.Sprintf("new account: withdrawal %s after registration", s.AccountAge.Round(time.Minute)))
+		}
+	}
+	return d
+}
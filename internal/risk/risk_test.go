@@ -0,0 +1,59 @@
+package risk
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	cfg := Config{
+		Window:              time.Hour,
+		UploadFlag:          10,
+		UploadBlock:         50,
+		WithdrawalFlag:      5,
+		WithdrawalBlock:     20,
+		ConflictMinAttempts: 5,
+		ConflictFlag:        0.3,
+		ConflictBlock:       0.6,
+		NewAccountAge:       24 * time.Hour,
+		NewAccountAction:    Flag,
+	}
+
+	tests := []struct {
+		name    string
+		signals Signals
+		want    Action
+		reasons int
+	}{
+		{"Regular upload", Signals{Kind: KindUpload, Uploads: 3, AccountAge: time.Hour}, Allow, 0},
+		{"Upload velocity flag", Signals{Kind: KindUpload, Uploads: 10}, Flag, 1},
+		{"Upload velocity block", Signals{Kind: KindUpload, Uploads: 40, Conflicts: 10}, Block, 1},
+		{"Conflicts below minimum attempts", Signals{Kind: KindConflict, Uploads: 1, Conflicts: 3}, Allow, 0},
+		{"Conflict ratio flag", Signals{Kind: KindConflict, Uploads: 6, Conflicts: 3}, Flag, 1},
+		{"Conflict ratio block wins over flag", Signals{Kind: KindConflict, Uploads: 3, Conflicts: 7}, Block, 2},
+		{"Old account withdrawal", Signals{Kind: KindWithdrawal, Withdrawals: 1, AccountAge: 48 * time.Hour}, Allow, 0},
+		{"New account withdrawal", Signals{Kind: KindWithdrawal, Withdrawals: 1, AccountAge: time.Hour}, Flag, 1},
+		{"Withdrawal velocity block", Signals{Kind: KindWithdrawal, Withdrawals: 20, AccountAge: time.Hour}, Block, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Evaluate(cfg, tt.signals)
+			if d.Action != tt.want || len(d.Reasons) != tt.reasons {
+				t.Errorf("Expected %s with %d reasons, got %+v", tt.want, tt.reasons, d)
+			}
+		})
+	}
+}
+
+func TestEvaluateDisabled(t *testing.T) {
+	cfg := Config{NewAccountAction: Allow}
+	for _, s := range []Signals{
+		{Kind: KindUpload, Uploads: 1000},
+		{Kind: KindConflict, Uploads: 1, Conflicts: 1000},
+		{Kind: KindWithdrawal, Withdrawals: 1000},
+	} {
+		if d := Evaluate(cfg, s); d.Action != Allow {
+			t.Errorf("Expected allow with zero config, got %+v", d)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"gopher-market/internal/events"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/loyalty"
+	"gopher-market/internal/metrics"
+	"gopher-market/internal/model"
+	"gopher-market/internal/store"
+	"gopher-market/internal/trace"
+	"time"
+)
+
+// ProcessAccrual обрабатывает ответ системы расчёта: сохраняет его в истории заказа,
+// начисляет вознаграждение и уведомляет подписчиков пользователя об изменениях
+func (s *Service) ProcessAccrual(ctx context.Context, result *loyalty.Accrual) error {
+	return trace.Do(ctx, "service.ProcessAccrual", func(ctx context.Context) error {
+		trace.SpanFromContext(ctx).SetAttr("order", result.Order)
+		return s.processAccrual(ctx, result)
+	})
+}
+
+func (s *Service) processAccrual(ctx context.Context, result *loyalty.Accrual) error {
+	var order *model.Order
+	err := traced(ctx, "GetOrderByNumber", func() (err error) {
+		order, err = s.Repo.GetOrderByNumber(result.Order)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if isFinal(order.Status) {
+		return s.correctAccrual(ctx, order, result)
+	}
+
+	if err := s.Repo.CreateOrderEvent(result.Order, result.Status, result.Accrual); err != nil {
+		logging.Logg.ErrorContext(ctx, "Failed to save order event", "order", result.Order, "error", err)
+	}
+
+	bonuses, err := s.orderBonuses(order, result)
+	if err != nil {
+		return err
+	}
+
+	err = traced(ctx, "UpdateOrder", func() error {
+		return s.Repo.UpdateOrder(result.Order, result.Status, result.Accrual, s.accrualTerms(), bonuses...)
+	})
+	if errors.Is(err, store.ErrOrderFinal) {
+		// Результат по заказу уже сохранен параллельной доставкой: повтор обрабатывается как пересмотр
+		order, err = s.Repo.GetOrderByNumber(result.Order)
+		if err != nil {
+			return err
+		}
+		return s.correctAccrual(ctx, order, result)
+	}
+	if err != nil {
+		return err
+	}
+	if model.Status(result.Status) == model.StatusProcessed {
+		points := result.Accrual
+		for _, b := range bonuses {
+			points += b.Amount
+		}
+		metrics.PointsAccrued.Add(float64(points))
+	}
+
+	if model.Status(result.Status) != order.Status {
+		s.publish(order.UserID, events.OrderStatus, map[string]any{
+			"number":  result.Order,
+			"status":  result.Status,
+			"accrual": result.Accrual,
+		})
+	}
+	if result.Accrual > 0 || len(bonuses) > 0 {
+		s.PublishBalance(order.UserID)
+	}
+	return nil
+}
+
+// correctAccrual применяет пересмотр уже рассчитанного заказа: доначисляет или возвращает разницу
+// согласно политике возврата. Промежуточные статусы при перепроверке игнорируются.
+func (s *Service) correctAccrual(ctx context.Context, order *model.Order, result *loyalty.Accrual) error {
+	status := model.Status(result.Status)
+	if !isFinal(status) || (status == order.Status && result.Accrual == order.Accrual) {
+		return nil
+	}
+
+	bonuses, err := s.orderBonuses(order, result)
+	if err != nil {
+		return err
+	}
+	var correction *model.AccrualCorrection
+	err = traced(ctx, "CorrectOrderAccrual", func() (err error) {
+		correction, err = s.Repo.CorrectOrderAccrual(result.Order, result.Status, result.Accrual, s.Config.ClawbackPolicy, s.accrualTerms(), bonuses...)
+		return err
+	})
+	if err != nil || correction == nil {
+		return err
+	}
+	logging.Logg.WarnContext(ctx, "Order accrual corrected",
+		"order", result.Order,
+		"old_status", correction.OldStatus,
+		"new_status", correction.NewStatus,
+		"old_accrual", correction.OldAccrual,
+		"new_accrual", correction.NewAccrual,
+		"old_bonus", correction.OldBonus,
+		"new_bonus", correction.NewBonus,
+		"applied", correction.Applied,
+		"written_off", correction.WrittenOff,
+	)
+
+	s.publish(order.UserID, events.OrderStatus, map[string]any{
+		"number":  result.Order,
+		"status":  result.Status,
+		"accrual": result.Accrual,
+	})
+	// Вознаграждение за приглашение могло быть начислено или отозвано без изменения разницы по заказу
+	s.PublishBalance(order.UserID)
+	if correction.ReferrerID != 0 {
+		s.PublishBalance(correction.ReferrerID)
+	}
+	return nil
+}
+
+// orderBonuses рассчитывает бонусы уровня и акций, причитающиеся за заказ с результатом result
+func (s *Service) orderBonuses(order *model.Order, result *loyalty.Accrual) ([]model.Bonus, error) {
+	var bonuses []model.Bonus
+	if result.Accrual > 0 {
+		bonus, err := s.tierBonus(order.UserID, result.Accrual)
+		if err != nil {
+			return nil, err
+		}
+		bonuses = append(bonuses, bonus)
+	}
+	if model.Status(result.Status) == model.StatusProcessed {
+		campaignBonuses, err := s.campaignBonuses(order, result.Accrual)
+		if err != nil {
+			return nil, err
+		}
+		bonuses = append(bonuses, campaignBonuses...)
+	}
+	return bonuses, nil
+}
+
+func isFinal(status model.Status) bool {
+	return status == model.StatusProcessed || status == model.StatusInvalid
+}
+
+// ExpirePoints списывает сгоревшие баллы и уведомляет затронутых пользователей
+func (s *Service) ExpirePoints() error {
+	for {
+		userIDs, err := s.Repo.ExpirePoints(time.Now())
+		if err != nil {
+			return err
+		}
+		if len(userIDs) == 0 {
+			return nil
+		}
+		logging.Logg.Info("Points expired", "users", len(userIDs))
+		for _, userID := range userIDs {
+			s.PublishBalance(userID)
+		}
+	}
+}
+
+// PublishBalance отправляет подписчикам пользователя текущий баланс
+func (s *Service) PublishBalance(userID int) {
+	if s.Events == nil {
+		return
+	}
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		logging.Logg.Error("Failed to fetch user for balance event", "user_id", userID, "error", err)
+		return
+	}
+	withdrawn, err := s.Repo.GetwithdrawnBalance(user.Username)
+	if err != nil {
+		logging.Logg.Error("Failed to fetch withdrawn amount for balance event", "user_id", userID, "error", err)
+		return
+	}
+	held, err := s.Repo.GetHeldBalance(userID)
+	if err != nil {
+		logging.Logg.Error("Failed to fetch held amount for balance event", "user_id", userID, "error", err)
+		return
+	}
+	s.publish(userID, events.Balance, map[string]float32{
+		"current":   user.Balance,
+		"held":      held,
+		"withdrawn": withdrawn,
+	})
+}
+
+func (s *Service) publish(userID int, eventType string, data any) {
+	if s.Events != nil {
+		s.Events.Publish(userID, eventType, data)
+	}
+}
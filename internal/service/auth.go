@@ -4,13 +4,15 @@ import (
 	"context"
 	"errors"
 	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
 	"gopher-market/internal/store"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrInvalidCredentials = errors.New("invalid login or password")
+	ErrInvalidCredentials  = errors.New("invalid login or password")
+	ErrInvalidReferralCode = errors.New("invalid referral code")
 )
 
 func (s *Service) HashPassword(password string) (string, error) {
@@ -46,11 +48,28 @@ func (s *Service) Login(ctx context.Context, login, password string) (bool, erro
 	return true, nil
 }
 
-func (s *Service) Register(ctx context.Context, login, password string) (int, error) {
+// Register создает пользователя; непустой referralCode связывает его с пригласившим
+func (s *Service) Register(ctx context.Context, login, password, referralCode string) (int, error) {
+	var referrerID int
+	if referralCode != "" {
+		id, err := s.Repo.GetUserIDByReferralCode(referralCode)
+		if err != nil {
+			if errors.Is(err, store.ErrReferralCodeNotFound) {
+				return 0, ErrInvalidReferralCode
+			}
+			return 0, err
+		}
+		referrerID = id
+	}
+
 	hashedPassword, err := s.HashPassword(password)
 	if err != nil {
 		return 0, err
 	}
 
-	return s.Repo.CreateUser(login, hashedPassword)
+	return s.Repo.CreateUser(login, hashedPassword, referrerID)
+}
+
+func (s *Service) GetReferralSummary(user *model.User) (*model.ReferralSummary, error) {
+	return s.Repo.GetReferralSummary(user.ID)
 }
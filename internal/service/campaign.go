@@ -0,0 +1,37 @@
+package service
+
+import (
+	"gopher-market/internal/campaign"
+	"gopher-market/internal/model"
+	"time"
+)
+
+// campaignBonuses рассчитывает бонусы акций за заказ, перешедший в статус PROCESSED.
+// При пересмотре рассчитанного заказа учитываются акции, действовавшие в момент его расчёта.
+func (s *Service) campaignBonuses(order *model.Order, accrual float32) ([]model.Bonus, error) {
+	now := time.Now()
+	if order.ProcessedAt != nil {
+		now = *order.ProcessedAt
+	}
+	campaigns, err := s.Repo.GetActiveCampaigns(now)
+	if err != nil || len(campaigns) == 0 {
+		return nil, err
+	}
+
+	user, err := s.Repo.GetUserByID(order.UserID)
+	if err != nil {
+		return nil, err
+	}
+	processed, err := s.Repo.HasProcessedOrders(order.UserID, order.OrderNumber, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return campaign.Evaluate(campaigns, campaign.Order{
+		Number:     order.OrderNumber,
+		Accrual:    accrual,
+		Tier:       s.UserTier(user).Name,
+		FirstOrder: !processed,
+		At:         now,
+	}), nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"errors"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/metrics"
+	"gopher-market/internal/model"
+	"time"
+)
+
+var ErrInvalidTTL = errors.New("hold ttl exceeds the maximum")
+
+// CreateHold резервирует баллы под заказ; ttl 0 означает срок по умолчанию
+func (s *Service) CreateHold(user *model.User, orderNumber string, amount float32, ttl time.Duration) (*model.Hold, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if ttl == 0 {
+		ttl = s.Config.HoldTTL
+	}
+	if ttl < 0 || ttl > s.Config.HoldMaxTTL {
+		return nil, ErrInvalidTTL
+	}
+	hold, err := s.Repo.CreateHold(user, orderNumber, amount, ttl, s.WithdrawalLimits())
+	if err != nil {
+		return nil, err
+	}
+	s.PublishBalance(user.ID)
+	return hold, nil
+}
+
+// CaptureHold списывает зарезервированные баллы и регистрирует заказ, как при обычном списании
+func (s *Service) CaptureHold(user *model.User, holdID int) (*model.Hold, error) {
+	hold, err := s.Repo.CaptureHold(user, holdID)
+	if err != nil {
+		return nil, err
+	}
+	metrics.PointsWithdrawn.Add(float64(hold.Amount))
+
+	if _, err := s.Repo.CreateOrder(user.ID, hold.OrderNumber); err != nil {
+		logging.Logg.Error("Failed to create order", "orderNumber", hold.OrderNumber, "error", err)
+	}
+	s.PublishBalance(user.ID)
+	return hold, nil
+}
+
+// ReleaseHold снимает удержание, возвращая баллы в доступный баланс
+func (s *Service) ReleaseHold(user *model.User, holdID int) (*model.Hold, error) {
+	hold, err := s.Repo.ReleaseHold(user.ID, holdID)
+	if err != nil {
+		return nil, err
+	}
+	s.PublishBalance(user.ID)
+	return hold, nil
+}
+
+// ReleaseExpiredHolds снимает просроченные удержания и уведомляет пользователей, чьи баллы снова доступны
+func (s *Service) ReleaseExpiredHolds() error {
+	userIDs, err := s.Repo.ExpireHolds(time.Now())
+	if err != nil {
+		return err
+	}
+	if len(userIDs) > 0 {
+		logging.Logg.Info("Expired holds released", "users", len(userIDs))
+	}
+	for _, userID := range userIDs {
+		s.PublishBalance(userID)
+	}
+	return nil
+}
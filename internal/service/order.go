@@ -1,19 +1,53 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"gopher-market/internal/logging"
+	"gopher-market/internal/metrics"
 	"gopher-market/internal/model"
+	"gopher-market/internal/risk"
+	"gopher-market/internal/store"
 
 	"github.com/EClaesson/go-luhn"
 )
 
 var (
-	ErrInvalidFormat = errors.New("invalid order number format (StatusBadRequest)")
-	ErrInvalidNumber = errors.New("invalid order number (StatusUnprocessableEntity)")
+	ErrInvalidFormat     = errors.New("invalid order number format (StatusBadRequest)")
+	ErrInvalidNumber     = errors.New("invalid order number (StatusUnprocessableEntity)")
+	ErrUploadedByUser    = errors.New("the order was uploaded by the user (StatusOK)")
+	ErrUploadedByAnother = errors.New("order number already uploaded by another user(StatusConflict)")
 )
 
-func (s *Service) CheckOrder(orderNumber, username string) error {
+// CheckOrder проверяет номер загружаемого заказа и применяет к загрузке правила риск-движка.
+// Попытки загрузить чужой номер тоже учитываются — по их доле выявляется подбор номеров.
+func (s *Service) CheckOrder(ctx context.Context, orderNumber, username string) error {
+	err := s.validateOrder(ctx, orderNumber, username)
+	kind := risk.KindUpload
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrUploadedByAnother):
+		kind = risk.KindConflict
+	default:
+		return err
+	}
+
+	var user *model.User
+	userErr := traced(ctx, "GetUserByLogin", func() (err error) {
+		user, err = s.Repo.GetUserByLogin(username)
+		return err
+	})
+	if userErr != nil {
+		return userErr
+	}
+	if riskErr := s.assessRisk(ctx, user, kind, orderNumber, 0); riskErr != nil {
+		return riskErr
+	}
+	return err
+}
+
+// validateOrder проверяет формат и контрольную сумму номера заказа и то, что номер еще не загружен
+func (s *Service) validateOrder(ctx context.Context, orderNumber, username string) error {
 	if !IsNumeric(orderNumber) {
 		return ErrInvalidFormat
 	}
@@ -26,22 +60,150 @@ func (s *Service) CheckOrder(orderNumber, username string) error {
 		return ErrInvalidNumber
 	}
 
-	order, err := s.Repo.GetOrderByNumber(orderNumber)
+	var order *model.Order
+	err = traced(ctx, "GetOrderByNumber", func() (err error) {
+		order, err = s.Repo.GetOrderByNumber(orderNumber)
+		return err
+	})
 	if err == nil {
 		user, _ := s.Repo.GetUserByOrderNumber(orderNumber)
 		if user.Username == username {
-			logging.Logg.Info("Order already uploaded by the user", "order_id", order.ID)
-			return errors.New("the order was uploaded by the user (StatusOK)")
+			logging.Logg.InfoContext(ctx, "Order already uploaded by the user", "order_id", order.ID)
+			return ErrUploadedByUser
 		}
-		logging.Logg.Warn("Order uploaded by another user", "order_id", order.ID)
-		return errors.New("order number already uploaded by another user(StatusConflict)")
+		logging.Logg.WarnContext(ctx, "Order uploaded by another user", "order_id", order.ID)
+		return ErrUploadedByAnother
 	}
 	return nil
 }
-func (s *Service) UploadOrder(userID int, orderNumber string) error {
-	_, err := s.Repo.CreateOrder(userID, orderNumber)
-	return err
+func (s *Service) UploadOrder(ctx context.Context, userID int, orderNumber string) error {
+	err := traced(ctx, "CreateOrder", func() error {
+		_, err := s.Repo.CreateOrder(userID, orderNumber)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	metrics.OrdersUploaded.Inc()
+	return nil
+}
+
+// UploadOrders проверяет пакет номеров заказов так же, как CheckOrder, и регистрирует прошедшие проверку
+// одной транзакцией. Загрузка учитывается риск-движком только для действительно добавленных номеров,
+// номера пакета до записи учитываются в сигналах как ожидающие. Результаты возвращаются в порядке исходного списка.
+func (s *Service) UploadOrders(ctx context.Context, userID int, username string, orderNumbers []string) ([]model.OrderUploadResult, error) {
+	results := make([]model.OrderUploadResult, len(orderNumbers))
+	seen := make(map[string]bool, len(orderNumbers))
+	user := &model.User{ID: userID, Username: username}
+	pending := make(map[string]int)
+	var accepted []string
+
+	for i, orderNumber := range orderNumbers {
+		results[i].OrderNumber = orderNumber
+		if seen[orderNumber] {
+			results[i].Status = model.UploadDuplicate
+			results[i].Message = "repeated in the batch"
+			continue
+		}
+		seen[orderNumber] = true
+
+		err := s.validateOrder(ctx, orderNumber, username)
+		switch {
+		case err == nil:
+			err = s.checkRisk(ctx, user, risk.KindUpload, orderNumber, 0, pending)
+			if err == nil {
+				pending[risk.KindUpload]++
+			}
+		case errors.Is(err, ErrUploadedByAnother):
+			if riskErr := s.checkRisk(ctx, user, risk.KindConflict, orderNumber, 0, pending); riskErr != nil {
+				err = riskErr
+			} else {
+				s.recordRiskEvent(ctx, user, risk.KindConflict, orderNumber, 0)
+			}
+		}
+
+		switch {
+		case err == nil:
+			accepted = append(accepted, orderNumber)
+		case errors.Is(err, ErrInvalidFormat):
+			results[i].Status = model.UploadInvalid
+			results[i].Message = "invalid order number format"
+		case errors.Is(err, ErrInvalidNumber):
+			results[i].Status = model.UploadInvalid
+			results[i].Message = "invalid order number"
+		case errors.Is(err, ErrUploadedByUser):
+			results[i].Status = model.UploadDuplicate
+		case errors.Is(err, ErrUploadedByAnother):
+			results[i].Status = model.UploadConflict
+		case errors.Is(err, ErrRiskBlocked):
+			results[i].Status = model.UploadBlocked
+			results[i].Message = "blocked by risk checks"
+		default:
+			return nil, err
+		}
+	}
+
+	if len(accepted) == 0 {
+		return results, nil
+	}
+
+	var statuses map[string]model.UploadStatus
+	err := traced(ctx, "CreateOrders", func() (err error) {
+		statuses, err = s.Repo.CreateOrders(userID, accepted)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if status, ok := statuses[results[i].OrderNumber]; ok && results[i].Status == "" {
+			results[i].Status = status
+			switch status {
+			case model.UploadAccepted:
+				metrics.OrdersUploaded.Inc()
+				s.recordRiskEvent(ctx, user, risk.KindUpload, results[i].OrderNumber, 0)
+			case model.UploadConflict:
+				// Номер успел загрузить другой пользователь: попытка учитывается как конфликт
+				s.recordRiskEvent(ctx, user, risk.KindConflict, results[i].OrderNumber, 0)
+			}
+		}
+	}
+	return results, nil
 }
+
 func (s *Service) GetOrders(userID int) ([]model.Order, error) {
 	return s.Repo.GetOrders(userID)
 }
+
+// GetOrderDetails собирает заказ пользователя вместе с историей опросов системы расчёта и связанными транзакциями.
+// Чужой заказ считается ненайденным, чтобы не раскрывать его существование.
+func (s *Service) GetOrderDetails(userID int, orderNumber string) (*model.OrderDetails, error) {
+	order, err := s.Repo.GetOrderByNumber(orderNumber)
+	if err != nil {
+		return nil, err
+	}
+	if order.UserID != userID {
+		return nil, store.ErrOrderNotFound
+	}
+
+	history, err := s.Repo.GetOrderEvents(orderNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := s.Repo.GetOrderTransactions(userID, orderNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &model.OrderDetails{Order: *order, History: history}
+	for i := range transactions {
+		switch transactions[i].TransactionsType {
+		case model.Accrual:
+			details.AccrualTx = &transactions[i]
+		case model.Withdraw:
+			details.Withdrawals = append(details.Withdrawals, transactions[i])
+		}
+	}
+	return details, nil
+}
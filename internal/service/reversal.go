@@ -0,0 +1,19 @@
+package service
+
+import (
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+)
+
+// ReverseWithdrawal отменяет списание пользователя login по номеру заказа и уведомляет его об изменении баланса.
+// initiator попадает в журнал, чтобы отличать отмены администратором и партнером.
+func (s *Service) ReverseWithdrawal(login, orderNumber, initiator string) (*model.Transaction, error) {
+	reversal, userID, err := s.Repo.ReverseWithdrawal(login, orderNumber)
+	if err != nil {
+		return nil, err
+	}
+	logging.Logg.Info("Withdrawal reversed", "login", login, "order", orderNumber, "sum", reversal.Amount, "initiator", initiator)
+
+	s.PublishBalance(userID)
+	return reversal, nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"gopher-market/internal/risk"
+	"time"
+)
+
+var ErrRiskBlocked = errors.New("operation blocked by risk checks")
+
+// assessRisk применяет к операции пользователя правила риск-движка и учитывает выполняемые операции.
+// Отклоненная операция не учитывается, чтобы повторные попытки не продлевали блокировку.
+func (s *Service) assessRisk(ctx context.Context, user *model.User, kind, orderNumber string, amount float32) error {
+	if err := s.checkRisk(ctx, user, kind, orderNumber, amount, nil); err != nil {
+		return err
+	}
+	s.recordRiskEvent(ctx, user, kind, orderNumber, amount)
+	return nil
+}
+
+// checkRisk применяет к операции правила риск-движка, не записывая ее. pending — операции, которые
+// еще не записаны, но должны учитываться в сигналах, например предыдущие номера того же пакета.
+// Помеченные и отклоненные операции попадают в очередь проверки. Ошибки хранилища не мешают
+// операции: риск-движок не должен останавливать сервис.
+func (s *Service) checkRisk(ctx context.Context, user *model.User, kind, orderNumber string, amount float32, pending map[string]int) error {
+	cfg := s.Config.Risk
+	now := time.Now()
+	var counts map[string]int
+	err := traced(ctx, "CountRiskEvents", func() (err error) {
+		counts, err = s.Repo.CountRiskEvents(user.ID, now.Add(-cfg.Window))
+		return err
+	})
+	if err != nil {
+		logging.Logg.ErrorContext(ctx, "Failed to count risk events", "user_id", user.ID, "error", err)
+		return nil
+	}
+	// Текущая операция еще не записана, но учитывается в сигналах
+	for k, n := range pending {
+		counts[k] += n
+	}
+	counts[kind]++
+	signals := risk.Signals{
+		Kind:        kind,
+		Uploads:     counts[risk.KindUpload],
+		Conflicts:   counts[risk.KindConflict],
+		Withdrawals: counts[risk.KindWithdrawal],
+	}
+	if kind == risk.KindWithdrawal {
+		createdAt, err := s.Repo.GetUserCreatedAt(user.ID)
+		if err != nil {
+			logging.Logg.ErrorContext(ctx, "Failed to fetch account age", "user_id", user.ID, "error", err)
+			return nil
+		}
+		signals.AccountAge = now.Sub(createdAt)
+	}
+
+	decision := risk.Evaluate(cfg, signals)
+	if decision.Action == risk.Allow {
+		return nil
+	}
+
+	logging.Logg.WarnContext(ctx, "Risk rule triggered",
+		"login", user.Username,
+		"kind", kind,
+		"order", orderNumber,
+		"action", decision.Action,
+		"reasons", decision.Reasons,
+	)
+	review := model.RiskReview{
+		Kind:        kind,
+		OrderNumber: orderNumber,
+		Amount:      amount,
+		Action:      string(decision.Action),
+		Reasons:     decision.Reasons,
+		Status:      model.ReviewOpen,
+		CreatedAt:   now,
+	}
+	err = traced(ctx, "CreateRiskReview", func() error {
+		return s.Repo.CreateRiskReview(user.ID, &review)
+	})
+	if err != nil {
+		logging.Logg.ErrorContext(ctx, "Failed to create risk review", "user_id", user.ID, "error", err)
+	}
+
+	if decision.Action == risk.Block {
+		return ErrRiskBlocked
+	}
+	return nil
+}
+
+// recordRiskEvent учитывает выполненную операцию в сигналах риск-движка
+func (s *Service) recordRiskEvent(ctx context.Context, user *model.User, kind, orderNumber string, amount float32) {
+	err := traced(ctx, "RecordRiskEvent", func() error {
+		return s.Repo.RecordRiskEvent(user.ID, kind, orderNumber, amount)
+	})
+	if err != nil {
+		logging.Logg.ErrorContext(ctx, "Failed to record risk event", "user_id", user.ID, "error", err)
+	}
+}
+
+// CheckWithdrawal проверяет номер заказа списания тем же способом, что и CheckOrder,
+// и применяет к списанию правила риск-движка
+func (s *Service) CheckWithdrawal(ctx context.Context, user *model.User, orderNumber string, amount float32) error {
+	if err := s.validateOrder(ctx, orderNumber, user.Username); err != nil {
+		return err
+	}
+	return s.assessRisk(ctx, user, risk.KindWithdrawal, orderNumber, amount)
+}
+
+// CleanupRiskEvents удаляет операции, которые уже не попадают в окно правил
+func (s *Service) CleanupRiskEvents() error {
+	n, err := s.Repo.DeleteRiskEventsBefore(time.Now().Add(-s.Config.Risk.Window))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		logging.Logg.Info("Risk events cleaned up", "count", n)
+	}
+	return nil
+}
@@ -1,18 +1,53 @@
 package service
 
 import (
+	"context"
+	"gopher-market/internal/config"
+	"gopher-market/internal/events"
+	"gopher-market/internal/model"
 	"gopher-market/internal/store"
+	"gopher-market/internal/trace"
 	"regexp"
 )
 
 type Service struct {
-	Repo store.Database
+	Repo   store.Database
+	Events *events.Broker
+	Config *config.Config
 }
 
 func NewService(repo store.Database) *Service {
 	return &Service{Repo: repo}
 }
 
+// accrualTerms возвращает условия начисления баллов из конфигурации
+func (s *Service) accrualTerms() model.AccrualTerms {
+	return model.AccrualTerms{
+		ExpireAfterMonths: s.Config.ExpireAfterMonths,
+		Referral: model.ReferralTerms{
+			ReferrerBonus: float32(s.Config.ReferralBonus),
+			RefereeBonus:  float32(s.Config.ReferralRefereeBonus),
+			MaxRewards:    s.Config.ReferralMaxRewards,
+			MinAccrual:    float32(s.Config.ReferralMinAccrual),
+		},
+	}
+}
+
+// WithdrawalLimits возвращает общие ограничения списаний из конфигурации
+func (s *Service) WithdrawalLimits() model.WithdrawalLimits {
+	return model.WithdrawalLimits{
+		MinAmount:      float32(s.Config.WithdrawMinAmount),
+		PerTransaction: float32(s.Config.WithdrawMaxAmount),
+		Daily:          float32(s.Config.WithdrawDailyLimit),
+		Monthly:        float32(s.Config.WithdrawMonthlyLimit),
+	}
+}
+
+// traced выполняет обращение к хранилищу внутри дочернего спана store.<name>
+func traced(ctx context.Context, name string, fn func() error) error {
+	return trace.Do(ctx, "store."+name, func(context.Context) error { return fn() })
+}
+
 var numericRegex = regexp.MustCompile(`^[0-9]+$`)
 
 func IsNumeric(word string) bool {
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"gopher-market/internal/model"
+	"gopher-market/internal/statement"
+)
+
+// GetStatement формирует выписку пользователя за месяц period в формате yyyy-mm
+func (s *Service) GetStatement(user *model.User, period string) (*statement.Statement, error) {
+	from, to, err := statement.ParsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	opening, err := s.Repo.GetBalanceAt(user.ID, from)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := s.Repo.GetTransactionsBetween(user.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return statement.Build(user.Username, period, from, to, opening, transactions), nil
+}
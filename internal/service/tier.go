@@ -0,0 +1,79 @@
+package service
+
+import (
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"gopher-market/internal/tier"
+	"time"
+)
+
+type TierStatus struct {
+	Tier    string             `json:"tier"`           // текущий уровень
+	Points  float32            `json:"points"`         // начисления за скользящее окно
+	Next    *model.Tier        `json:"next,omitempty"` // следующий уровень, если он есть
+	History []model.TierChange `json:"history"`        // история смены уровней
+}
+
+func (s *Service) tierWindowStart() time.Time {
+	return time.Now().AddDate(0, 0, -s.Config.TierWindowDays)
+}
+
+// UserTier возвращает уровень пользователя с учетом базового уровня по умолчанию
+func (s *Service) UserTier(user *model.User) model.Tier {
+	return tier.Find(s.Config.Tiers, user.Tier)
+}
+
+// tierBonus рассчитывает надбавку уровня владельца заказа к начислению
+func (s *Service) tierBonus(userID int, accrual float32) (model.Bonus, error) {
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		return model.Bonus{}, err
+	}
+	return model.Bonus{Type: model.TierBonus, Amount: tier.Bonus(s.UserTier(user), accrual)}, nil
+}
+
+func (s *Service) GetTierStatus(user *model.User) (*TierStatus, error) {
+	points, err := s.Repo.GetUserAccruedPoints(user.ID, s.tierWindowStart())
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.Repo.GetTierHistory(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &TierStatus{Tier: s.UserTier(user).Name, Points: points, History: history}
+	for _, t := range s.Config.Tiers {
+		if t.Threshold > points {
+			next := t
+			status.Next = &next
+			break
+		}
+	}
+	return status, nil
+}
+
+// RecalculateTiers пересчитывает уровни всех пользователей по начислениям за скользящее окно,
+// повышая и понижая уровень с записью в историю
+func (s *Service) RecalculateTiers() error {
+	standings, err := s.Repo.GetAccruedPoints(s.tierWindowStart())
+	if err != nil {
+		return err
+	}
+
+	for _, standing := range standings {
+		current := tier.Find(s.Config.Tiers, standing.Tier)
+		target := tier.ForPoints(s.Config.Tiers, standing.Points)
+		if target.Name == current.Name {
+			continue
+		}
+
+		change := model.TierChange{From: current.Name, To: target.Name, Points: standing.Points, ChangedAt: time.Now()}
+		if err := s.Repo.UpdateUserTier(standing.UserID, standing.Tier, change); err != nil {
+			logging.Logg.Error("Failed to update user tier", "user_id", standing.UserID, "error", err)
+			continue
+		}
+		logging.Logg.Info("User tier changed", "user_id", standing.UserID, "from", change.From, "to", change.To)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"gopher-market/internal/risk"
+	"time"
+)
+
+var ErrInvalidAmount = errors.New("amount must be positive")
+
+// Transfer переводит баллы другому пользователю с учетом суточного лимита и режима подтверждения.
+// Для отправителя перевод — списание: к нему применяются правила риск-движка и ограничения списаний.
+func (s *Service) Transfer(ctx context.Context, from *model.User, toLogin string, amount float32) (*model.Transfer, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if err := s.assessRisk(ctx, from, risk.KindWithdrawal, "", amount); err != nil {
+		return nil, err
+	}
+
+	var confirmTTL time.Duration
+	if s.Config.TransferConfirmation {
+		confirmTTL = s.Config.TransferTTL
+	}
+	transfer, err := s.Repo.CreateTransfer(from, toLogin, amount, float32(s.Config.TransferDailyLimit), confirmTTL, s.WithdrawalLimits())
+	if err != nil {
+		return nil, err
+	}
+
+	s.PublishBalance(from.ID)
+	if transfer.Status == model.TransferCompleted {
+		s.publishBalanceByLogin(transfer.To)
+	}
+	return transfer, nil
+}
+
+// ResolveTransfer принимает или отклоняет ожидающий перевод от имени получателя
+func (s *Service) ResolveTransfer(recipient *model.User, transferID int, accept bool) (*model.Transfer, error) {
+	transfer, err := s.Repo.ResolveTransfer(transferID, recipient.ID, accept)
+	if err != nil {
+		return nil, err
+	}
+
+	if accept {
+		s.PublishBalance(recipient.ID)
+	} else {
+		s.publishBalanceByLogin(transfer.From)
+	}
+	return transfer, nil
+}
+
+// DeclineExpiredTransfers отклоняет переводы, не подтвержденные вовремя, и уведомляет отправителей о возврате баллов
+func (s *Service) DeclineExpiredTransfers() error {
+	userIDs, err := s.Repo.ExpireTransfers(time.Now())
+	for _, userID := range userIDs {
+		s.PublishBalance(userID)
+	}
+	if len(userIDs) > 0 {
+		logging.Logg.Info("Expired transfers declined", "users", len(userIDs))
+	}
+	return err
+}
+
+func (s *Service) publishBalanceByLogin(login string) {
+	user, err := s.Repo.GetUserByLogin(login)
+	if err != nil {
+		logging.Logg.Error("Failed to fetch user for balance event", "login", login, "error", err)
+		return
+	}
+	s.PublishBalance(user.ID)
+}
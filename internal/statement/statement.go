@@ -0,0 +1,182 @@
+package statement
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"gopher-market/internal/model"
+	"html/template"
+	"io"
+	"strconv"
+	"time"
+)
+
+// PeriodLayout — формат периода выписки в URL и именах файлов
+const PeriodLayout = "2006-01"
+
+// форматы выписки
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatHTML = "html"
+)
+
+var (
+	ErrInvalidPeriod = errors.New("statement period must be in yyyy-mm format")
+	ErrFormat        = errors.New("unsupported statement format")
+)
+
+// Entry — строка выписки. Amount положителен для зачислений и отрицателен для списаний,
+// Balance — остаток после операции.
+type Entry struct {
+	ID        int         `json:"id"`        // идентификатор транзакции
+	Date      time.Time   `json:"date"`      // время операции time.RFC3339
+	Type      model.TType `json:"type"`      // тип транзакции
+	Reference string      `json:"reference"` // номер заказа или ссылка на перевод
+	Amount    float32     `json:"amount"`    // сумма со знаком
+	Balance   float32     `json:"balance"`   // остаток после операции
+}
+
+type Statement struct {
+	Login   string    `json:"login"`           // владелец счета
+	Period  string    `json:"period"`          // месяц выписки yyyy-mm
+	From    time.Time `json:"from"`            // начало периода time.RFC3339
+	To      time.Time `json:"to"`              // конец периода, не включительно time.RFC3339
+	Opening float32   `json:"opening_balance"` // входящий остаток
+	Credits float32   `json:"credits"`         // сумма зачислений за период
+	Debits  float32   `json:"debits"`          // сумма списаний за период
+	Closing float32   `json:"closing_balance"` // исходящий остаток
+	Entries []Entry   `json:"entries"`         // операции за период
+}
+
+// ParsePeriod возвращает границы месяца [from, to) в местном времени: в нем же журнал хранит время операций
+func ParsePeriod(period string) (time.Time, time.Time, error) {
+	from, err := time.ParseInLocation(PeriodLayout, period, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, ErrInvalidPeriod
+	}
+	return from, from.AddDate(0, 1, 0), nil
+}
+
+// PreviousPeriod возвращает месяц, предшествующий now, в часовом поясе now
+func PreviousPeriod(now time.Time) string {
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0).Format(PeriodLayout)
+}
+
+// Build собирает выписку из входящего остатка и операций периода, отсортированных по времени
+func Build(login, period string, from, to time.Time, opening float32, transactions []model.Transaction) *Statement {
+	s := &Statement{
+		Login:   login,
+		Period:  period,
+		From:    from,
+		To:      to,
+		Opening: opening,
+		Closing: opening,
+		Entries: make([]Entry, 0, len(transactions)),
+	}
+	for _, t := range transactions {
+		amount := t.Amount
+		if t.TransactionsType.IsDebit() {
+			amount = -amount
+			s.Debits += t.Amount
+		} else {
+			s.Credits += t.Amount
+		}
+		s.Closing += amount
+		s.Entries = append(s.Entries, Entry{
+			ID:        t.ID,
+			Date:      t.UpdatedAt,
+			Type:      t.TransactionsType,
+			Reference: t.OrderNumber,
+			Amount:    amount,
+			Balance:   s.Closing,
+		})
+	}
+	return s
+}
+
+func formatAmount(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', 2, 32)
+}
+
+// WriteCSV выводит выписку в CSV: строки операций между строками входящего и исходящего остатка
+func WriteCSV(w io.Writer, s *Statement) error {
+	cw := csv.NewWriter(w)
+	records := [][]string{
+		{"date", "type", "reference", "amount", "balance"},
+		{s.From.Format(time.RFC3339), "opening_balance", "", "", formatAmount(s.Opening)},
+	}
+	for _, e := range s.Entries {
+		records = append(records, []string{
+			e.Date.Format(time.RFC3339), string(e.Type), e.Reference, formatAmount(e.Amount), formatAmount(e.Balance),
+		})
+	}
+	records = append(records, []string{s.To.Format(time.RFC3339), "closing_balance", "", "", formatAmount(s.Closing)})
+
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+var htmlTemplate = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"amount": formatAmount,
+	"date":   func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Statement {{.Period}} — {{.Login}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+td.num, th.num { text-align: right; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>Statement for {{.Period}}</h1>
+<p>Account: {{.Login}}</p>
+<table>
+<thead><tr><th>Date</th><th>Type</th><th>Reference</th><th class="num">Amount</th><th class="num">Balance</th></tr></thead>
+<tbody>
+<tr><td>{{date .From}}</td><td colspan="3">Opening balance</td><td class="num">{{amount .Opening}}</td></tr>
+{{range .Entries}}<tr><td>{{date .Date}}</td><td>{{.Type}}</td><td>{{.Reference}}</td><td class="num">{{amount .Amount}}</td><td class="num">{{amount .Balance}}</td></tr>
+{{end}}<tr><td>{{date .To}}</td><td colspan="3">Closing balance</td><td class="num">{{amount .Closing}}</td></tr>
+</tbody>
+</table>
+<p>Credits: {{amount .Credits}} · Debits: {{amount .Debits}}</p>
+</body>
+</html>
+`))
+
+// WriteHTML выводит выписку страницей, пригодной для печати
+func WriteHTML(w io.Writer, s *Statement) error {
+	return htmlTemplate.Execute(w, s)
+}
+
+// ContentType возвращает MIME-тип формата выписки
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// Write выводит выписку в указанном формате
+func Write(w io.Writer, s *Statement, format string) error {
+	switch format {
+	case FormatJSON:
+		return json.NewEncoder(w).Encode(s)
+	case FormatCSV:
+		return WriteCSV(w, s)
+	case FormatHTML:
+		return WriteHTML(w, s)
+	}
+	return ErrFormat
+}
@@ -0,0 +1,78 @@
+package statement
+
+import (
+	"bytes"
+	"gopher-market/internal/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePeriod(t *testing.T) {
+	// Границы месяца считаются в местном времени, как и время операций в журнале
+	local := time.Local
+	time.Local = time.FixedZone("UTC+3", 3*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	from, to, err := ParsePeriod("2024-12")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !from.Equal(time.Date(2024, 12, 1, 0, 0, 0, 0, time.Local)) || !to.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("Unexpected period bounds: %v - %v", from, to)
+	}
+	if newYear := time.Date(2025, 1, 1, 0, 30, 0, 0, time.Local); newYear.Before(to) {
+		t.Errorf("Expected %v to fall into the next period ending %v", newYear, to)
+	}
+
+	for _, period := range []string{"", "2024", "2024-13", "2024-1", "24-01"} {
+		if _, _, err := ParsePeriod(period); err == nil {
+			t.Errorf("Expected error for %q", period)
+		}
+	}
+
+	if got := PreviousPeriod(time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)); got != "2024-12" {
+		t.Errorf("Expected previous period 2024-12, got %s", got)
+	}
+	if got := PreviousPeriod(time.Date(2025, 2, 1, 1, 0, 0, 0, time.Local)); got != "2025-01" {
+		t.Errorf("Expected previous period 2025-01 in local time, got %s", got)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	from, to, _ := ParsePeriod("2024-05")
+	transactions := []model.Transaction{
+		{ID: 1, OrderNumber: "12345678903", Amount: 500, TransactionsType: model.Accrual, UpdatedAt: from.Add(time.Hour)},
+		{ID: 2, OrderNumber: "2377225624", Amount: 120.5, TransactionsType: model.Withdraw, UpdatedAt: from.Add(2 * time.Hour)},
+		{ID: 3, OrderNumber: "12345678903", Amount: 50, TransactionsType: model.Clawback, UpdatedAt: from.Add(3 * time.Hour)},
+	}
+
+	s := Build("user", "2024-05", from, to, 100, transactions)
+	if s.Credits != 500 || s.Debits != 170.5 || s.Closing != 429.5 {
+		t.Errorf("Unexpected totals: credits %v, debits %v, closing %v", s.Credits, s.Debits, s.Closing)
+	}
+	if len(s.Entries) != 3 || s.Entries[1].Amount != -120.5 || s.Entries[1].Balance != 479.5 {
+		t.Fatalf("Unexpected entries: %+v", s.Entries)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, s, FormatCSV); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 6 || !strings.Contains(lines[1], "opening_balance") || !strings.HasSuffix(lines[5], "429.50") {
+		t.Errorf("Unexpected CSV:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := Write(&buf, s, FormatHTML); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "-120.50") || !strings.Contains(buf.String(), "Closing balance") {
+		t.Errorf("Unexpected HTML:\n%s", buf.String())
+	}
+
+	if err := Write(&buf, s, "pdf"); err != ErrFormat {
+		t.Errorf("Expected ErrFormat, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"math"
+	"time"
+)
+
+// CorrectOrderAccrual применяет пересмотренный системой расчёта результат по уже рассчитанному заказу.
+// bonuses — бонусы уровня и акций, причитающиеся за заказ с новым результатом. Разница между новой и ранее
+// начисленной суммой вознаграждения и бонусов записывается доначислением (adjustment) или возвратом (clawback).
+// Если заказ больше не засчитывает приглашение, вознаграждения за приглашение отзываются, и наоборот.
+// Если баланса не хватает на возврат, сумма взыскания определяется policy, невзысканный остаток
+// отражается в WrittenOff. Возвращает nil, если пересмотр ничего не меняет.
+func (r *Database) CorrectOrderAccrual(orderNumber string, status string, accrual float32, policy string, terms model.AccrualTerms, bonuses ...model.Bonus) (*model.AccrualCorrection, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			logging.Logg.Error("Failed to commit transaction", "error", err)
+		}
+	}()
+
+	correction := model.AccrualCorrection{NewStatus: model.Status(status), NewAccrual: accrual}
+	var login string
+	err = tx.QueryRow(`
+	SELECT o.user_id, u.login, o.status, o.accrual, COALESCE(o.bonus, 0)
+	FROM orders o JOIN users u ON u.user_id = o.user_id
+	WHERE o.order_number = $1
+	FOR UPDATE OF o`, orderNumber).Scan(&correction.UserID, &login, &correction.OldStatus, &correction.OldAccrual, &correction.OldBonus)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrOrderNotFound
+		}
+		return nil, err
+	}
+	if correction.OldStatus == correction.NewStatus && roundPoints(correction.OldAccrual) == roundPoints(accrual) {
+		tx.Rollback()
+		return nil, nil
+	}
+	if correction.NewStatus == model.StatusProcessed {
+		for _, bonus := range bonuses {
+			if bonus.Amount > 0 {
+				correction.NewBonus += bonus.Amount
+			}
+		}
+		correction.NewBonus = roundPoints(correction.NewBonus)
+	}
+
+	// Баланс меняется только на разницу вознаграждений: по INVALID заказу ничего не начислялось
+	correction.Delta = roundPoints(effectiveAccrual(correction.NewStatus, accrual) + correction.NewBonus -
+		effectiveAccrual(correction.OldStatus, correction.OldAccrual) - correction.OldBonus)
+
+	// Бонус приглашенного взыскивается вместе с разницей по заказу, бонус пригласившего — с него самого
+	if correction.NewStatus != model.StatusProcessed || accrual < terms.Referral.MinAccrual {
+		var refereeBonus float32
+		correction.ReferrerID, refereeBonus, err = r.revokeReferral(tx, orderNumber, policy)
+		if err != nil {
+			return nil, err
+		}
+		correction.Delta = roundPoints(correction.Delta - refereeBonus)
+	}
+
+	available, err := availableBalance(tx, correction.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case correction.Delta > 0:
+		_, err = credit(tx, correction.UserID, login, orderNumber, correction.Delta, model.Adjustment, terms.ExpireAfterMonths)
+		if err != nil {
+			return nil, err
+		}
+		correction.Applied = correction.Delta
+	case correction.Delta < 0:
+		amount := clawbackAmount(-correction.Delta, available, policy)
+		if amount > 0 {
+			_, err = debit(tx, correction.UserID, login, orderNumber, amount, model.Clawback)
+			if err != nil {
+				return nil, err
+			}
+		}
+		correction.Applied = -amount
+		correction.WrittenOff = roundPoints(-correction.Delta - amount)
+	}
+
+	now := time.Now()
+	_, err = tx.Exec("UPDATE orders SET accrual = $1, status = $2, bonus = $3, processed_at = $4 WHERE order_number = $5",
+		accrual, status, correction.NewBonus, now, orderNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if correction.NewStatus == model.StatusProcessed {
+		err = rewardReferral(tx, &model.User{ID: correction.UserID, Username: login}, orderNumber, accrual, terms)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	note := fmt.Sprintf("accrual corrected: %s %.2f (bonus %.2f) -> %s %.2f (bonus %.2f), balance change %.2f",
+		correction.OldStatus, correction.OldAccrual, correction.OldBonus,
+		correction.NewStatus, correction.NewAccrual, correction.NewBonus, correction.Applied)
+	if correction.ReferrerID != 0 {
+		note += fmt.Sprintf(", referral reward of user %d revoked", correction.ReferrerID)
+	}
+	if correction.WrittenOff > 0 {
+		note += fmt.Sprintf(", written off %.2f (policy %s)", correction.WrittenOff, policy)
+	}
+	_, err = tx.Exec("INSERT INTO order_events (order_number, status, accrual, created_at, note) VALUES ($1, $2, $3, $4, $5)",
+		orderNumber, status, accrual, now, note)
+	if err != nil {
+		return nil, err
+	}
+
+	err = enqueueWebhook(tx, model.WebhookOrderAdjusted, map[string]any{
+		"login":            login,
+		"order":            orderNumber,
+		"status":           status,
+		"accrual":          accrual,
+		"previous_status":  correction.OldStatus,
+		"previous_accrual": correction.OldAccrual,
+		"bonus":            correction.NewBonus,
+		"previous_bonus":   correction.OldBonus,
+		"balance_change":   correction.Applied,
+		"written_off":      correction.WrittenOff,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &correction, nil
+}
+
+// GetOrdersForRecheck возвращает номера заказов, рассчитанных после since, по которым возможен пересмотр
+func (r *Database) GetOrdersForRecheck(since time.Time) ([]string, error) {
+	rows, err := r.DB.Query(`
+	SELECT order_number
+	FROM orders
+	WHERE status IN ($1, $2) AND processed_at >= $3`, model.StatusProcessed, model.StatusInvalid, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orderNumbers []string
+	for rows.Next() {
+		var orderNumber string
+		if err := rows.Scan(&orderNumber); err != nil {
+			return nil, err
+		}
+		orderNumbers = append(orderNumbers, orderNumber)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return orderNumbers, nil
+}
+
+// effectiveAccrual — сумма, которая зачислена на баланс за заказ в данном статусе
+func effectiveAccrual(status model.Status, accrual float32) float32 {
+	if status == model.StatusProcessed {
+		return accrual
+	}
+	return 0
+}
+
+// clawbackAmount определяет, сколько из amount взыскать при доступном балансе available
+func clawbackAmount(amount, available float32, policy string) float32 {
+	if amount <= available {
+		return amount
+	}
+	switch policy {
+	case model.ClawbackAllow:
+		return amount
+	case model.ClawbackSkip:
+		return 0
+	default:
+		return max(available, 0)
+	}
+}
+
+// roundPoints округляет сумму до копеек, как она хранится в БД
+func roundPoints(amount float32) float32 {
+	return float32(math.Round(float64(amount)*100) / 100)
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"gopher-market/internal/model"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// processTestOrder регистрирует рассчитанный заказ пользователя и возвращает его номер
+func processTestOrder(t *testing.T, r *Database, user *model.User, accrual float32, bonuses ...model.Bonus) string {
+	t.Helper()
+	orderNumber := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if _, err := r.CreateOrder(user.ID, orderNumber); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.UpdateOrder(orderNumber, string(model.StatusProcessed), accrual, model.AccrualTerms{}, bonuses...); err != nil {
+		t.Fatal(err)
+	}
+	return orderNumber
+}
+
+func TestCorrectOrderAccrual(t *testing.T) {
+	r := newTestDB(t)
+	user := newTestUser(t, r)
+	order := processTestOrder(t, r, user, 100, model.Bonus{Type: model.TierBonus, Amount: 10})
+	if l := readLedger(t, r, user); l.Balance != 110 || !slices.Equal(l.remaining(), []float32{100, 10}) {
+		t.Fatalf("Unexpected ledger after accrual: %+v", l)
+	}
+
+	// Повтор того же результата ничего не меняет
+	correction, err := r.CorrectOrderAccrual(order, string(model.StatusProcessed), 100, model.ClawbackClamp, model.AccrualTerms{})
+	if err != nil || correction != nil {
+		t.Fatalf("Expected no correction, got %+v, %v", correction, err)
+	}
+
+	// Увеличение вознаграждения доначисляет разницу новой партией
+	correction, err = r.CorrectOrderAccrual(order, string(model.StatusProcessed), 150, model.ClawbackClamp, model.AccrualTerms{},
+		model.Bonus{Type: model.TierBonus, Amount: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if correction.Delta != 50 || correction.Applied != 50 {
+		t.Errorf("Unexpected correction %+v", correction)
+	}
+	l := readLedger(t, r, user)
+	if l.Balance != 160 || !slices.Equal(l.remaining(), []float32{100, 10, 50}) {
+		t.Errorf("Unexpected ledger after adjustment: %+v", l)
+	}
+	if last := l.last(t); last.Type != model.Adjustment || last.Amount != 50 || last.Reference != order {
+		t.Errorf("Unexpected adjustment transaction %+v", last)
+	}
+
+	// INVALID отзывает вознаграждение и бонусы; при clamp взыскивается только доступный остаток
+	if err := r.CreateTransactionWithdraw(user, "2377225624", 120, model.WithdrawalLimits{}); err != nil {
+		t.Fatal(err)
+	}
+	correction, err = r.CorrectOrderAccrual(order, string(model.StatusInvalid), 0, model.ClawbackClamp, model.AccrualTerms{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if correction.Delta != -160 || correction.Applied != -40 || correction.WrittenOff != 120 {
+		t.Errorf("Unexpected clawback %+v", correction)
+	}
+	l = readLedger(t, r, user)
+	if l.Balance != 0 || !slices.Equal(l.remaining(), []float32{0, 0, 0}) {
+		t.Errorf("Unexpected ledger after clawback: %+v", l)
+	}
+	if last := l.last(t); last.Type != model.Clawback || last.Amount != 40 || last.Reference != order {
+		t.Errorf("Unexpected clawback transaction %+v", last)
+	}
+}
+
+func TestClawbackPolicy(t *testing.T) {
+	r := newTestDB(t)
+	for _, tt := range []struct {
+		policy  string
+		balance float32
+		applied float32
+	}{
+		{model.ClawbackAllow, -20, -40},
+		{model.ClawbackClamp, 0, -20},
+		{model.ClawbackSkip, 20, 0},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			user := newTestUser(t, r)
+			order := processTestOrder(t, r, user, 50)
+			if err := r.CreateTransactionWithdraw(user, "2377225624", 30, model.WithdrawalLimits{}); err != nil {
+				t.Fatal(err)
+			}
+			before := readLedger(t, r, user)
+
+			correction, err := r.CorrectOrderAccrual(order, string(model.StatusProcessed), 10, tt.policy, model.AccrualTerms{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if correction.Delta != -40 || correction.Applied != tt.applied || correction.WrittenOff != 40+tt.applied {
+				t.Errorf("Unexpected correction %+v", correction)
+			}
+			after := readLedger(t, r, user)
+			if after.Balance != tt.balance {
+				t.Errorf("Expected balance %v, got %v", tt.balance, after.Balance)
+			}
+			if tt.applied == 0 {
+				if len(after.Transactions) != len(before.Transactions) {
+					t.Errorf("Expected no clawback transaction, got %+v", after.Transactions)
+				}
+			} else if last := after.last(t); last.Type != model.Clawback || last.Amount != -tt.applied {
+				t.Errorf("Unexpected clawback transaction %+v", last)
+			}
+		})
+	}
+}
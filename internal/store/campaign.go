@@ -0,0 +1,130 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"gopher-market/internal/model"
+	"time"
+)
+
+var ErrCampaignNotFound = errors.New("campaign not found")
+
+const campaignColumns = `id, name, starts_at, ends_at, first_order, array_to_json(tiers), order_prefix,
+	multiplier, fixed_bonus, active, created_at`
+
+func (r *Database) CreateCampaign(campaign *model.Campaign) error {
+	return r.DB.QueryRow(`INSERT INTO campaigns (name, starts_at, ends_at, first_order, tiers, order_prefix, multiplier, fixed_bonus, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at`,
+		campaign.Name, campaign.StartsAt, campaign.EndsAt, campaign.FirstOrder, campaignTiers(campaign),
+		campaign.OrderPrefix, campaign.Multiplier, campaign.FixedBonus, campaign.Active).
+		Scan(&campaign.ID, &campaign.CreatedAt)
+}
+
+func (r *Database) UpdateCampaign(campaign *model.Campaign) error {
+	err := r.DB.QueryRow(`UPDATE campaigns
+		SET name = $1, starts_at = $2, ends_at = $3, first_order = $4, tiers = $5, order_prefix = $6,
+			multiplier = $7, fixed_bonus = $8, active = $9
+		WHERE id = $10
+		RETURNING created_at`,
+		campaign.Name, campaign.StartsAt, campaign.EndsAt, campaign.FirstOrder, campaignTiers(campaign),
+		campaign.OrderPrefix, campaign.Multiplier, campaign.FixedBonus, campaign.Active, campaign.ID).
+		Scan(&campaign.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrCampaignNotFound
+	}
+	return err
+}
+
+func (r *Database) DeleteCampaign(id int) error {
+	res, err := r.DB.Exec("DELETE FROM campaigns WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrCampaignNotFound
+	}
+	return nil
+}
+
+func (r *Database) GetCampaign(id int) (*model.Campaign, error) {
+	campaign, err := scanCampaign(r.DB.QueryRow("SELECT "+campaignColumns+" FROM campaigns WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrCampaignNotFound
+	}
+	return campaign, err
+}
+
+func (r *Database) GetCampaigns() ([]model.Campaign, error) {
+	return r.queryCampaigns("SELECT " + campaignColumns + " FROM campaigns ORDER BY id")
+}
+
+// GetActiveCampaigns возвращает включенные акции, действующие в момент at
+func (r *Database) GetActiveCampaigns(at time.Time) ([]model.Campaign, error) {
+	return r.queryCampaigns("SELECT "+campaignColumns+` FROM campaigns
+		WHERE active AND starts_at <= $1 AND ends_at > $1
+		ORDER BY id`, at)
+}
+
+// HasProcessedOrders сообщает, есть ли у пользователя заказы кроме exceptOrder, рассчитанные до before
+func (r *Database) HasProcessedOrders(userID int, exceptOrder string, before time.Time) (bool, error) {
+	var exists bool
+	err := r.DB.QueryRow(`SELECT EXISTS (
+		SELECT 1 FROM orders WHERE user_id = $1 AND status = $2 AND order_number <> $3
+			AND (processed_at IS NULL OR processed_at < $4)
+	)`, userID, model.StatusProcessed, exceptOrder, before).Scan(&exists)
+	return exists, err
+}
+
+func (r *Database) queryCampaigns(query string, args ...any) ([]model.Campaign, error) {
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	campaigns := []model.Campaign{}
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, *campaign)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return campaigns, nil
+}
+
+func scanCampaign(row interface{ Scan(dest ...any) error }) (*model.Campaign, error) {
+	var campaign model.Campaign
+	var tiers []byte
+	err := row.Scan(&campaign.ID, &campaign.Name, &campaign.StartsAt, &campaign.EndsAt, &campaign.FirstOrder, &tiers,
+		&campaign.OrderPrefix, &campaign.Multiplier, &campaign.FixedBonus, &campaign.Active, &campaign.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	// Массив читается как JSON: имена уровней могут содержать запятые и кавычки
+	if err := json.Unmarshal(tiers, &campaign.Tiers); err != nil {
+		return nil, err
+	}
+	if len(campaign.Tiers) == 0 {
+		campaign.Tiers = nil
+	}
+	return &campaign, nil
+}
+
+// campaignTiers не допускает NULL в колонке tiers
+func campaignTiers(campaign *model.Campaign) []string {
+	if campaign.Tiers == nil {
+		return []string{}
+	}
+	return campaign.Tiers
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -13,10 +14,14 @@ import (
 type Database struct {
 	DBDSN string
 	DB    *sql.DB
+
+	migrationErr error // ошибка создания схемы при запуске
 }
 
+var ErrMigrations = errors.New("database schema is not initialized")
+
 type Repo interface {
-	CreateUser(login, passwordHash string) (int, error)
+	CreateUser(login, passwordHash string, referrerID int) (int, error)
 	GetUserByLogin(username string) (*model.User, error)
 	GetUserByID(id int) (*model.User, error)
 	GetOrderByNumber(string) (*model.Order, error)
@@ -42,11 +47,22 @@ func (r *Database) NewStorage(DBDSN string) error {
 	err = r.initDBTables()
 	if err != nil {
 		logging.Logg.Error("Failed to initialize DB", "error", err)
+		r.migrationErr = fmt.Errorf("%w: %w", ErrMigrations, err)
 	}
 	logging.Logg.Info("Database connection was created")
 	return nil
 }
 
+// Ping проверяет доступность базы данных
+func (r *Database) Ping(ctx context.Context) error {
+	return r.DB.PingContext(ctx)
+}
+
+// CheckMigrations возвращает ошибку, если схема не была создана при запуске
+func (r *Database) CheckMigrations(context.Context) error {
+	return r.migrationErr
+}
+
 func (r *Database) initDBTables() error {
 	var errs []error
 	stmts := []string{
@@ -74,6 +90,228 @@ func (r *Database) initDBTables() error {
     		transactions_type VARCHAR(30) NOT NULL,   
     		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP 
 		);`,
+
+		`create table if not exists order_events (
+			id BIGSERIAL PRIMARY KEY,
+			order_number VARCHAR(30) NOT NULL,
+			status VARCHAR(30) NOT NULL,
+			accrual DECIMAL(10, 2) DEFAULT 0.00,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		`create index if not exists order_events_order_number_idx on order_events (order_number);`,
+
+		`create table if not exists user_events (
+			id BIGSERIAL PRIMARY KEY,
+			user_id BIGINT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			event_type VARCHAR(30) NOT NULL,
+			payload JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		`create index if not exists user_events_user_id_idx on user_events (user_id, id);`,
+
+		`create table if not exists webhook_endpoints (
+			id BIGSERIAL PRIMARY KEY,
+			url TEXT NOT NULL,
+			secret VARCHAR(100) NOT NULL,
+			events TEXT[] NOT NULL,
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		`create table if not exists webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			endpoint_id BIGINT NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+			event_type VARCHAR(30) NOT NULL,
+			payload JSONB NOT NULL,
+			status VARCHAR(30) NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			last_status_code INT NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP
+		);`,
+
+		`create index if not exists webhook_deliveries_due_idx on webhook_deliveries (status, next_attempt_at);`,
+
+		`create table if not exists point_lots (
+			id BIGSERIAL PRIMARY KEY,
+			user_id BIGINT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			order_number VARCHAR(30) NOT NULL,
+			amount DECIMAL(10, 2) NOT NULL,
+			remaining DECIMAL(10, 2) NOT NULL,
+			accrued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP
+		);`,
+
+		`create index if not exists point_lots_user_id_idx on point_lots (user_id, accrued_at) where remaining > 0;`,
+
+		`alter table users add column if not exists tier VARCHAR(30) NOT NULL DEFAULT '';`,
+
+		`create table if not exists tier_history (
+			id BIGSERIAL PRIMARY KEY,
+			user_id BIGINT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			from_tier VARCHAR(30) NOT NULL,
+			to_tier VARCHAR(30) NOT NULL,
+			points DECIMAL(12, 2) NOT NULL,
+			changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		`create table if not exists transfers (
+			id BIGSERIAL PRIMARY KEY,
+			from_user_id BIGINT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			to_user_id BIGINT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			amount DECIMAL(10, 2) NOT NULL,
+			status VARCHAR(30) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			completed_at TIMESTAMP
+		);`,
+
+		`create index if not exists transfers_from_user_idx on transfers (from_user_id, created_at);`,
+
+		`create index if not exists transfers_to_user_idx on transfers (to_user_id, created_at);`,
+
+		`alter table transactions add column if not exists reversed_at TIMESTAMP;`,
+
+		`alter table transactions add column if not exists reversal_of BIGINT REFERENCES transactions(id);`,
+
+		`create unique index if not exists transactions_reversal_of_idx on transactions (reversal_of) where reversal_of is not null;`,
+
+		`create table if not exists holds (
+			id BIGSERIAL PRIMARY KEY,
+			user_id BIGINT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			order_number VARCHAR(30) NOT NULL,
+			amount DECIMAL(10, 2) NOT NULL,
+			status VARCHAR(30) NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			resolved_at TIMESTAMP,
+			transaction_id BIGINT REFERENCES transactions(id)
+		);`,
+
+		`create index if not exists holds_active_idx on holds (user_id) where status = 'ACTIVE';`,
+
+		`alter table order_events add column if not exists note TEXT NOT NULL DEFAULT '';`,
+		`alter table orders add column if not exists processed_at TIMESTAMP;`,
+
+		`create table if not exists campaigns (
+			id BIGSERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			starts_at TIMESTAMP NOT NULL,
+			ends_at TIMESTAMP NOT NULL,
+			first_order BOOLEAN NOT NULL DEFAULT FALSE,
+			tiers TEXT[] NOT NULL DEFAULT '{}',
+			order_prefix VARCHAR(30) NOT NULL DEFAULT '',
+			multiplier DECIMAL(6, 2) NOT NULL DEFAULT 1,
+			fixed_bonus DECIMAL(10, 2) NOT NULL DEFAULT 0,
+			active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		`alter table users add column if not exists referral_code VARCHAR(16) UNIQUE;`,
+
+		// коды из алфавита newReferralCode; ссылка на users.user_id заставляет вычислять подзапрос для каждой строки
+		`update users set referral_code = (
+			select string_agg(substr('ABCDEFGHJKLMNPQRSTUVWXYZ23456789', 1 + floor(random() * 32)::int, 1), '')
+			from generate_series(1, 8) where users.user_id is not null)
+			where referral_code is null;`,
+
+		`create table if not exists referrals (
+			id BIGSERIAL PRIMARY KEY,
+			referrer_id BIGINT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			referee_id BIGINT NOT NULL UNIQUE REFERENCES users(user_id) ON DELETE CASCADE,
+			status VARCHAR(30) NOT NULL,
+			order_number VARCHAR(30),
+			referrer_bonus DECIMAL(10, 2) NOT NULL DEFAULT 0,
+			referee_bonus DECIMAL(10, 2) NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			rewarded_at TIMESTAMP
+		);`,
+
+		`create index if not exists referrals_referrer_idx on referrals (referrer_id, status);`,
+
+		`create table if not exists withdrawal_limits (
+			user_id BIGINT PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+			min_amount DECIMAL(10, 2),
+			per_transaction DECIMAL(10, 2),
+			daily DECIMAL(12, 2),
+			monthly DECIMAL(12, 2),
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		`alter table users add column if not exists created_at TIMESTAMP;`,
+
+		`update users u set created_at = COALESCE(
+				LEAST((SELECT MIN(uploaded_at) FROM orders o WHERE o.user_id = u.user_id),
+					(SELECT MIN(updated_at) FROM transactions t WHERE t.user_id = u.user_id)),
+				TIMESTAMP 'epoch')
+			where created_at is null;`,
+
+		`alter table users alter column created_at set default CURRENT_TIMESTAMP;`,
+
+		`create table if not exists risk_events (
+			id BIGSERIAL PRIMARY KEY,
+			user_id BIGINT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			kind VARCHAR(30) NOT NULL,
+			order_number VARCHAR(30) NOT NULL,
+			amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		`create index if not exists risk_events_user_idx on risk_events (user_id, created_at);`,
+
+		`create table if not exists risk_reviews (
+			id BIGSERIAL PRIMARY KEY,
+			user_id BIGINT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+			kind VARCHAR(30) NOT NULL,
+			order_number VARCHAR(30) NOT NULL,
+			amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+			action VARCHAR(10) NOT NULL,
+			reasons TEXT[] NOT NULL,
+			status VARCHAR(30) NOT NULL,
+			note TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			resolved_at TIMESTAMP
+		);`,
+
+		`create index if not exists risk_reviews_status_idx on risk_reviews (status, created_at);`,
+
+		`create table if not exists rate_limits (
+			key TEXT PRIMARY KEY,
+			tokens DOUBLE PRECISION NOT NULL,
+			allowed BOOLEAN NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);`,
+
+		`alter table orders add column if not exists bonus DECIMAL(10, 2);`,
+
+		`update orders o set bonus = COALESCE((SELECT SUM(amount) FROM transactions t
+			WHERE t.user_id = o.user_id AND t.order_number = o.order_number AND t.transactions_type IN ('tier_bonus', 'campaign_bonus')), 0)
+			where bonus is null;`,
+
+		`alter table orders alter column bonus set default 0;`,
+
+		`create table if not exists lot_consumptions (
+			transaction_id BIGINT NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+			lot_id BIGINT NOT NULL REFERENCES point_lots(id) ON DELETE CASCADE,
+			amount DECIMAL(10, 2) NOT NULL
+		);`,
+
+		`create index if not exists lot_consumptions_transaction_idx on lot_consumptions (transaction_id);`,
+
+		`create index if not exists holds_transaction_idx on holds (transaction_id) where transaction_id is not null;`,
+
+		`create index if not exists orders_user_uploaded_idx on orders (user_id, uploaded_at, order_id);`,
+
+		`create index if not exists transactions_user_updated_idx on transactions (user_id, transactions_type, updated_at, id);`,
+
+		`alter table transfers add column if not exists expires_at TIMESTAMP;`,
+
+		`update transfers set expires_at = created_at + interval '72 hours' where status = 'PENDING' and expires_at is null;`,
+
+		`create index if not exists transfers_pending_idx on transfers (expires_at) where status = 'PENDING';`,
 	}
 
 	for _, s := range stmts {
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	logging.Logg = logging.NewLogger("error", "text", "text", "console", "")
+	os.Exit(m.Run())
+}
+
+// newTestDB подключается к тестовой базе из TEST_DATABASE_URI; без нее тест пропускается
+func newTestDB(t *testing.T) *Database {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+	var r Database
+	if err := r.NewStorage(dsn); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.DB.Close() })
+	if err := r.Ping(context.Background()); err != nil {
+		t.Skipf("Test database is not available: %v", err)
+	}
+	if err := r.CheckMigrations(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return &r
+}
+
+// newTestUser регистрирует пользователя, который удаляется вместе со своими данными после теста
+func newTestUser(t *testing.T, r *Database) *model.User {
+	t.Helper()
+	login := fmt.Sprintf("store-test-%d", time.Now().UnixNano())
+	id, err := r.CreateUser(login, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := r.DB.Exec("DELETE FROM users WHERE user_id = $1", id); err != nil {
+			t.Errorf("Failed to delete test user: %v", err)
+		}
+	})
+	return &model.User{ID: id, Username: login}
+}
+
+// accrueTestPoints начисляет пользователю партию баллов, начисленную в accruedAt
+func accrueTestPoints(t *testing.T, r *Database, user *model.User, reference string, amount float32, accruedAt time.Time, expireAfterMonths int) {
+	t.Helper()
+	tx, err := r.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := creditBalance(tx, user.ID, user.Username, reference, amount, model.Accrual, accruedAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := addLot(tx, user.ID, reference, amount, accruedAt, expireAfterMonths); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testLot struct {
+	Reference string
+	Amount    float32
+	Remaining float32
+	Expires   bool
+}
+
+type testTransaction struct {
+	ID        int
+	Reference string
+	Type      model.TType
+	Amount    float32
+	Reversed  bool
+}
+
+// ledger — баланс, партии и журнал пользователя в порядке создания
+type ledger struct {
+	Balance      float32
+	Lots         []testLot
+	Transactions []testTransaction
+}
+
+func readLedger(t *testing.T, r *Database, user *model.User) ledger {
+	t.Helper()
+	userID := user.ID
+	var l ledger
+	if err := r.DB.QueryRow("SELECT current_balance FROM users WHERE user_id = $1", userID).Scan(&l.Balance); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := r.DB.Query(`SELECT order_number, amount, remaining, expires_at IS NOT NULL
+		FROM point_lots WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var lot testLot
+		if err := rows.Scan(&lot.Reference, &lot.Amount, &lot.Remaining, &lot.Expires); err != nil {
+			t.Fatal(err)
+		}
+		l.Lots = append(l.Lots, lot)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err = r.DB.Query(`SELECT id, order_number, transactions_type, amount, reversed_at IS NOT NULL
+		FROM transactions WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tr testTransaction
+		if err := rows.Scan(&tr.ID, &tr.Reference, &tr.Type, &tr.Amount, &tr.Reversed); err != nil {
+			t.Fatal(err)
+		}
+		l.Transactions = append(l.Transactions, tr)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// remaining возвращает остатки партий в порядке начисления
+func (l ledger) remaining() []float32 {
+	out := make([]float32, 0, len(l.Lots))
+	for _, lot := range l.Lots {
+		out = append(out, lot.Remaining)
+	}
+	return out
+}
+
+// last возвращает последнюю запись журнала
+func (l ledger) last(t *testing.T) testTransaction {
+	t.Helper()
+	if len(l.Transactions) == 0 {
+		t.Fatal("Ledger has no transactions")
+	}
+	return l.Transactions[len(l.Transactions)-1]
+}
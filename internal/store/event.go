@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"gopher-market/internal/model"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// CreateOrderEvent сохраняет результат очередного опроса системы расчёта по заказу
+func (r *Database) CreateOrderEvent(orderNumber string, status string, accrual float32) error {
+	_, err := r.DB.Exec("INSERT INTO order_events (order_number, status, accrual, created_at) VALUES ($1, $2, $3, $4)",
+		orderNumber, status, accrual, time.Now())
+	return err
+}
+
+func (r *Database) GetOrderEvents(orderNumber string) ([]model.OrderEvent, error) {
+	rows, err := r.DB.Query(`
+	SELECT id, order_number, status, accrual, created_at, note
+	FROM order_events
+	WHERE order_number = $1
+	ORDER BY created_at, id`, orderNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.OrderEvent{}
+	for rows.Next() {
+		var event model.OrderEvent
+		err := rows.Scan(&event.ID, &event.OrderNumber, &event.Status, &event.Accrual, &event.CreatedAt, &event.Note)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *Database) CreateUserEvent(userID int, eventType string, payload []byte) (*model.UserEvent, error) {
+	event := model.UserEvent{UserID: userID, Type: eventType, Data: payload}
+	err := r.DB.QueryRow(`INSERT INTO user_events (user_id, event_type, payload, created_at) VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`, userID, eventType, payload, time.Now()).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// GetUserEventsSince возвращает события пользователя с идентификатором больше lastID в порядке создания
+func (r *Database) GetUserEventsSince(userID int, lastID int64, limit int) ([]model.UserEvent, error) {
+	rows, err := r.DB.Query(`
+	SELECT id, user_id, event_type, payload, created_at
+	FROM user_events
+	WHERE user_id = $1 AND id > $2
+	ORDER BY id
+	LIMIT $3`, userID, lastID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.UserEvent
+	for rows.Next() {
+		var event model.UserEvent
+		var payload []byte
+		err := rows.Scan(&event.ID, &event.UserID, &event.Type, &payload, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		event.Data = payload
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *Database) DeleteUserEventsBefore(before time.Time) (int64, error) {
+	res, err := r.DB.Exec("DELETE FROM user_events WHERE created_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *Database) Notify(channel, payload string) error {
+	_, err := r.DB.Exec("SELECT pg_notify($1, $2)", channel, payload)
+	return err
+}
+
+// Listen подписывается на канал LISTEN/NOTIFY на выделенном соединении и вызывает fn для каждого уведомления.
+// Возвращает управление при отмене контекста или обрыве соединения.
+func (r *Database) Listen(ctx context.Context, channel string, fn func(payload string)) error {
+	conn, err := r.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		pgxConn := driverConn.(*stdlib.Conn).Conn()
+		if _, err := pgxConn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return err
+		}
+		for {
+			notification, err := pgxConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			fn(notification.Payload)
+		}
+	})
+}
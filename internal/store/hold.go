@@ -0,0 +1,246 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"time"
+)
+
+// Удержание резервирует часть баланса под заказ: баллы остаются на счете, но недоступны для списаний
+// и переводов, пока удержание не будет списано (capture), снято (release) или не истечет.
+
+var (
+	ErrHoldNotFound = errors.New("active hold not found")
+	ErrHoldExpired  = errors.New("hold expired")
+)
+
+// heldAmount возвращает сумму действующих удержаний пользователя
+func heldAmount(q queryRower, userID int) (float32, error) {
+	var held float32
+	err := q.QueryRow(`SELECT COALESCE(SUM(amount), 0) FROM holds
+		WHERE user_id = $1 AND status = $2 AND expires_at > $3`, userID, model.HoldActive, time.Now()).Scan(&held)
+	return held, err
+}
+
+func (r *Database) GetHeldBalance(userID int) (float32, error) {
+	return heldAmount(r.DB, userID)
+}
+
+func (r *Database) CreateHold(user *model.User, orderNumber string, amount float32, ttl time.Duration, limits model.WithdrawalLimits) (*model.Hold, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			logging.Logg.Error("Failed to commit transaction", "error", err)
+		}
+	}()
+
+	available, err := availableBalance(tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if amount > available {
+		err = ErrInsufficientFunds
+		return nil, err
+	}
+	// Удержание — отложенное списание, поэтому ограничения проверяются при его создании, а не при capture
+	err = checkWithdrawalLimits(tx, user.ID, amount, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	hold := &model.Hold{OrderNumber: orderNumber, Amount: amount, Status: model.HoldActive, ExpiresAt: now.Add(ttl), CreatedAt: now}
+	err = tx.QueryRow(`INSERT INTO holds (user_id, order_number, amount, status, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		user.ID, orderNumber, amount, hold.Status, hold.ExpiresAt, hold.CreatedAt).Scan(&hold.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// lockHold блокирует действующее удержание пользователя; истекшее удержание помечается EXPIRED
+func lockHold(tx *sql.Tx, userID, holdID int) (*model.Hold, error) {
+	var hold model.Hold
+	err := tx.QueryRow(`SELECT id, order_number, amount, status, expires_at, created_at FROM holds
+		WHERE id = $1 AND user_id = $2 AND status = $3 FOR UPDATE`, holdID, userID, model.HoldActive).
+		Scan(&hold.ID, &hold.OrderNumber, &hold.Amount, &hold.Status, &hold.ExpiresAt, &hold.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrHoldNotFound
+		}
+		return nil, err
+	}
+	if !hold.ExpiresAt.After(time.Now()) {
+		if _, err := tx.Exec("UPDATE holds SET status = $1, resolved_at = expires_at WHERE id = $2", model.HoldExpired, hold.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrHoldExpired
+	}
+	return &hold, nil
+}
+
+// CaptureHold списывает зарезервированные баллы тем же способом, что и обычное списание
+func (r *Database) CaptureHold(user *model.User, holdID int) (*model.Hold, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			logging.Logg.Error("Failed to commit transaction", "error", err)
+		}
+	}()
+
+	balances, err := lockUsers(tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	hold, err := lockHold(tx, user.ID, holdID)
+	if errors.Is(err, ErrHoldExpired) {
+		// Пометка об истечении должна сохраниться
+		if err = tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrHoldExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Резерв не уменьшает баланс, поэтому после возврата или сгорания баллов его может не хватить
+	if balances[user.ID] < hold.Amount {
+		err = ErrInsufficientFunds
+		return nil, err
+	}
+
+	transactionID, err := withdraw(tx, user, hold.OrderNumber, hold.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	hold.Status = model.HoldCaptured
+	hold.ResolvedAt = &now
+	_, err = tx.Exec("UPDATE holds SET status = $1, resolved_at = $2, transaction_id = $3 WHERE id = $4",
+		hold.Status, now, transactionID, hold.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+func (r *Database) ReleaseHold(userID, holdID int) (*model.Hold, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			logging.Logg.Error("Failed to commit transaction", "error", err)
+		}
+	}()
+
+	hold, err := lockHold(tx, userID, holdID)
+	if errors.Is(err, ErrHoldExpired) {
+		if err = tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrHoldExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	hold.Status = model.HoldReleased
+	hold.ResolvedAt = &now
+	_, err = tx.Exec("UPDATE holds SET status = $1, resolved_at = $2 WHERE id = $3", hold.Status, now, hold.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// ExpireHolds снимает просроченные удержания и возвращает идентификаторы пользователей, у которых они были
+func (r *Database) ExpireHolds(now time.Time) ([]int, error) {
+	rows, err := r.DB.Query(`UPDATE holds SET status = $1, resolved_at = expires_at
+		WHERE status = $2 AND expires_at <= $3
+		RETURNING user_id`, model.HoldExpired, model.HoldActive, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[int]bool)
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		if !seen[userID] {
+			seen[userID] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return userIDs, nil
+}
+
+func (r *Database) GetHolds(userID int) ([]model.Hold, error) {
+	rows, err := r.DB.Query(`
+	SELECT id, order_number, amount, status, expires_at, created_at, resolved_at
+	FROM holds
+	WHERE user_id = $1
+	ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []model.Hold
+	for rows.Next() {
+		var hold model.Hold
+		var resolvedAt sql.NullTime
+		err := rows.Scan(&hold.ID, &hold.OrderNumber, &hold.Amount, &hold.Status, &hold.ExpiresAt, &hold.CreatedAt, &resolvedAt)
+		if err != nil {
+			return nil, err
+		}
+		if resolvedAt.Valid {
+			hold.ResolvedAt = &resolvedAt.Time
+		}
+		holds = append(holds, hold)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
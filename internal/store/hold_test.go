@@ -0,0 +1,105 @@
+package store
+
+import (
+	"errors"
+	"gopher-market/internal/model"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHoldLifecycle(t *testing.T) {
+	r := newTestDB(t)
+	user := newTestUser(t, r)
+	accrueTestPoints(t, r, user, "accrual", 100, time.Now().Add(-time.Hour), 0)
+
+	held := func() float32 {
+		t.Helper()
+		amount, err := r.GetHeldBalance(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return amount
+	}
+	create := func(amount float32, ttl time.Duration) *model.Hold {
+		t.Helper()
+		hold, err := r.CreateHold(user, "2377225624", amount, ttl, model.WithdrawalLimits{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hold
+	}
+
+	// Удержание не меняет баланс и журнал, но уменьшает доступную сумму
+	captured := create(40, time.Hour)
+	if l := readLedger(t, r, user); l.Balance != 100 || len(l.Transactions) != 1 || held() != 40 {
+		t.Errorf("Unexpected ledger with an active hold: %+v, held %v", l, held())
+	}
+	if _, err := r.CreateHold(user, "2377225624", 70, time.Hour, model.WithdrawalLimits{}); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("Expected held points to be unavailable, got %v", err)
+	}
+
+	if _, err := r.CaptureHold(user, captured.ID); err != nil {
+		t.Fatal(err)
+	}
+	l := readLedger(t, r, user)
+	if l.Balance != 60 || !slices.Equal(l.remaining(), []float32{60}) || held() != 0 {
+		t.Errorf("Unexpected ledger after capture: %+v, held %v", l, held())
+	}
+	if last := l.last(t); last.Type != model.Withdraw || last.Amount != 40 || last.Reference != "2377225624" {
+		t.Errorf("Unexpected capture transaction %+v", last)
+	}
+	if _, err := r.CaptureHold(user, captured.ID); !errors.Is(err, ErrHoldNotFound) {
+		t.Errorf("Expected a captured hold not to be captured again, got %v", err)
+	}
+
+	// Снятие возвращает доступность баллов без записей в журнале
+	released := create(30, time.Hour)
+	if _, err := r.ReleaseHold(user.ID, released.ID); err != nil {
+		t.Fatal(err)
+	}
+	if after := readLedger(t, r, user); after.Balance != 60 || len(after.Transactions) != len(l.Transactions) || held() != 0 {
+		t.Errorf("Unexpected ledger after release: %+v, held %v", after, held())
+	}
+
+	// Истекшее удержание нельзя списать, а ExpireHolds закрывает его
+	expired := create(20, time.Millisecond)
+	swept := create(25, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	if held() != 0 {
+		t.Errorf("Expected expired holds not to reserve points, held %v", held())
+	}
+	if _, err := r.CaptureHold(user, expired.ID); !errors.Is(err, ErrHoldExpired) {
+		t.Errorf("Expected ErrHoldExpired, got %v", err)
+	}
+	userIDs, err := r.ExpireHolds(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(userIDs, user.ID) {
+		t.Errorf("Expected user %d among users %v", user.ID, userIDs)
+	}
+	if after := readLedger(t, r, user); after.Balance != 60 || len(after.Transactions) != len(l.Transactions) {
+		t.Errorf("Unexpected ledger after expiry: %+v", after)
+	}
+
+	holds, err := r.GetHolds(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := make(map[int]model.HoldStatus)
+	for _, hold := range holds {
+		statuses[hold.ID] = hold.Status
+	}
+	want := map[int]model.HoldStatus{
+		captured.ID: model.HoldCaptured,
+		released.ID: model.HoldReleased,
+		expired.ID:  model.HoldExpired,
+		swept.ID:    model.HoldExpired,
+	}
+	for id, status := range want {
+		if statuses[id] != status {
+			t.Errorf("Expected hold %d to be %s, got %s", id, status, statuses[id])
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"gopher-market/internal/model"
+	"time"
+)
+
+var ErrWithdrawalLimit = errors.New("withdrawal limit exceeded")
+
+// LimitError сообщает, какое ограничение списаний нарушено; errors.Is(err, ErrWithdrawalLimit) для нее истинно
+type LimitError struct {
+	Limit   string    // min_amount, per_transaction, daily или monthly
+	Value   float32   // значение ограничения
+	ResetAt time.Time // начало следующего периода для daily и monthly, иначе нулевое
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s %.2f", ErrWithdrawalLimit, e.Limit, e.Value)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrWithdrawalLimit
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func getWithdrawalLimitOverride(q queryRower, userID int) (*model.WithdrawalLimitOverride, error) {
+	var minAmount, perTransaction, daily, monthly sql.NullFloat64
+	err := q.QueryRow("SELECT min_amount, per_transaction, daily, monthly FROM withdrawal_limits WHERE user_id = $1", userID).
+		Scan(&minAmount, &perTransaction, &daily, &monthly)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &model.WithdrawalLimitOverride{
+		MinAmount:      nullFloat32(minAmount),
+		PerTransaction: nullFloat32(perTransaction),
+		Daily:          nullFloat32(daily),
+		Monthly:        nullFloat32(monthly),
+	}, nil
+}
+
+func nullFloat32(v sql.NullFloat64) *float32 {
+	if !v.Valid {
+		return nil
+	}
+	f := float32(v.Float64)
+	return &f
+}
+
+// spentSince возвращает сумму неотмененных списаний, неотклоненных переводов и действующих удержаний
+// пользователя начиная с since. Списанное удержание учитывается по дате создания, как и при проверке
+// ограничений в CreateHold, а его списание исключается, чтобы capture не переносил сумму в другие сутки.
+func spentSince(q queryRower, userID int, since time.Time) (float32, error) {
+	var spent float32
+	err := q.QueryRow(`
+	SELECT
+		(SELECT COALESCE(SUM(t.amount), 0) FROM transactions t
+			WHERE t.user_id = $1 AND t.transactions_type = $2 AND t.reversed_at IS NULL AND t.updated_at >= $3
+				AND NOT EXISTS (SELECT 1 FROM holds h WHERE h.transaction_id = t.id))
+		+ (SELECT COALESCE(SUM(amount), 0) FROM transfers
+			WHERE from_user_id = $1 AND status <> $6 AND created_at >= $3)
+		+ (SELECT COALESCE(SUM(h.amount), 0) FROM holds h LEFT JOIN transactions t ON t.id = h.transaction_id
+			WHERE h.user_id = $1 AND h.created_at >= $3
+				AND ((h.status = $4 AND h.expires_at > $5) OR (h.status = $7 AND t.reversed_at IS NULL)))`,
+		userID, model.Withdraw, since, model.HoldActive, time.Now(), model.TransferDeclined, model.HoldCaptured).Scan(&spent)
+	return spent, err
+}
+
+func dayStart(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
+
+func monthStart(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+}
+
+// checkWithdrawalLimits проверяет списание amount по общим ограничениям defaults и индивидуальным.
+// Вызывается внутри транзакции списания после блокировки строки пользователя, что исключает
+// превышение суточного и месячного ограничения параллельными запросами.
+func checkWithdrawalLimits(tx *sql.Tx, userID int, amount float32, defaults model.WithdrawalLimits) error {
+	override, err := getWithdrawalLimitOverride(tx, userID)
+	if err != nil {
+		return err
+	}
+	limits := override.Apply(defaults)
+
+	if limits.MinAmount > 0 && amount < limits.MinAmount {
+		return &LimitError{Limit: "min_amount", Value: limits.MinAmount}
+	}
+	if limits.PerTransaction > 0 && amount > limits.PerTransaction {
+		return &LimitError{Limit: "per_transaction", Value: limits.PerTransaction}
+	}
+
+	now := time.Now()
+	for _, period := range []struct {
+		name  string
+		limit float32
+		since time.Time
+		until time.Time
+	}{
+		{"daily", limits.Daily, dayStart(now), dayStart(now).AddDate(0, 0, 1)},
+		{"monthly", limits.Monthly, monthStart(now), monthStart(now).AddDate(0, 1, 0)},
+	} {
+		if period.limit <= 0 {
+			continue
+		}
+		spent, err := spentSince(tx, userID, period.since)
+		if err != nil {
+			return err
+		}
+		if spent+amount > period.limit {
+			return &LimitError{Limit: period.name, Value: period.limit, ResetAt: period.until}
+		}
+	}
+	return nil
+}
+
+// GetWithdrawalLimits возвращает действующие ограничения списаний пользователя с учетом общих defaults
+// и израсходованные суммы
+func (r *Database) GetWithdrawalLimits(user *model.User, defaults model.WithdrawalLimits) (*model.UserWithdrawalLimits, error) {
+	override, err := getWithdrawalLimitOverride(r.DB, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	limits := &model.UserWithdrawalLimits{Login: user.Username, Limits: override.Apply(defaults), Override: override}
+	if limits.SpentDay, err = spentSince(r.DB, user.ID, dayStart(now)); err != nil {
+		return nil, err
+	}
+	if limits.SpentMonth, err = spentSince(r.DB, user.ID, monthStart(now)); err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// SetWithdrawalLimitOverride сохраняет индивидуальные ограничения пользователя, заменяя прежние
+func (r *Database) SetWithdrawalLimitOverride(userID int, override model.WithdrawalLimitOverride) error {
+	_, err := r.DB.Exec(`INSERT INTO withdrawal_limits (user_id, min_amount, per_transaction, daily, monthly, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE
+		SET min_amount = EXCLUDED.min_amount, per_transaction = EXCLUDED.per_transaction,
+			daily = EXCLUDED.daily, monthly = EXCLUDED.monthly, updated_at = EXCLUDED.updated_at`,
+		userID, override.MinAmount, override.PerTransaction, override.Daily, override.Monthly, time.Now())
+	return err
+}
+
+// DeleteWithdrawalLimitOverride возвращает пользователю общие ограничения
+func (r *Database) DeleteWithdrawalLimitOverride(userID int) error {
+	_, err := r.DB.Exec("DELETE FROM withdrawal_limits WHERE user_id = $1", userID)
+	return err
+}
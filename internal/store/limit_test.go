@@ -0,0 +1,35 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPeriodStart(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2024, time.March, 31, 23, 59, 59, 999, loc)
+
+	if got, want := dayStart(now), time.Date(2024, time.March, 31, 0, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("Expected day start %v, got %v", want, got)
+	}
+	if got, want := monthStart(now), time.Date(2024, time.March, 1, 0, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("Expected month start %v, got %v", want, got)
+	}
+	if got := dayStart(now); got.Location() != loc {
+		t.Errorf("Expected period in %v, got %v", loc, got.Location())
+	}
+	if got, want := dayStart(time.Date(2024, time.April, 1, 0, 0, 0, 0, loc)), time.Date(2024, time.April, 1, 0, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("Expected midnight to start a new day %v, got %v", want, got)
+	}
+}
+
+func TestLimitError(t *testing.T) {
+	var err error = &LimitError{Limit: "daily", Value: 1000}
+	if !errors.Is(err, ErrWithdrawalLimit) {
+		t.Error("Expected LimitError to match ErrWithdrawalLimit")
+	}
+	if err.Error() != "withdrawal limit exceeded: daily 1000.00" {
+		t.Errorf("Unexpected message: %q", err.Error())
+	}
+}
@@ -0,0 +1,230 @@
+package store
+
+import (
+	"database/sql"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"time"
+)
+
+// Начисленные баллы учитываются партиями (point_lots): у каждой партии свой срок жизни и неизрасходованный остаток.
+// Списания расходуют партии в порядке начисления (FIFO), задача сгорания списывает остатки просроченных партий.
+// Расход партий каждым списанием сохраняется (lot_consumptions): переведенные баллы переходят к получателю
+// со сроком жизни партий отправителя, а возвращенные — в партии, из которых были списаны.
+
+// addLot регистрирует партию баллов внутри транзакции начисления; expireAfterMonths — срок ее жизни,
+// 0 — баллы не сгорают
+func addLot(tx *sql.Tx, userID int, orderNumber string, amount float32, accruedAt time.Time, expireAfterMonths int) error {
+	var expiresAt sql.NullTime
+	if expireAfterMonths > 0 {
+		expiresAt = sql.NullTime{Time: accruedAt.AddDate(0, expireAfterMonths, 0), Valid: true}
+	}
+	_, err := tx.Exec(`INSERT INTO point_lots (user_id, order_number, amount, remaining, accrued_at, expires_at)
+		VALUES ($1, $2, $3, $3, $4, $5)`, userID, orderNumber, amount, accruedAt, expiresAt)
+	return err
+}
+
+// consumeLots расходует amount из самых старых партий пользователя в счет списания transactionID.
+// Баланс, накопленный до появления партий, в них не учтен, поэтому нехватка остатков не считается ошибкой.
+func consumeLots(tx *sql.Tx, userID, transactionID int, amount float32) error {
+	rows, err := tx.Query(`
+	SELECT id, remaining
+	FROM point_lots
+	WHERE user_id = $1 AND remaining > 0
+	ORDER BY accrued_at, id
+	FOR UPDATE`, userID)
+	if err != nil {
+		return err
+	}
+
+	type lot struct {
+		id        int
+		remaining float32
+	}
+	var lots []lot
+	for rows.Next() {
+		var l lot
+		if err := rows.Scan(&l.id, &l.remaining); err != nil {
+			rows.Close()
+			return err
+		}
+		lots = append(lots, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, l := range lots {
+		if amount <= 0 {
+			break
+		}
+		take := min(l.remaining, amount)
+		if _, err := tx.Exec("UPDATE point_lots SET remaining = remaining - $1 WHERE id = $2", take, l.id); err != nil {
+			return err
+		}
+		_, err := tx.Exec("INSERT INTO lot_consumptions (transaction_id, lot_id, amount) VALUES ($1, $2, $3)",
+			transactionID, l.id, take)
+		if err != nil {
+			return err
+		}
+		amount -= take
+	}
+	return nil
+}
+
+// restoreLots возвращает в партии баллы, израсходованные списанием transactionID.
+// Просроченные партии сгорят при следующем запуске задачи сгорания.
+func restoreLots(tx *sql.Tx, transactionID int) error {
+	_, err := tx.Exec(`UPDATE point_lots l SET remaining = l.remaining + c.amount
+		FROM lot_consumptions c
+		WHERE c.transaction_id = $1 AND c.lot_id = l.id`, transactionID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM lot_consumptions WHERE transaction_id = $1", transactionID)
+	return err
+}
+
+// moveLots регистрирует у пользователя userID партии, израсходованные списанием transactionID,
+// с прежними датами начисления и сгорания
+func moveLots(tx *sql.Tx, transactionID, userID int, reference string) error {
+	_, err := tx.Exec(`INSERT INTO point_lots (user_id, order_number, amount, remaining, accrued_at, expires_at)
+		SELECT $2, $3, c.amount, c.amount, l.accrued_at, l.expires_at
+		FROM lot_consumptions c JOIN point_lots l ON l.id = c.lot_id
+		WHERE c.transaction_id = $1
+		ORDER BY l.accrued_at, l.id`, transactionID, userID, reference)
+	return err
+}
+
+// GetExpiringPoints возвращает остаток баллов пользователя, который сгорит до before
+func (r *Database) GetExpiringPoints(userID int, before time.Time) (float32, error) {
+	var expiring float32
+	err := r.DB.QueryRow(`
+		SELECT COALESCE(SUM(remaining), 0)
+		FROM point_lots
+		WHERE user_id = $1 AND remaining > 0 AND expires_at IS NOT NULL AND expires_at <= $2`,
+		userID, before).Scan(&expiring)
+	if err != nil {
+		return 0, err
+	}
+	return expiring, nil
+}
+
+// ExpirePoints списывает остатки просроченных партий транзакциями типа expire.
+// Баллы под действующими удержаниями не сгорают, пока удержание не будет снято: у просроченной партии
+// списывается только часть, превышающая сумму удержаний, остаток сгорит после их снятия.
+// Возвращает идентификаторы пользователей, чей баланс изменился.
+func (r *Database) ExpirePoints(now time.Time) ([]int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			logging.Logg.Error("Failed to commit transaction", "error", err)
+		}
+	}()
+
+	rows, err := tx.Query(`
+	SELECT l.id, l.user_id, u.login, l.order_number, l.remaining
+	FROM point_lots l JOIN users u ON u.user_id = l.user_id
+	WHERE l.remaining > 0 AND l.expires_at IS NOT NULL AND l.expires_at <= $1
+		AND u.current_balance > (SELECT COALESCE(SUM(h.amount), 0) FROM holds h
+			WHERE h.user_id = l.user_id AND h.status = $2 AND h.expires_at > $1)
+	ORDER BY l.user_id, l.id
+	LIMIT 1000
+	FOR UPDATE OF l SKIP LOCKED`, now, model.HoldActive)
+	if err != nil {
+		return nil, err
+	}
+
+	type expiredLot struct {
+		id          int
+		userID      int
+		login       string
+		orderNumber string
+		remaining   float32
+	}
+	var lots []expiredLot
+	var ids []int
+	for rows.Next() {
+		var l expiredLot
+		if err = rows.Scan(&l.id, &l.userID, &l.login, &l.orderNumber, &l.remaining); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if len(ids) == 0 || ids[len(ids)-1] != l.userID {
+			ids = append(ids, l.userID)
+		}
+		lots = append(lots, l)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(lots) == 0 {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	// Сгореть может только не зарезервированная часть баланса
+	balances, err := lockUsers(tx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	expirable := make(map[int]float32, len(ids))
+	for _, id := range ids {
+		held, err := heldAmount(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		expirable[id] = balances[id] - held
+	}
+
+	var userIDs []int
+	expired := false
+	for i, l := range lots {
+		amount := roundPoints(min(l.remaining, expirable[l.userID]))
+		if amount > 0 {
+			_, err = tx.Exec("INSERT INTO transactions (user_id, order_number, amount, transactions_type, updated_at) VALUES ($1, $2, $3, $4, $5)",
+				l.userID, l.orderNumber, amount, model.Expire, now)
+			if err != nil {
+				return nil, err
+			}
+			_, err = tx.Exec("UPDATE point_lots SET remaining = remaining - $1 WHERE id = $2", amount, l.id)
+			if err != nil {
+				return nil, err
+			}
+			_, err = tx.Exec("UPDATE users SET current_balance = current_balance - $1 WHERE user_id = $2", amount, l.userID)
+			if err != nil {
+				return nil, err
+			}
+			expirable[l.userID] -= amount
+			balances[l.userID] -= amount
+			expired = true
+		}
+
+		// Событие об изменении баланса — одно на пользователя, после его последней партии
+		if i == len(lots)-1 || lots[i+1].userID != l.userID {
+			if expired {
+				err = enqueueWebhook(tx, model.WebhookBalanceChanged, map[string]any{
+					"login":   l.login,
+					"current": balances[l.userID],
+				})
+				if err != nil {
+					return nil, err
+				}
+				userIDs = append(userIDs, l.userID)
+			}
+			expired = false
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return userIDs, nil
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"gopher-market/internal/model"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWithdrawConsumesOldestLots(t *testing.T) {
+	r := newTestDB(t)
+	user := newTestUser(t, r)
+	accrueTestPoints(t, r, user, "accrual-1", 40, time.Now().Add(-2*time.Hour), 0)
+	accrueTestPoints(t, r, user, "accrual-2", 30, time.Now().Add(-time.Hour), 0)
+
+	before := readLedger(t, r, user)
+	if before.Balance != 70 || !slices.Equal(before.remaining(), []float32{40, 30}) {
+		t.Fatalf("Unexpected ledger before withdrawal: %+v", before)
+	}
+
+	if err := r.CreateTransactionWithdraw(user, "2377225624", 50, model.WithdrawalLimits{}); err != nil {
+		t.Fatal(err)
+	}
+	after := readLedger(t, r, user)
+	if after.Balance != 20 || !slices.Equal(after.remaining(), []float32{0, 20}) {
+		t.Errorf("Expected the older lot to be spent first, got %+v", after)
+	}
+	if last := after.last(t); last.Type != model.Withdraw || last.Amount != 50 || len(after.Transactions) != 3 {
+		t.Errorf("Unexpected transactions after withdrawal: %+v", after.Transactions)
+	}
+
+	var consumed []float32
+	rows, err := r.DB.Query(`SELECT c.amount FROM lot_consumptions c JOIN point_lots l ON l.id = c.lot_id
+		WHERE c.transaction_id = $1 ORDER BY l.id`, after.last(t).ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var amount float32
+		if err := rows.Scan(&amount); err != nil {
+			t.Fatal(err)
+		}
+		consumed = append(consumed, amount)
+	}
+	if !slices.Equal(consumed, []float32{40, 10}) {
+		t.Errorf("Expected consumption of 40 and 10 from the lots, got %v", consumed)
+	}
+}
+
+func TestExpirePointsKeepsHeldPoints(t *testing.T) {
+	r := newTestDB(t)
+	user := newTestUser(t, r)
+	accrueTestPoints(t, r, user, "expired", 40, time.Now().AddDate(0, -3, 0), 1)
+	accrueTestPoints(t, r, user, "fresh", 30, time.Now().Add(-time.Hour), 12)
+
+	hold, err := r.CreateHold(user, "2377225624", 35, time.Hour, model.WithdrawalLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Под удержанием 35 из 70, сгореть может только свободная часть просроченной партии
+	userIDs, err := r.ExpirePoints(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(userIDs, user.ID) {
+		t.Errorf("Expected user %d among expired users %v", user.ID, userIDs)
+	}
+	l := readLedger(t, r, user)
+	if l.Balance != 35 || !slices.Equal(l.remaining(), []float32{5, 30}) {
+		t.Errorf("Expected the unheld part of the expired lot to expire, got %+v", l)
+	}
+	if last := l.last(t); last.Type != model.Expire || last.Amount != 35 || last.Reference != "expired" {
+		t.Errorf("Unexpected expire transaction %+v", last)
+	}
+
+	// После снятия удержания сгорает остаток просроченной партии, свежая партия не затронута
+	if _, err := r.ReleaseHold(user.ID, hold.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ExpirePoints(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	l = readLedger(t, r, user)
+	if l.Balance != 30 || !slices.Equal(l.remaining(), []float32{0, 30}) {
+		t.Errorf("Expected the rest of the expired lot to expire after release, got %+v", l)
+	}
+	if last := l.last(t); last.Type != model.Expire || last.Amount != 5 {
+		t.Errorf("Unexpected expire transaction %+v", last)
+	}
+
+	if _, err := r.ExpirePoints(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if again := readLedger(t, r, user); len(again.Transactions) != len(l.Transactions) || again.Balance != 30 {
+		t.Errorf("Expected nothing to expire twice, got %+v", again)
+	}
+}
@@ -11,8 +11,9 @@ var ErrOrderNotFound = errors.New("order not found")
 
 func (r *Database) GetOrderByNumber(orderNumber string) (*model.Order, error) {
 	var order model.Order
-	err := r.DB.QueryRow("SELECT order_id, user_id, order_number, accrual, uploaded_at, status FROM orders WHERE order_number = $1", orderNumber).
-		Scan(&order.ID, &order.UserID, &order.OrderNumber, &order.Accrual, &order.UploadedAt, &order.Status)
+	var processedAt sql.NullTime
+	err := r.DB.QueryRow("SELECT order_id, user_id, order_number, accrual, uploaded_at, status, processed_at FROM orders WHERE order_number = $1", orderNumber).
+		Scan(&order.ID, &order.UserID, &order.OrderNumber, &order.Accrual, &order.UploadedAt, &order.Status, &processedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -20,6 +21,9 @@ func (r *Database) GetOrderByNumber(orderNumber string) (*model.Order, error) {
 		}
 		return nil, err
 	}
+	if processedAt.Valid {
+		order.ProcessedAt = &processedAt.Time
+	}
 	return &order, nil
 }
 
@@ -39,15 +43,99 @@ func (r *Database) CreateOrder(userID int, orderNumber string) (int, error) {
 	return id, nil
 }
 
+// CreateOrders регистрирует пакет номеров заказов пользователя в одной транзакции.
+// Номера, которые успели загрузить параллельно, помечаются как дубликат или конфликт.
+func (r *Database) CreateOrders(userID int, orderNumbers []string) (map[string]model.UploadStatus, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			logging.Logg.Error("Failed to commit transaction", "error", err)
+		}
+	}()
+
+	results := make(map[string]model.UploadStatus, len(orderNumbers))
+	for _, orderNumber := range orderNumbers {
+		var id int
+		err = tx.QueryRow(`INSERT INTO orders(user_id, order_number, status) VALUES ($1, $2, $3)
+			ON CONFLICT (order_number) DO NOTHING RETURNING order_id`, userID, orderNumber, model.StatusNew).Scan(&id)
+		if err == nil {
+			results[orderNumber] = model.UploadAccepted
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		var ownerID int
+		err = tx.QueryRow("SELECT user_id FROM orders WHERE order_number = $1", orderNumber).Scan(&ownerID)
+		if err != nil {
+			return nil, err
+		}
+		if ownerID == userID {
+			results[orderNumber] = model.UploadDuplicate
+		} else {
+			results[orderNumber] = model.UploadConflict
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 func (r *Database) GetOrders(userID int) ([]model.Order, error) {
+	var orders []model.Order
+	err := r.EachOrder(userID, func(order model.Order) error {
+		orders = append(orders, order)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// eachPageSize — сколько строк Each* читают одним запросом. Между страницами соединение возвращается
+// в пул, поэтому медленный клиент выгрузки не удерживает его до конца ответа.
+const eachPageSize = 500
+
+// EachOrder читает заказы пользователя страницами по ключу (uploaded_at, order_id) и передает их fn
+// по одному, не накапливая в памяти. Ошибка fn прекращает чтение и возвращается вызывающему.
+func (r *Database) EachOrder(userID int, fn func(model.Order) error) error {
 
 	GetOrders := `
         SELECT order_id, user_id, order_number, accrual, uploaded_at, status
         FROM orders
-        WHERE user_id = $1
-        ORDER BY uploaded_at DESC
+        WHERE user_id = $1 AND ($2 OR (uploaded_at, order_id) < ($3, $4))
+        ORDER BY uploaded_at DESC, order_id DESC
+        LIMIT $5
     `
-	rows, err := r.DB.Query(GetOrders, userID)
+	var last model.Order
+	for first := true; ; first = false {
+		page, err := r.queryOrders(GetOrders, userID, first, last.UploadedAt, last.ID, eachPageSize)
+		if err != nil {
+			return err
+		}
+		for _, order := range page {
+			if err := fn(order); err != nil {
+				return err
+			}
+		}
+		if len(page) < eachPageSize {
+			return nil
+		}
+		last = page[len(page)-1]
+	}
+}
+
+func (r *Database) queryOrders(query string, args ...any) ([]model.Order, error) {
+	rows, err := r.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -64,12 +152,7 @@ func (r *Database) GetOrders(userID int) ([]model.Order, error) {
 		order.Status = model.Status(statusStr)
 		orders = append(orders, order)
 	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return orders, nil
+	return orders, rows.Err()
 }
 
 func (r *Database) GetUnfinishedOrders() ([]string, error) {
@@ -105,10 +188,10 @@ func (r *Database) GetUnfinishedOrders() ([]string, error) {
 func (r *Database) GetUserByOrderNumber(orderNumber string) (*model.User, error) {
 	var user model.User
 	err := r.DB.QueryRow(`
-	SELECT u.user_id, u.login, u.password_hash, u.current_balance  
+	SELECT u.user_id, u.login, u.password_hash, u.current_balance, u.tier
 	FROM orders o JOIN users u ON o.user_id = u.user_id 
 	WHERE o.order_number = $1;`, orderNumber).
-		Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Balance)
+		Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Balance, &user.Tier)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"gopher-market/internal/ratelimit"
+	"time"
+)
+
+// TakeRateLimitToken пополняет корзину key и берет из нее токен одним запросом, чтобы реплики
+// делили общие корзины. Время берется из базы, поэтому расхождение часов реплик не влияет на лимиты.
+func (r *Database) TakeRateLimitToken(key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	var tokens float64
+	var allowed bool
+	err := r.DB.QueryRow(`
+	INSERT INTO rate_limits AS rl (key, tokens, allowed, updated_at)
+	VALUES ($1, $2::float8 - 1, true, now())
+	ON CONFLICT (key) DO UPDATE SET
+		allowed = LEAST($2::float8, rl.tokens + EXTRACT(EPOCH FROM now() - rl.updated_at)::float8 * $3::float8) >= 1,
+		tokens = LEAST($2::float8, rl.tokens + EXTRACT(EPOCH FROM now() - rl.updated_at)::float8 * $3::float8) -
+			CASE WHEN LEAST($2::float8, rl.tokens + EXTRACT(EPOCH FROM now() - rl.updated_at)::float8 * $3::float8) >= 1 THEN 1 ELSE 0 END,
+		updated_at = now()
+	RETURNING tokens, allowed`, key, float64(limit.Burst), limit.Rate).Scan(&tokens, &allowed)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	return limit.Result(tokens, allowed), nil
+}
+
+// DeleteRateLimitsBefore удаляет корзины, которые не использовались с before и успели заполниться
+func (r *Database) DeleteRateLimitsBefore(before time.Time) (int64, error) {
+	res, err := r.DB.Exec("DELETE FROM rate_limits WHERE updated_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
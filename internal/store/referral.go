@@ -0,0 +1,192 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gopher-market/internal/model"
+	"strings"
+	"time"
+)
+
+var (
+	ErrReferralCodeNotFound  = errors.New("referral code not found")
+	ErrReferralCodeCollision = errors.New("failed to generate a unique referral code")
+)
+
+// алфавит реферальных кодов без похожих символов 0/O и 1/I
+const referralAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+func newReferralCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = referralAlphabet[int(b[i])%len(referralAlphabet)]
+	}
+	return string(b), nil
+}
+
+// GetUserIDByReferralCode возвращает владельца реферального кода, регистр кода не учитывается
+func (r *Database) GetUserIDByReferralCode(code string) (int, error) {
+	var id int
+	err := r.DB.QueryRow("SELECT user_id FROM users WHERE referral_code = $1", strings.ToUpper(code)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrReferralCodeNotFound
+	}
+	return id, err
+}
+
+// rewardReferral начисляет вознаграждение за приглашение, когда у приглашенного появляется первый
+// рассчитанный заказ с вознаграждением не ниже MinAccrual. Заказ с меньшим вознаграждением приглашение
+// не засчитывает, оно ждет следующего. Сверх MaxRewards пригласивший бонус не получает, приглашенный — получает.
+// Вызывается внутри транзакции UpdateOrder.
+func rewardReferral(tx *sql.Tx, referee *model.User, orderNumber string, accrual float32, accrualTerms model.AccrualTerms) error {
+	terms := accrualTerms.Referral
+	if terms.ReferrerBonus <= 0 && terms.RefereeBonus <= 0 {
+		return nil
+	}
+	if accrual < terms.MinAccrual {
+		return nil
+	}
+
+	var referralID, referrerID int
+	err := tx.QueryRow("SELECT id, referrer_id FROM referrals WHERE referee_id = $1 AND status = $2 FOR UPDATE",
+		referee.ID, model.ReferralPending).Scan(&referralID, &referrerID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Блокировка пригласившего сериализует проверку предела вознаграждений
+	var referrerLogin string
+	err = tx.QueryRow("SELECT login FROM users WHERE user_id = $1 FOR UPDATE", referrerID).Scan(&referrerLogin)
+	if err != nil {
+		return err
+	}
+	referrerBonus := terms.ReferrerBonus
+	if terms.MaxRewards > 0 {
+		var rewarded int
+		err = tx.QueryRow("SELECT COUNT(*) FROM referrals WHERE referrer_id = $1 AND status = $2 AND referrer_bonus > 0",
+			referrerID, model.ReferralRewarded).Scan(&rewarded)
+		if err != nil {
+			return err
+		}
+		if rewarded >= terms.MaxRewards {
+			referrerBonus = 0
+		}
+	}
+
+	if terms.RefereeBonus > 0 {
+		if _, err := credit(tx, referee.ID, referee.Username, orderNumber, terms.RefereeBonus, model.ReferralBonus, accrualTerms.ExpireAfterMonths); err != nil {
+			return err
+		}
+	}
+	if referrerBonus > 0 {
+		reference := fmt.Sprintf("referral-%d", referralID)
+		if _, err := credit(tx, referrerID, referrerLogin, reference, referrerBonus, model.ReferralBonus, accrualTerms.ExpireAfterMonths); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE referrals
+		SET status = $1, order_number = $2, referrer_bonus = $3, referee_bonus = $4, rewarded_at = $5
+		WHERE id = $6`, model.ReferralRewarded, orderNumber, referrerBonus, terms.RefereeBonus, time.Now(), referralID)
+	return err
+}
+
+// revokeReferral отзывает вознаграждение за приглашение, засчитанное по заказу orderNumber, когда пересмотр
+// лишил заказ права на него. Бонус пригласившего взыскивается сразу согласно policy, бонус приглашенного
+// возвращается вызывающему для взыскания вместе с остальной разницей по заказу. Приглашение снова ждет
+// рассчитанного заказа. Возвращает идентификатор пригласившего и бонус приглашенного; 0, если отзывать нечего.
+// Вызывается внутри транзакции CorrectOrderAccrual.
+func (r *Database) revokeReferral(tx *sql.Tx, orderNumber string, policy string) (int, float32, error) {
+	var referralID, referrerID, refereeID int
+	var referrerBonus, refereeBonus float32
+	err := tx.QueryRow(`SELECT id, referrer_id, referee_id, referrer_bonus, referee_bonus
+		FROM referrals WHERE order_number = $1 AND status = $2 FOR UPDATE`, orderNumber, model.ReferralRewarded).
+		Scan(&referralID, &referrerID, &refereeID, &referrerBonus, &refereeBonus)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	balances, err := lockUsers(tx, referrerID, refereeID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if referrerBonus > 0 {
+		held, err := heldAmount(tx, referrerID)
+		if err != nil {
+			return 0, 0, err
+		}
+		amount := clawbackAmount(referrerBonus, balances[referrerID]-held, policy)
+		if amount > 0 {
+			var login string
+			if err := tx.QueryRow("SELECT login FROM users WHERE user_id = $1", referrerID).Scan(&login); err != nil {
+				return 0, 0, err
+			}
+			reference := fmt.Sprintf("referral-%d", referralID)
+			if _, err := debit(tx, referrerID, login, reference, amount, model.Clawback); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE referrals
+		SET status = $1, order_number = NULL, referrer_bonus = 0, referee_bonus = 0, rewarded_at = NULL
+		WHERE id = $2`, model.ReferralPending, referralID)
+	if err != nil {
+		return 0, 0, err
+	}
+	return referrerID, refereeBonus, nil
+}
+
+// GetReferralSummary возвращает реферальный код пользователя и приглашенных им пользователей
+func (r *Database) GetReferralSummary(userID int) (*model.ReferralSummary, error) {
+	summary := model.ReferralSummary{Referrals: []model.Referral{}}
+	err := r.DB.QueryRow("SELECT COALESCE(referral_code, '') FROM users WHERE user_id = $1", userID).Scan(&summary.Code)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := r.DB.Query(`
+	SELECT u.login, rf.status, rf.referrer_bonus, rf.created_at, rf.rewarded_at
+	FROM referrals rf JOIN users u ON u.user_id = rf.referee_id
+	WHERE rf.referrer_id = $1
+	ORDER BY rf.created_at DESC, rf.id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var referral model.Referral
+		var rewardedAt sql.NullTime
+		err := rows.Scan(&referral.Referee, &referral.Status, &referral.Bonus, &referral.CreatedAt, &rewardedAt)
+		if err != nil {
+			return nil, err
+		}
+		if rewardedAt.Valid {
+			referral.RewardedAt = &rewardedAt.Time
+			summary.Rewarded++
+		}
+		summary.Invited++
+		summary.Earned += referral.Bonus
+		summary.Referrals = append(summary.Referrals, referral)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
@@ -0,0 +1,26 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewReferralCode(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		code, err := newReferralCode()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(code) != 8 {
+			t.Fatalf("Expected 8 characters, got %q", code)
+		}
+		if i := strings.IndexFunc(code, func(r rune) bool { return !strings.ContainsRune(referralAlphabet, r) }); i >= 0 {
+			t.Fatalf("Code %q has a character outside the alphabet", code)
+		}
+		if seen[code] {
+			t.Fatalf("Duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"time"
+)
+
+var (
+	ErrWithdrawalNotFound = errors.New("withdrawal not found")
+	ErrAlreadyReversed    = errors.New("withdrawal already reversed")
+)
+
+// ReverseWithdrawal отменяет последнее неотмененное списание пользователя login по номеру заказа:
+// записывает компенсирующую транзакцию, ссылающуюся на исходную, возвращает баллы на баланс и в партии,
+// из которых они были списаны, и помечает списание отмененным. Номер заказа не уникален для списаний,
+// поэтому несколько списаний по одному номеру отменяются по одному, начиная с последнего.
+// Возвращает компенсирующую транзакцию и владельца списания. Повторная отмена невозможна благодаря
+// блокировке пользователя и уникальному индексу по reversal_of.
+func (r *Database) ReverseWithdrawal(login, orderNumber string) (*model.Transaction, int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			logging.Logg.Error("Failed to commit transaction", "error", err)
+		}
+	}()
+
+	var userID int
+	err = tx.QueryRow("SELECT user_id FROM users WHERE login = $1", login).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrWithdrawalNotFound
+		}
+		return nil, 0, err
+	}
+	// Блокировка пользователя сериализует отмены: параллельный запрос увидит уже отмененное списание
+	if _, err = lockUsers(tx, userID); err != nil {
+		return nil, 0, err
+	}
+
+	var withdrawal model.Transaction
+	err = tx.QueryRow(`
+	SELECT id, amount
+	FROM transactions
+	WHERE user_id = $1 AND order_number = $2 AND transactions_type = $3 AND reversed_at IS NULL
+	ORDER BY id DESC
+	LIMIT 1
+	FOR UPDATE`, userID, orderNumber, model.Withdraw).Scan(&withdrawal.ID, &withdrawal.Amount)
+	if err == sql.ErrNoRows {
+		var reversed bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM transactions
+			WHERE user_id = $1 AND order_number = $2 AND transactions_type = $3)`,
+			userID, orderNumber, model.Withdraw).Scan(&reversed)
+		if err == nil {
+			err = ErrWithdrawalNotFound
+			if reversed {
+				err = ErrAlreadyReversed
+			}
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	id, err := creditBalance(tx, userID, login, orderNumber, withdrawal.Amount, model.Reversal, now)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Баллы возвращаются с прежним сроком жизни, а не как новое начисление
+	err = restoreLots(tx, withdrawal.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	_, err = tx.Exec("UPDATE transactions SET reversal_of = $1 WHERE id = $2", withdrawal.ID, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	_, err = tx.Exec("UPDATE transactions SET reversed_at = $1 WHERE id = $2", now, withdrawal.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &model.Transaction{
+		ID:               id,
+		OrderNumber:      orderNumber,
+		Amount:           withdrawal.Amount,
+		TransactionsType: model.Reversal,
+		UpdatedAt:        now,
+		ReversalOf:       withdrawal.ID,
+	}, userID, nil
+}
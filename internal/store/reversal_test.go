@@ -0,0 +1,70 @@
+package store
+
+import (
+	"errors"
+	"gopher-market/internal/model"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReverseWithdrawalSameOrderNumber(t *testing.T) {
+	r := newTestDB(t)
+	alice, bob := newTestUser(t, r), newTestUser(t, r)
+	accrueTestPoints(t, r, alice, "accrual-a", 100, time.Now().Add(-time.Hour), 0)
+	accrueTestPoints(t, r, bob, "accrual-b", 100, time.Now().Add(-time.Hour), 0)
+
+	const order = "2377225624"
+	for _, w := range []struct {
+		user   *model.User
+		amount float32
+	}{{alice, 30}, {alice, 20}, {bob, 40}} {
+		if err := r.CreateTransactionWithdraw(w.user, order, w.amount, model.WithdrawalLimits{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := readLedger(t, r, alice)
+	if before.Balance != 50 || !slices.Equal(before.remaining(), []float32{50}) {
+		t.Fatalf("Unexpected ledger before reversal: %+v", before)
+	}
+	first, second := before.Transactions[1], before.Transactions[2]
+
+	// Последнее списание отменяется первым, затем более раннее по тому же номеру
+	for i, want := range []struct {
+		withdrawal testTransaction
+		balance    float32
+	}{{second, 70}, {first, 100}} {
+		reversal, userID, err := r.ReverseWithdrawal(alice.Username, order)
+		if err != nil {
+			t.Fatalf("Reversal %d: %v", i, err)
+		}
+		if userID != alice.ID || reversal.ReversalOf != want.withdrawal.ID || reversal.Amount != want.withdrawal.Amount {
+			t.Errorf("Reversal %d: unexpected %+v for user %d", i, reversal, userID)
+		}
+		after := readLedger(t, r, alice)
+		if after.Balance != want.balance || !slices.Equal(after.remaining(), []float32{want.balance}) {
+			t.Errorf("Reversal %d: unexpected ledger %+v", i, after)
+		}
+		if last := after.last(t); last.Type != model.Reversal || last.Amount != want.withdrawal.Amount || last.Reference != order {
+			t.Errorf("Reversal %d: unexpected reversal transaction %+v", i, last)
+		}
+	}
+
+	if _, _, err := r.ReverseWithdrawal(alice.Username, order); !errors.Is(err, ErrAlreadyReversed) {
+		t.Errorf("Expected ErrAlreadyReversed, got %v", err)
+	}
+	if _, _, err := r.ReverseWithdrawal(alice.Username, "12345678903"); !errors.Is(err, ErrWithdrawalNotFound) {
+		t.Errorf("Expected ErrWithdrawalNotFound, got %v", err)
+	}
+
+	// Списание другого пользователя по тому же номеру не затронуто и отменяется только от его имени
+	if l := readLedger(t, r, bob); l.Balance != 60 || l.last(t).Type != model.Withdraw || l.last(t).Reversed {
+		t.Errorf("Unexpected ledger of the other user: %+v", l)
+	}
+	if _, userID, err := r.ReverseWithdrawal(bob.Username, order); err != nil || userID != bob.ID {
+		t.Errorf("Expected reversal of the other user's withdrawal, got user %d: %v", userID, err)
+	}
+	if l := readLedger(t, r, bob); l.Balance != 100 {
+		t.Errorf("Unexpected balance of the other user after reversal: %v", l.Balance)
+	}
+}
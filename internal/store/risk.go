@@ -0,0 +1,123 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"gopher-market/internal/model"
+	"strings"
+	"time"
+)
+
+var ErrReviewNotFound = errors.New("open risk review not found")
+
+// RecordRiskEvent сохраняет операцию пользователя для правил скорости и доли конфликтов
+func (r *Database) RecordRiskEvent(userID int, kind, orderNumber string, amount float32) error {
+	_, err := r.DB.Exec("INSERT INTO risk_events (user_id, kind, order_number, amount, created_at) VALUES ($1, $2, $3, $4, $5)",
+		userID, kind, orderNumber, amount, time.Now())
+	return err
+}
+
+// CountRiskEvents возвращает число операций пользователя каждого вида начиная с since
+func (r *Database) CountRiskEvents(userID int, since time.Time) (map[string]int, error) {
+	rows, err := r.DB.Query(`SELECT kind, COUNT(*) FROM risk_events
+		WHERE user_id = $1 AND created_at >= $2
+		GROUP BY kind`, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var kind string
+		var count int
+		if err := rows.Scan(&kind, &count); err != nil {
+			return nil, err
+		}
+		counts[kind] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// DeleteRiskEventsBefore удаляет операции, вышедшие за окно правил
+func (r *Database) DeleteRiskEventsBefore(before time.Time) (int64, error) {
+	res, err := r.DB.Exec("DELETE FROM risk_events WHERE created_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *Database) GetUserCreatedAt(userID int) (time.Time, error) {
+	var createdAt time.Time
+	err := r.DB.QueryRow("SELECT created_at FROM users WHERE user_id = $1", userID).Scan(&createdAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, ErrUserNotFound
+	}
+	return createdAt, err
+}
+
+func (r *Database) CreateRiskReview(userID int, review *model.RiskReview) error {
+	return r.DB.QueryRow(`INSERT INTO risk_reviews (user_id, kind, order_number, amount, action, reasons, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		userID, review.Kind, review.OrderNumber, review.Amount, review.Action, review.Reasons, review.Status, review.CreatedAt).
+		Scan(&review.ID)
+}
+
+// GetRiskReviews возвращает проверки в статусе status, пустой статус — все проверки
+func (r *Database) GetRiskReviews(status string, limit int) ([]model.RiskReview, error) {
+	rows, err := r.DB.Query(`
+	SELECT rv.id, u.login, rv.kind, rv.order_number, rv.amount, rv.action, array_to_string(rv.reasons, chr(10)),
+		rv.status, rv.note, rv.created_at, rv.resolved_at
+	FROM risk_reviews rv JOIN users u ON u.user_id = rv.user_id
+	WHERE $1::text = '' OR rv.status = $1
+	ORDER BY rv.created_at DESC, rv.id DESC
+	LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []model.RiskReview{}
+	for rows.Next() {
+		var review model.RiskReview
+		var reasons string
+		var resolvedAt sql.NullTime
+		err := rows.Scan(&review.ID, &review.Login, &review.Kind, &review.OrderNumber, &review.Amount, &review.Action,
+			&reasons, &review.Status, &review.Note, &review.CreatedAt, &resolvedAt)
+		if err != nil {
+			return nil, err
+		}
+		review.Reasons = strings.Split(reasons, "\n")
+		if resolvedAt.Valid {
+			review.ResolvedAt = &resolvedAt.Time
+		}
+		reviews = append(reviews, review)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+// ResolveRiskReview закрывает открытую проверку решением администратора
+func (r *Database) ResolveRiskReview(id int, status, note string) error {
+	res, err := r.DB.Exec("UPDATE risk_reviews SET status = $1, note = $2, resolved_at = $3 WHERE id = $4 AND status = $5",
+		status, note, time.Now(), id, model.ReviewOpen)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrReviewNotFound
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"time"
+)
+
+// GetAccruedPoints возвращает сумму начислений системы расчёта каждого пользователя начиная с since
+func (r *Database) GetAccruedPoints(since time.Time) ([]model.UserPoints, error) {
+	rows, err := r.DB.Query(`
+	SELECT u.user_id, u.tier, COALESCE(SUM(t.amount), 0)
+	FROM users u
+	LEFT JOIN transactions t ON t.user_id = u.user_id AND t.transactions_type = $1 AND t.updated_at >= $2
+	GROUP BY u.user_id, u.tier
+	ORDER BY u.user_id`, model.Accrual, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []model.UserPoints
+	for rows.Next() {
+		var p model.UserPoints
+		if err := rows.Scan(&p.UserID, &p.Tier, &p.Points); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+func (r *Database) GetUserAccruedPoints(userID int, since time.Time) (float32, error) {
+	var points float32
+	err := r.DB.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0)
+		FROM transactions
+		WHERE user_id = $1 AND transactions_type = $2 AND updated_at >= $3`,
+		userID, model.Accrual, since).Scan(&points)
+	if err != nil {
+		return 0, err
+	}
+	return points, nil
+}
+
+// UpdateUserTier меняет уровень пользователя и записывает смену в историю.
+// stored — значение уровня в БД на момент расчета; если оно успело измениться, смена пропускается.
+func (r *Database) UpdateUserTier(userID int, stored string, change model.TierChange) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			logging.Logg.Error("Failed to commit transaction", "error", err)
+		}
+	}()
+
+	res, err := tx.Exec("UPDATE users SET tier = $1 WHERE user_id = $2 AND tier = $3", change.To, userID, stored)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return tx.Rollback()
+	}
+
+	_, err = tx.Exec("INSERT INTO tier_history (user_id, from_tier, to_tier, points, changed_at) VALUES ($1, $2, $3, $4, $5)",
+		userID, change.From, change.To, change.Points, change.ChangedAt)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+func (r *Database) GetTierHistory(userID int) ([]model.TierChange, error) {
+	rows, err := r.DB.Query(`
+	SELECT from_tier, to_tier, points, changed_at
+	FROM tier_history
+	WHERE user_id = $1
+	ORDER BY changed_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []model.TierChange{}
+	for rows.Next() {
+		var change model.TierChange
+		if err := rows.Scan(&change.From, &change.To, &change.Points, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
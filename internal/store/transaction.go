@@ -1,6 +1,7 @@
 package store
 
 import (
+	"database/sql"
 	"errors"
 	"gopher-market/internal/logging"
 	"gopher-market/internal/model"
@@ -9,6 +10,7 @@ import (
 
 var ErrInsufficientFunds = errors.New("insufficient funds (402)")
 var ErrFailCommTrans = errors.New("failed to commit transaction")
+var ErrOrderFinal = errors.New("order already has a final status")
 
 func (r *Database) GetwithdrawnBalance(username string) (float32, error) {
 	var withdrawnBalance float32
@@ -17,7 +19,7 @@ func (r *Database) GetwithdrawnBalance(username string) (float32, error) {
 	err := r.DB.QueryRow(`
 		SELECT COALESCE(SUM(amount), 0)
 	        FROM transactions
-	        WHERE user_id = $1 AND transactions_type = $2`,
+	        WHERE user_id = $1 AND transactions_type = $2 AND reversed_at IS NULL`,
 		user.ID, model.Withdraw).Scan(&withdrawnBalance)
 	if err != nil {
 		return 0, err
@@ -25,7 +27,7 @@ func (r *Database) GetwithdrawnBalance(username string) (float32, error) {
 	return withdrawnBalance, nil
 }
 
-func (r *Database) CreateTransactionWithdraw(user *model.User, orderNumber string, amount float32) error {
+func (r *Database) CreateTransactionWithdraw(user *model.User, orderNumber string, amount float32, limits model.WithdrawalLimits) error {
 	logging.Logg.Info("Process withdraw")
 	tx, err := r.DB.Begin()
 	if err != nil {
@@ -38,27 +40,28 @@ func (r *Database) CreateTransactionWithdraw(user *model.User, orderNumber strin
 		}
 	}()
 
-	if amount > user.Balance {
-		return ErrInsufficientFunds
+	// Баланс перечитывается под блокировкой: значение в user могло устареть
+	available, err := availableBalance(tx, user.ID)
+	if err != nil {
+		return err
 	}
-	logging.Logg.Info("Amount checked")
 
-	_, err = tx.Exec("INSERT INTO transactions (user_id, order_number, amount, transactions_type, updated_at) VALUES ($1, $2, $3, $4, $5)",
-		user.ID, orderNumber, amount, model.Withdraw, time.Now())
+	if amount > available {
+		err = ErrInsufficientFunds
+		return err
+	}
+	err = checkWithdrawalLimits(tx, user.ID, amount, limits)
 	if err != nil {
-		logging.Logg.Error("Failed to commit transaction", "error", err)
 		return err
 	}
-	logging.Logg.Info("Transaction created")
-
-	newBalance := user.Balance - amount
+	logging.Logg.Info("Amount checked")
 
-	_, err = tx.Exec("UPDATE users SET current_balance = $1 WHERE user_id = $2", newBalance, user.ID)
+	_, err = withdraw(tx, user, orderNumber, amount)
 	if err != nil {
 		logging.Logg.Error("Failed to commit transaction", "error", err)
 		return err
 	}
-	logging.Logg.Info("User updated")
+	logging.Logg.Info("Transaction created")
 
 	err = tx.Commit()
 	if err != nil {
@@ -70,37 +73,138 @@ func (r *Database) CreateTransactionWithdraw(user *model.User, orderNumber strin
 	return nil
 }
 
+// availableBalance блокирует строку пользователя и возвращает баланс за вычетом действующих удержаний
+func availableBalance(tx *sql.Tx, userID int) (float32, error) {
+	var balance float32
+	err := tx.QueryRow("SELECT current_balance FROM users WHERE user_id = $1 FOR UPDATE", userID).Scan(&balance)
+	if err != nil {
+		return 0, err
+	}
+	held, err := heldAmount(tx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return balance - held, nil
+}
+
+// withdraw записывает списание в счет заказа внутри транзакции и ставит в очередь событие вебхука.
+// Возвращает идентификатор записи в журнале.
+func withdraw(tx *sql.Tx, user *model.User, orderNumber string, amount float32) (int, error) {
+	id, err := debit(tx, user.ID, user.Username, orderNumber, amount, model.Withdraw)
+	if err != nil {
+		return 0, err
+	}
+	err = enqueueWebhook(tx, model.WebhookWithdrawal, map[string]any{
+		"login": user.Username,
+		"order": orderNumber,
+		"sum":   amount,
+	})
+	return id, err
+}
+
 func (r *Database) Getwithdrawals(userID int) ([]model.Transaction, error) {
+	var withdrawals []model.Transaction
+	err := r.EachWithdrawal(userID, func(withdrawal model.Transaction) error {
+		withdrawals = append(withdrawals, withdrawal)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logging.Logg.Info("Got rows", "rows", len(withdrawals))
+	return withdrawals, nil
+}
+
+// EachWithdrawal читает списания пользователя страницами по ключу (updated_at, id) и передает их fn
+// по одному, не накапливая в памяти. Ошибка fn прекращает чтение и возвращается вызывающему.
+func (r *Database) EachWithdrawal(userID int, fn func(model.Transaction) error) error {
 	Getwithdrawals := `
-	SELECT order_number, amount, updated_at 
+	SELECT id, order_number, amount, updated_at, reversed_at
 	FROM transactions 
-	WHERE user_id = $1 AND transactions_type = $2
-    ORDER BY updated_at DESC`
+	WHERE user_id = $1 AND transactions_type = $2 AND ($3 OR (updated_at, id) < ($4, $5))
+    ORDER BY updated_at DESC, id DESC
+	LIMIT $6`
+
+	var lastAt time.Time
+	var lastID int
+	for first := true; ; first = false {
+		page, pageLastID, err := r.queryWithdrawals(Getwithdrawals, userID, model.Withdraw, first, lastAt, lastID, eachPageSize)
+		if err != nil {
+			return err
+		}
+		for _, withdrawal := range page {
+			if err := fn(withdrawal); err != nil {
+				return err
+			}
+		}
+		if len(page) < eachPageSize {
+			return nil
+		}
+		lastAt, lastID = page[len(page)-1].UpdatedAt, pageLastID
+	}
+}
 
-	rows, err := r.DB.Query(Getwithdrawals, userID, model.Withdraw)
+// queryWithdrawals читает страницу списаний и идентификатор последнего из них: в ответе API
+// идентификатор списания не выводится, но нужен как ключ следующей страницы
+func (r *Database) queryWithdrawals(query string, args ...any) ([]model.Transaction, int, error) {
+	rows, err := r.DB.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	var withdrawals []model.Transaction
+	var lastID int
 	for rows.Next() {
 		var withdrawal model.Transaction
-		err := rows.Scan(&withdrawal.OrderNumber, &withdrawal.Amount, &withdrawal.UpdatedAt)
+		var reversedAt sql.NullTime
+		err := rows.Scan(&lastID, &withdrawal.OrderNumber, &withdrawal.Amount, &withdrawal.UpdatedAt, &reversedAt)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
+		}
+		if reversedAt.Valid {
+			withdrawal.ReversedAt = &reversedAt.Time
 		}
 		withdrawals = append(withdrawals, withdrawal)
 	}
-	logging.Logg.Info("Got rows", "rows", withdrawals)
+	return withdrawals, lastID, rows.Err()
+}
+
+func (r *Database) GetOrderTransactions(userID int, orderNumber string) ([]model.Transaction, error) {
+	rows, err := r.DB.Query(`
+	SELECT id, order_number, amount, transactions_type, updated_at, reversed_at
+	FROM transactions
+	WHERE user_id = $1 AND order_number = $2
+	ORDER BY updated_at, id`, userID, orderNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []model.Transaction
+	for rows.Next() {
+		var transaction model.Transaction
+		var reversedAt sql.NullTime
+		err := rows.Scan(&transaction.ID, &transaction.OrderNumber, &transaction.Amount, &transaction.TransactionsType, &transaction.UpdatedAt, &reversedAt)
+		if err != nil {
+			return nil, err
+		}
+		if reversedAt.Valid {
+			transaction.ReversedAt = &reversedAt.Time
+		}
+		transactions = append(transactions, transaction)
+	}
+
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	logging.Logg.Info("Ok")
-	return withdrawals, nil
+	return transactions, nil
 }
 
-func (r *Database) UpdateOrder(orderNumber string, status string, accrual float32) error {
+// UpdateOrder сохраняет ответ системы расчёта по заказу и начисляет вознаграждение вместе с бонусами,
+// каждый бонус записывается отдельной транзакцией. Если заказ уже в финальном статусе,
+// ничего не меняет и возвращает ErrOrderFinal: пересмотр выполняет CorrectOrderAccrual.
+func (r *Database) UpdateOrder(orderNumber string, status string, accrual float32, terms model.AccrualTerms, bonuses ...model.Bonus) error {
 	tx, err := r.DB.Begin()
 	if err != nil {
 		return err
@@ -112,33 +216,107 @@ func (r *Database) UpdateOrder(orderNumber string, status string, accrual float3
 		}
 	}()
 
-	user, err := r.GetUserByOrderNumber(orderNumber)
+	// Статус проверяется под блокировкой заказа: повторно доставленный результат не начисляется дважды
+	user := &model.User{}
+	var current model.Status
+	err = tx.QueryRow(`
+	SELECT o.user_id, u.login, o.status
+	FROM orders o JOIN users u ON u.user_id = o.user_id
+	WHERE o.order_number = $1
+	FOR UPDATE OF o`, orderNumber).Scan(&user.ID, &user.Username, &current)
 	if err != nil {
-		logging.Logg.Error("Failed to commit transaction GetUserByOrderNumber", "error", ErrFailCommTrans)
+		if err == sql.ErrNoRows {
+			err = ErrOrderNotFound
+		}
 		return err
 	}
+	if current == model.StatusProcessed || current == model.StatusInvalid {
+		tx.Rollback()
+		return ErrOrderFinal
+	}
 
-	if accrual >= 0 {
+	if accrual > 0 {
+		now := time.Now()
 		_, err = tx.Exec("INSERT INTO transactions (user_id, order_number, amount, transactions_type, updated_at) VALUES ($1, $2, $3, $4, $5)",
-			user.ID, orderNumber, accrual, model.Accrual, time.Now())
+			user.ID, orderNumber, accrual, model.Accrual, now)
 		if err != nil {
 			logging.Logg.Error("Failed to commit transaction transactions", "error", ErrFailCommTrans)
 			return err
 		}
+		err = addLot(tx, user.ID, orderNumber, accrual, now, terms.ExpireAfterMonths)
+		if err != nil {
+			logging.Logg.Error("Failed to commit transaction point_lots", "error", ErrFailCommTrans)
+			return err
+		}
+	}
+
+	credited := accrual
+	for _, bonus := range bonuses {
+		if bonus.Amount <= 0 {
+			continue
+		}
+		now := time.Now()
+		_, err = tx.Exec("INSERT INTO transactions (user_id, order_number, amount, transactions_type, updated_at) VALUES ($1, $2, $3, $4, $5)",
+			user.ID, orderNumber, bonus.Amount, bonus.Type, now)
+		if err != nil {
+			return err
+		}
+		err = addLot(tx, user.ID, orderNumber, bonus.Amount, now, terms.ExpireAfterMonths)
+		if err != nil {
+			return err
+		}
+		credited += bonus.Amount
 	}
 
-	newBalance := user.Balance + accrual
-	_, err = tx.Exec("UPDATE users SET current_balance = $1 WHERE user_id = $2", newBalance, user.ID)
+	var balance float32
+	err = tx.QueryRow("UPDATE users SET current_balance = current_balance + $1 WHERE user_id = $2 RETURNING current_balance",
+		credited, user.ID).Scan(&balance)
 	if err != nil {
 		logging.Logg.Error("Failed to commit transaction users", "error", ErrFailCommTrans)
 		return err
 	}
-	_, err = tx.Exec("UPDATE orders SET accrual = $1, status = $2 WHERE order_number = $3", accrual, status, orderNumber)
+	_, err = tx.Exec(`UPDATE orders SET accrual = $1, status = $2, bonus = $5,
+		processed_at = CASE WHEN $2 IN ('PROCESSED', 'INVALID') THEN $4 ELSE processed_at END
+		WHERE order_number = $3`, accrual, status, orderNumber, time.Now(), credited-accrual)
 	if err != nil {
 		logging.Logg.Error("Failed to commit transaction orders", "error", ErrFailCommTrans)
 		return err
 	}
 
+	if model.Status(status) == model.StatusProcessed {
+		err = rewardReferral(tx, user, orderNumber, accrual, terms)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch model.Status(status) {
+	case model.StatusProcessed:
+		err = enqueueWebhook(tx, model.WebhookOrderProcessed, map[string]any{
+			"login":    user.Username,
+			"order":    orderNumber,
+			"accrual":  accrual,
+			"credited": credited,
+		})
+	case model.StatusInvalid:
+		err = enqueueWebhook(tx, model.WebhookOrderInvalid, map[string]any{
+			"login": user.Username,
+			"order": orderNumber,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if credited > 0 {
+		err = enqueueWebhook(tx, model.WebhookBalanceChanged, map[string]any{
+			"login":   user.Username,
+			"current": balance,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		logging.Logg.Error("Failed to commit transaction", "error", ErrFailCommTrans)
@@ -147,3 +325,105 @@ func (r *Database) UpdateOrder(orderNumber string, status string, accrual float3
 
 	return nil
 }
+
+// credit зачисляет amount пользователю внутри транзакции: запись в журнале, новая партия баллов,
+// изменение баланса и событие вебхука. Возвращает идентификатор записи в журнале.
+func credit(tx *sql.Tx, userID int, login, reference string, amount float32, ttype model.TType, expireAfterMonths int) (int, error) {
+	now := time.Now()
+	id, err := creditBalance(tx, userID, login, reference, amount, ttype, now)
+	if err != nil {
+		return 0, err
+	}
+	return id, addLot(tx, userID, reference, amount, now, expireAfterMonths)
+}
+
+// creditBalance зачисляет amount пользователю внутри транзакции без новой партии баллов:
+// партии зачисляемых баллов переносит вызывающий, сохраняя их срок жизни
+func creditBalance(tx *sql.Tx, userID int, login, reference string, amount float32, ttype model.TType, now time.Time) (int, error) {
+	var id int
+	err := tx.QueryRow("INSERT INTO transactions (user_id, order_number, amount, transactions_type, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		userID, reference, amount, ttype, now).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	var balance float32
+	err = tx.QueryRow("UPDATE users SET current_balance = current_balance + $1 WHERE user_id = $2 RETURNING current_balance",
+		amount, userID).Scan(&balance)
+	if err != nil {
+		return 0, err
+	}
+	return id, enqueueWebhook(tx, model.WebhookBalanceChanged, map[string]any{"login": login, "current": balance})
+}
+
+// debit списывает amount у пользователя внутри транзакции, расходуя старые партии.
+// Достаточность баланса проверяет вызывающий под блокировкой строки пользователя.
+func debit(tx *sql.Tx, userID int, login, reference string, amount float32, ttype model.TType) (int, error) {
+	var id int
+	err := tx.QueryRow("INSERT INTO transactions (user_id, order_number, amount, transactions_type, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		userID, reference, amount, ttype, time.Now()).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if err := consumeLots(tx, userID, id, amount); err != nil {
+		return 0, err
+	}
+
+	var balance float32
+	err = tx.QueryRow("UPDATE users SET current_balance = current_balance - $1 WHERE user_id = $2 RETURNING current_balance",
+		amount, userID).Scan(&balance)
+	if err != nil {
+		return 0, err
+	}
+	return id, enqueueWebhook(tx, model.WebhookBalanceChanged, map[string]any{"login": login, "current": balance})
+}
+
+// debitTypes — типы списаний для параметра запроса = ANY($n)
+func debitTypes() []string {
+	types := make([]string, len(model.DebitTypes))
+	for i, t := range model.DebitTypes {
+		types[i] = string(t)
+	}
+	return types
+}
+
+// GetBalanceAt возвращает баланс пользователя по журналу транзакций на момент at
+func (r *Database) GetBalanceAt(userID int, at time.Time) (float32, error) {
+	var balance float32
+	err := r.DB.QueryRow(`
+	SELECT COALESCE(SUM(CASE WHEN transactions_type = ANY($3) THEN -amount ELSE amount END), 0)
+	FROM transactions
+	WHERE user_id = $1 AND updated_at < $2`, userID, at, debitTypes()).Scan(&balance)
+	if err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+// GetTransactionsBetween возвращает все операции пользователя в интервале [from, to) в порядке проведения
+func (r *Database) GetTransactionsBetween(userID int, from, to time.Time) ([]model.Transaction, error) {
+	rows, err := r.DB.Query(`
+	SELECT id, order_number, amount, transactions_type, updated_at
+	FROM transactions
+	WHERE user_id = $1 AND updated_at >= $2 AND updated_at < $3
+	ORDER BY updated_at, id`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []model.Transaction
+	for rows.Next() {
+		var transaction model.Transaction
+		err := rows.Scan(&transaction.ID, &transaction.OrderNumber, &transaction.Amount, &transaction.TransactionsType, &transaction.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
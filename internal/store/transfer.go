@@ -0,0 +1,340 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"time"
+)
+
+var (
+	ErrSelfTransfer     = errors.New("cannot transfer points to yourself")
+	ErrTransferLimit    = errors.New("daily transfer limit exceeded")
+	ErrTransferNotFound = errors.New("transfer not found")
+)
+
+// lockUsers блокирует строки пользователей в порядке возрастания идентификатора, чтобы встречные переводы
+// не приводили к взаимной блокировке. Возвращает балансы по идентификаторам.
+func lockUsers(tx *sql.Tx, ids ...int) (map[int]float32, error) {
+	rows, err := tx.Query("SELECT user_id, current_balance FROM users WHERE user_id = ANY($1) ORDER BY user_id FOR UPDATE", ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := make(map[int]float32, len(ids))
+	for rows.Next() {
+		var id int
+		var balance float32
+		if err := rows.Scan(&id, &balance); err != nil {
+			return nil, err
+		}
+		balances[id] = balance
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(balances) != len(ids) {
+		return nil, ErrUserNotFound
+	}
+	return balances, nil
+}
+
+// CreateTransfer переводит amount от from к пользователю с логином toLogin.
+// При confirmTTL > 0 баллы списываются у отправителя сразу, а зачисляются после подтверждения получателем;
+// не подтвержденный за confirmTTL перевод отклоняет ExpireTransfers. При confirmTTL = 0 перевод зачисляется сразу.
+// dailyLimit ограничивает сумму переводов отправителя за текущие сутки, 0 — без ограничения.
+// Перевод учитывается в ограничениях списаний отправителя наравне со списаниями.
+func (r *Database) CreateTransfer(from *model.User, toLogin string, amount, dailyLimit float32, confirmTTL time.Duration, limits model.WithdrawalLimits) (*model.Transfer, error) {
+	to, err := r.GetUserByLogin(toLogin)
+	if err != nil {
+		return nil, err
+	}
+	if to.ID == from.ID {
+		return nil, ErrSelfTransfer
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			logging.Logg.Error("Failed to commit transaction", "error", err)
+		}
+	}()
+
+	balances, err := lockUsers(tx, from.ID, to.ID)
+	if err != nil {
+		return nil, err
+	}
+	held, err := heldAmount(tx, from.ID)
+	if err != nil {
+		return nil, err
+	}
+	if amount > balances[from.ID]-held {
+		err = ErrInsufficientFunds
+		return nil, err
+	}
+
+	err = checkWithdrawalLimits(tx, from.ID, amount, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	if dailyLimit > 0 {
+		var sent float32
+		err = tx.QueryRow(`SELECT COALESCE(SUM(amount), 0) FROM transfers
+			WHERE from_user_id = $1 AND status <> $2 AND created_at >= $3`,
+			from.ID, model.TransferDeclined, dayStart(time.Now())).Scan(&sent)
+		if err != nil {
+			return nil, err
+		}
+		if sent+amount > dailyLimit {
+			err = ErrTransferLimit
+			return nil, err
+		}
+	}
+
+	confirm := confirmTTL > 0
+	transfer := &model.Transfer{From: from.Username, To: to.Username, Amount: amount, Status: model.TransferPending}
+	if confirm {
+		expiresAt := time.Now().Add(confirmTTL)
+		transfer.ExpiresAt = &expiresAt
+	} else {
+		transfer.Status = model.TransferCompleted
+	}
+	err = tx.QueryRow(`INSERT INTO transfers (from_user_id, to_user_id, amount, status, expires_at) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`, from.ID, to.ID, amount, transfer.Status, transfer.ExpiresAt).Scan(&transfer.ID, &transfer.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	outID, err := debit(tx, from.ID, from.Username, transfer.Reference(), amount, model.TransferOut)
+	if err != nil {
+		return nil, err
+	}
+	if !confirm {
+		if _, err = creditBalance(tx, to.ID, to.Username, transfer.Reference(), amount, model.TransferIn, time.Now()); err != nil {
+			return nil, err
+		}
+		if err = moveLots(tx, outID, to.ID, transfer.Reference()); err != nil {
+			return nil, err
+		}
+		completedAt := transfer.CreatedAt
+		transfer.CompletedAt = &completedAt
+		_, err = tx.Exec("UPDATE transfers SET completed_at = created_at WHERE id = $1", transfer.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// ResolveTransfer подтверждает или отклоняет ожидающий перевод получателем recipientID.
+// При отказе баллы возвращаются отправителю. Просроченный перевод не может быть подтвержден.
+func (r *Database) ResolveTransfer(transferID, recipientID int, accept bool) (*model.Transfer, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			logging.Logg.Error("Failed to commit transaction", "error", err)
+		}
+	}()
+
+	transfer, fromID, toID, err := lockPendingTransfer(tx, `t.id = $2 AND t.to_user_id = $3 AND t.expires_at > $4`,
+		transferID, recipientID, time.Now())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrTransferNotFound
+		}
+		return nil, err
+	}
+	if err = settleTransfer(tx, transfer, fromID, toID, accept); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// ExpireTransfers отклоняет ожидающие переводы, срок подтверждения которых истек к now, и возвращает
+// идентификаторы отправителей, которым вернулись баллы. Каждый перевод отклоняется в отдельной транзакции,
+// чтобы блокировки пользователей брались в том же порядке, что и при переводах.
+func (r *Database) ExpireTransfers(now time.Time) ([]int, error) {
+	rows, err := r.DB.Query("SELECT id FROM transfers WHERE status = $1 AND expires_at <= $2 ORDER BY id",
+		model.TransferPending, now)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	var userIDs []int
+	for _, id := range ids {
+		fromID, err := r.expireTransfer(id, now)
+		if err != nil {
+			return userIDs, err
+		}
+		if fromID != 0 && !seen[fromID] {
+			seen[fromID] = true
+			userIDs = append(userIDs, fromID)
+		}
+	}
+	return userIDs, nil
+}
+
+// expireTransfer отклоняет просроченный перевод и возвращает отправителя; 0 — перевод уже разрешен
+func (r *Database) expireTransfer(transferID int, now time.Time) (int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			logging.Logg.Error("Failed to commit transaction", "error", err)
+		}
+	}()
+
+	transfer, fromID, toID, err := lockPendingTransfer(tx, `t.id = $2 AND t.expires_at <= $3`, transferID, now)
+	if err == sql.ErrNoRows {
+		err = nil
+		tx.Rollback()
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err = settleTransfer(tx, transfer, fromID, toID, false); err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return fromID, nil
+}
+
+// lockPendingTransfer блокирует ожидающий перевод, подходящий под условие cond;
+// параметры условия нумеруются с $2, $1 занят статусом
+func lockPendingTransfer(tx *sql.Tx, cond string, args ...any) (*model.Transfer, int, int, error) {
+	var transfer model.Transfer
+	var fromID, toID int
+	var expiresAt sql.NullTime
+	args = append([]any{model.TransferPending}, args...)
+	err := tx.QueryRow(`
+	SELECT t.id, t.from_user_id, f.login, t.to_user_id, u.login, t.amount, t.status, t.created_at, t.expires_at
+	FROM transfers t
+	JOIN users f ON f.user_id = t.from_user_id
+	JOIN users u ON u.user_id = t.to_user_id
+	WHERE t.status = $1 AND `+cond+`
+	FOR UPDATE OF t`, args...).
+		Scan(&transfer.ID, &fromID, &transfer.From, &toID, &transfer.To, &transfer.Amount, &transfer.Status, &transfer.CreatedAt, &expiresAt)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if expiresAt.Valid {
+		transfer.ExpiresAt = &expiresAt.Time
+	}
+	return &transfer, fromID, toID, nil
+}
+
+// settleTransfer зачисляет заблокированный ожидающий перевод получателю или возвращает его отправителю
+func settleTransfer(tx *sql.Tx, transfer *model.Transfer, fromID, toID int, accept bool) error {
+	if _, err := lockUsers(tx, fromID, toID); err != nil {
+		return err
+	}
+	var outID int
+	err := tx.QueryRow("SELECT id FROM transactions WHERE user_id = $1 AND order_number = $2 AND transactions_type = $3",
+		fromID, transfer.Reference(), model.TransferOut).Scan(&outID)
+	if err != nil {
+		return err
+	}
+
+	// Получатель получает партии отправителя с их сроком жизни, при отказе партии возвращаются отправителю
+	completedAt := time.Now()
+	if accept {
+		transfer.Status = model.TransferCompleted
+		_, err = creditBalance(tx, toID, transfer.To, transfer.Reference(), transfer.Amount, model.TransferIn, completedAt)
+		if err == nil {
+			err = moveLots(tx, outID, toID, transfer.Reference())
+		}
+	} else {
+		transfer.Status = model.TransferDeclined
+		_, err = creditBalance(tx, fromID, transfer.From, transfer.Reference(), transfer.Amount, model.TransferIn, completedAt)
+		if err == nil {
+			err = restoreLots(tx, outID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	transfer.CompletedAt = &completedAt
+	_, err = tx.Exec("UPDATE transfers SET status = $1, completed_at = $2 WHERE id = $3", transfer.Status, completedAt, transfer.ID)
+	return err
+}
+
+// GetTransfers возвращает входящие и исходящие переводы пользователя
+func (r *Database) GetTransfers(userID int) ([]model.Transfer, error) {
+	rows, err := r.DB.Query(`
+	SELECT t.id, f.login, u.login, t.amount, t.status, t.created_at, t.expires_at, t.completed_at
+	FROM transfers t
+	JOIN users f ON f.user_id = t.from_user_id
+	JOIN users u ON u.user_id = t.to_user_id
+	WHERE t.from_user_id = $1 OR t.to_user_id = $1
+	ORDER BY t.created_at DESC, t.id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []model.Transfer
+	for rows.Next() {
+		var transfer model.Transfer
+		var expiresAt, completedAt sql.NullTime
+		err := rows.Scan(&transfer.ID, &transfer.From, &transfer.To, &transfer.Amount, &transfer.Status, &transfer.CreatedAt, &expiresAt, &completedAt)
+		if err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			transfer.ExpiresAt = &expiresAt.Time
+		}
+		if completedAt.Valid {
+			transfer.CompletedAt = &completedAt.Time
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"errors"
+	"gopher-market/internal/model"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTransferLedger(t *testing.T) {
+	r := newTestDB(t)
+	alice, bob := newTestUser(t, r), newTestUser(t, r)
+	accrueTestPoints(t, r, alice, "accrual", 100, time.Now().Add(-time.Hour), 6)
+
+	// Без подтверждения баллы сразу переходят к получателю вместе со сроком жизни партии
+	transfer, err := r.CreateTransfer(alice, bob.Username, 30, 0, 0, model.WithdrawalLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer.Status != model.TransferCompleted || transfer.ExpiresAt != nil {
+		t.Errorf("Expected a completed transfer, got %+v", transfer)
+	}
+	a, b := readLedger(t, r, alice), readLedger(t, r, bob)
+	if a.Balance != 70 || !slices.Equal(a.remaining(), []float32{70}) || a.last(t).Type != model.TransferOut {
+		t.Errorf("Unexpected sender ledger %+v", a)
+	}
+	if b.Balance != 30 || len(b.Lots) != 1 || b.Lots[0].Remaining != 30 || !b.Lots[0].Expires || b.last(t).Type != model.TransferIn {
+		t.Errorf("Unexpected recipient ledger %+v", b)
+	}
+
+	if _, err := r.CreateTransfer(alice, alice.Username, 10, 0, 0, model.WithdrawalLimits{}); !errors.Is(err, ErrSelfTransfer) {
+		t.Errorf("Expected ErrSelfTransfer, got %v", err)
+	}
+	if _, err := r.CreateTransfer(alice, bob.Username, 80, 0, 0, model.WithdrawalLimits{}); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("Expected ErrInsufficientFunds, got %v", err)
+	}
+}
+
+func TestResolveTransfer(t *testing.T) {
+	r := newTestDB(t)
+	alice, bob := newTestUser(t, r), newTestUser(t, r)
+	accrueTestPoints(t, r, alice, "accrual", 100, time.Now().Add(-time.Hour), 0)
+
+	pending := func(amount float32, ttl time.Duration) *model.Transfer {
+		t.Helper()
+		transfer, err := r.CreateTransfer(alice, bob.Username, amount, 0, ttl, model.WithdrawalLimits{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if transfer.Status != model.TransferPending || transfer.ExpiresAt == nil {
+			t.Fatalf("Expected a pending transfer with expiry, got %+v", transfer)
+		}
+		return transfer
+	}
+
+	// Ожидающий перевод списан у отправителя, но не зачислен получателю
+	accepted := pending(20, time.Hour)
+	if a, b := readLedger(t, r, alice), readLedger(t, r, bob); a.Balance != 80 || b.Balance != 0 || len(b.Transactions) != 0 {
+		t.Errorf("Unexpected ledgers of a pending transfer: %+v, %+v", a, b)
+	}
+	if _, err := r.ResolveTransfer(accepted.ID, alice.ID, true); !errors.Is(err, ErrTransferNotFound) {
+		t.Errorf("Expected only the recipient to resolve the transfer, got %v", err)
+	}
+	if _, err := r.ResolveTransfer(accepted.ID, bob.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if b := readLedger(t, r, bob); b.Balance != 20 || !slices.Equal(b.remaining(), []float32{20}) || b.last(t).Type != model.TransferIn {
+		t.Errorf("Unexpected recipient ledger after accept: %+v", b)
+	}
+	if _, err := r.ResolveTransfer(accepted.ID, bob.ID, false); !errors.Is(err, ErrTransferNotFound) {
+		t.Errorf("Expected a resolved transfer not to be resolved again, got %v", err)
+	}
+
+	// Отказ возвращает баллы отправителю в его партии
+	declined := pending(10, time.Hour)
+	if _, err := r.ResolveTransfer(declined.ID, bob.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	a := readLedger(t, r, alice)
+	if a.Balance != 80 || !slices.Equal(a.remaining(), []float32{80}) || a.last(t).Type != model.TransferIn {
+		t.Errorf("Unexpected sender ledger after decline: %+v", a)
+	}
+
+	// Просроченный перевод нельзя принять, его отклоняет ExpireTransfers
+	expired := pending(5, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	if _, err := r.ResolveTransfer(expired.ID, bob.ID, true); !errors.Is(err, ErrTransferNotFound) {
+		t.Errorf("Expected an expired transfer not to be accepted, got %v", err)
+	}
+	userIDs, err := r.ExpireTransfers(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(userIDs, alice.ID) {
+		t.Errorf("Expected sender %d among users %v", alice.ID, userIDs)
+	}
+	if a := readLedger(t, r, alice); a.Balance != 80 || !slices.Equal(a.remaining(), []float32{80}) {
+		t.Errorf("Unexpected sender ledger after expiry: %+v", a)
+	}
+	transfers, err := r.GetTransfers(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := make(map[int]model.TransferStatus)
+	for _, transfer := range transfers {
+		statuses[transfer.ID] = transfer.Status
+	}
+	if statuses[accepted.ID] != model.TransferCompleted || statuses[declined.ID] != model.TransferDeclined || statuses[expired.ID] != model.TransferDeclined {
+		t.Errorf("Unexpected transfer statuses %v", statuses)
+	}
+
+	// Отклоненные переводы не учитываются в суточном ограничении: за сутки отправлено 20
+	if _, err := r.CreateTransfer(alice, bob.Username, 15, 30, 0, model.WithdrawalLimits{}); !errors.Is(err, ErrTransferLimit) {
+		t.Errorf("Expected ErrTransferLimit, got %v", err)
+	}
+	if _, err := r.CreateTransfer(alice, bob.Username, 10, 30, 0, model.WithdrawalLimits{}); err != nil {
+		t.Errorf("Expected a transfer within the daily limit, got %v", err)
+	}
+}
@@ -17,16 +17,66 @@ func NewUserDB(db *sql.DB) *UserDB {
 	return &UserDB{Db: db}
 }*/
 
-func (r *Database) CreateUser(login, passwordHash string) (int, error) {
-	createUser := `INSERT INTO users(login, password_hash) VALUES ($1, $2) RETURNING user_id`
+// referralCodeAttempts — сколько раз CreateUser генерирует новый код, если он уже занят
+const referralCodeAttempts = 5
+
+// CreateUser регистрирует пользователя с новым реферальным кодом.
+// referrerID — пригласивший пользователь, 0 если регистрация без приглашения.
+func (r *Database) CreateUser(login, passwordHash string, referrerID int) (int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	createUser := `INSERT INTO users(login, password_hash, referral_code) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING RETURNING user_id`
 
 	var id int
+	for attempt := 1; ; attempt++ {
+		var code string
+		code, err = newReferralCode()
+		if err != nil {
+			return 0, err
+		}
+		err = tx.QueryRow(createUser, login, passwordHash, code).Scan(&id)
+		if err != sql.ErrNoRows {
+			break
+		}
 
-	err := r.DB.QueryRow(createUser, login, passwordHash).Scan(&id)
+		// Строка не вставлена: занят либо логин, либо сгенерированный код
+		var loginTaken bool
+		err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE login = $1)", login).Scan(&loginTaken)
+		if err != nil {
+			return 0, err
+		}
+		if loginTaken {
+			err = ErrDuplicate
+			return 0, err
+		}
+		if attempt == referralCodeAttempts {
+			err = ErrReferralCodeCollision
+			return 0, err
+		}
+	}
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, ErrDuplicate
+		return 0, err
+	}
+
+	if referrerID != 0 {
+		_, err = tx.Exec("INSERT INTO referrals (referrer_id, referee_id, status) VALUES ($1, $2, $3)",
+			referrerID, id, model.ReferralPending)
+		if err != nil {
+			return 0, err
 		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
 		return 0, err
 	}
 	return id, nil
@@ -34,8 +84,8 @@ func (r *Database) CreateUser(login, passwordHash string) (int, error) {
 
 func (r *Database) GetUserByLogin(username string) (*model.User, error) {
 	var user model.User
-	err := r.DB.QueryRow("SELECT user_id, login, password_hash, current_balance FROM users WHERE login = $1", username).
-		Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Balance)
+	err := r.DB.QueryRow("SELECT user_id, login, password_hash, current_balance, tier FROM users WHERE login = $1", username).
+		Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Balance, &user.Tier)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
@@ -47,8 +97,8 @@ func (r *Database) GetUserByLogin(username string) (*model.User, error) {
 
 func (r *Database) GetUserByID(id int) (*model.User, error) {
 	var user model.User
-	err := r.DB.QueryRow("SELECT user_id, login, password_hash, current_balance FROM users WHERE user_id = $1", id).
-		Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Balance)
+	err := r.DB.QueryRow("SELECT user_id, login, password_hash, current_balance, tier FROM users WHERE user_id = $1", id).
+		Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Balance, &user.Tier)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
@@ -57,3 +107,26 @@ func (r *Database) GetUserByID(id int) (*model.User, error) {
 	}
 	return &user, nil
 }
+
+// GetUsers возвращает всех пользователей без хэшей паролей
+func (r *Database) GetUsers() ([]model.User, error) {
+	rows, err := r.DB.Query("SELECT user_id, login, current_balance, tier FROM users ORDER BY user_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		var user model.User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Balance, &user.Tier); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
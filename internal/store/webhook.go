@@ -0,0 +1,218 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"gopher-market/internal/model"
+	"strings"
+	"time"
+)
+
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+	ErrLeaseLost       = errors.New("webhook delivery was claimed again or resolved by another dispatcher")
+)
+
+func (r *Database) CreateWebhookEndpoint(endpoint *model.WebhookEndpoint) error {
+	return r.DB.QueryRow(`INSERT INTO webhook_endpoints (url, secret, events, active) VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`, endpoint.URL, endpoint.Secret, endpoint.Events, endpoint.Active).
+		Scan(&endpoint.ID, &endpoint.CreatedAt)
+}
+
+func (r *Database) GetWebhookEndpoints() ([]model.WebhookEndpoint, error) {
+	rows, err := r.DB.Query(`
+	SELECT id, url, array_to_string(events, ','), active, created_at
+	FROM webhook_endpoints
+	ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []model.WebhookEndpoint{}
+	for rows.Next() {
+		var endpoint model.WebhookEndpoint
+		var events string
+		err := rows.Scan(&endpoint.ID, &endpoint.URL, &events, &endpoint.Active, &endpoint.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		endpoint.Events = strings.Split(events, ",")
+		endpoints = append(endpoints, endpoint)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+func (r *Database) DeleteWebhookEndpoint(id int) error {
+	res, err := r.DB.Exec("DELETE FROM webhook_endpoints WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// enqueueWebhook записывает событие в исходящую очередь для каждой активной подписки.
+// Вызывается внутри транзакции, изменившей данные, поэтому событие не теряется и не отправляется при откате.
+func enqueueWebhook(tx *sql.Tx, eventType string, data any) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(model.WebhookEvent{
+		ID:        hex.EncodeToString(id),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO webhook_deliveries (endpoint_id, event_type, payload)
+		SELECT id, $1, $2 FROM webhook_endpoints WHERE active AND $1 = ANY(events)`, eventType, payload)
+	return err
+}
+
+// ClaimWebhookDeliveries выбирает доставки, время попытки которых наступило, и откладывает их на lease,
+// чтобы другие реплики не отправили их повторно
+func (r *Database) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	rows, err := r.DB.Query(`
+	UPDATE webhook_deliveries d
+	SET next_attempt_at = $1
+	FROM webhook_endpoints e
+	WHERE e.id = d.endpoint_id AND d.id IN (
+		SELECT id FROM webhook_deliveries
+		WHERE status = $2 AND next_attempt_at <= $3
+		ORDER BY next_attempt_at
+		LIMIT $4
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING d.id, d.endpoint_id, e.url, e.secret, d.event_type, d.payload, d.status, d.attempts, d.created_at`,
+		time.Now().Add(lease), model.WebhookPending, time.Now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		var d model.WebhookDelivery
+		var payload []byte
+		err := rows.Scan(&d.ID, &d.EndpointID, &d.URL, &d.Secret, &d.EventType, &payload, &d.Status, &d.Attempts, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		d.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered фиксирует успешную попытку. attempts — счетчик попыток на момент выборки:
+// если доставку за это время снова выбрала другая реплика или она уже закрыта, возвращается ErrLeaseLost.
+func (r *Database) MarkWebhookDelivered(id, attempts, statusCode int) error {
+	res, err := r.DB.Exec(`UPDATE webhook_deliveries
+		SET status = $1, attempts = attempts + 1, last_status_code = $2, last_error = '', delivered_at = $3
+		WHERE id = $4 AND attempts = $5 AND status = $6`,
+		model.WebhookDelivered, statusCode, time.Now(), id, attempts, model.WebhookPending)
+	if err != nil {
+		return err
+	}
+	return leaseHeld(res)
+}
+
+// MarkWebhookFailed фиксирует неудачную попытку; при dead доставка попадает в очередь недоставленных.
+// attempts проверяется так же, как в MarkWebhookDelivered.
+func (r *Database) MarkWebhookFailed(id, attempts, statusCode int, lastError string, nextAttempt time.Time, dead bool) error {
+	status := model.WebhookPending
+	if dead {
+		status = model.WebhookDeadLetter
+	}
+	res, err := r.DB.Exec(`UPDATE webhook_deliveries
+		SET status = $1, attempts = attempts + 1, last_status_code = $2, last_error = $3, next_attempt_at = $4
+		WHERE id = $5 AND attempts = $6 AND status = $7`,
+		status, statusCode, lastError, nextAttempt, id, attempts, model.WebhookPending)
+	if err != nil {
+		return err
+	}
+	return leaseHeld(res)
+}
+
+func leaseHeld(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (r *Database) GetDeadWebhookDeliveries(limit int) ([]model.WebhookDelivery, error) {
+	rows, err := r.DB.Query(`
+	SELECT d.id, d.endpoint_id, e.url, d.event_type, d.payload, d.status, d.attempts,
+		d.last_error, d.last_status_code, d.next_attempt_at, d.created_at
+	FROM webhook_deliveries d JOIN webhook_endpoints e ON e.id = d.endpoint_id
+	WHERE d.status = $1
+	ORDER BY d.id DESC
+	LIMIT $2`, model.WebhookDeadLetter, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []model.WebhookDelivery{}
+	for rows.Next() {
+		var d model.WebhookDelivery
+		var payload []byte
+		err := rows.Scan(&d.ID, &d.EndpointID, &d.URL, &d.EventType, &payload, &d.Status, &d.Attempts,
+			&d.LastError, &d.LastStatusCode, &d.NextAttemptAt, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		d.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// RetryWebhookDelivery возвращает недоставленное событие в очередь с обнуленным счетчиком попыток
+func (r *Database) RetryWebhookDelivery(id int) error {
+	res, err := r.DB.Exec(`UPDATE webhook_deliveries
+		SET status = $1, attempts = 0, next_attempt_at = $2
+		WHERE id = $3 AND status = $4`, model.WebhookPending, time.Now(), id, model.WebhookDeadLetter)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package tier
+
+import (
+	"errors"
+	"fmt"
+	"gopher-market/internal/model"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultSpec — уровень по умолчанию в формате name:threshold:multiplier[:bonus]:
+// один нейтральный уровень, надбавки включаются только явной настройкой.
+const DefaultSpec = "bronze:0:1"
+
+// ExampleSpec — пример нескольких уровней с повышенными множителями
+const ExampleSpec = "bronze:0:1,silver:1000:1.1,gold:5000:1.25"
+
+var ErrEmptySpec = errors.New("tier specification is empty")
+
+// Parse разбирает описание уровней через запятую, например "bronze:0:1,silver:1000:1.1:5".
+// Уровни сортируются по порогу, самый низкий порог обязан быть нулевым.
+func Parse(spec string) ([]model.Tier, error) {
+	var tiers []model.Tier
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		if len(fields) != 3 && len(fields) != 4 {
+			return nil, fmt.Errorf("invalid tier %q: expected name:threshold:multiplier[:bonus]", part)
+		}
+
+		t := model.Tier{Name: fields[0]}
+		if t.Name == "" {
+			return nil, fmt.Errorf("invalid tier %q: empty name", part)
+		}
+		values := make([]float32, 0, 3)
+		for _, f := range fields[1:] {
+			v, err := strconv.ParseFloat(f, 32)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("invalid tier %q: bad number %q", part, f)
+			}
+			values = append(values, float32(v))
+		}
+		t.Threshold, t.Multiplier = values[0], values[1]
+		if len(values) == 3 {
+			t.Bonus = values[2]
+		}
+		tiers = append(tiers, t)
+	}
+
+	if len(tiers) == 0 {
+		return nil, ErrEmptySpec
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].Threshold < tiers[j].Threshold })
+	if tiers[0].Threshold != 0 {
+		return nil, fmt.Errorf("lowest tier %q must have zero threshold", tiers[0].Name)
+	}
+	return tiers, nil
+}
+
+// ForPoints возвращает уровень, соответствующий сумме начислений за окно
+func ForPoints(tiers []model.Tier, points float32) model.Tier {
+	current := tiers[0]
+	for _, t := range tiers {
+		if points >= t.Threshold {
+			current = t
+		}
+	}
+	return current
+}
+
+// Find возвращает уровень по названию; неизвестное или пустое название соответствует базовому уровню
+func Find(tiers []model.Tier, name string) model.Tier {
+	for _, t := range tiers {
+		if t.Name == name {
+			return t
+		}
+	}
+	return tiers[0]
+}
+
+// Bonus рассчитывает надбавку уровня к вознаграждению системы расчёта
+func Bonus(t model.Tier, accrual float32) float32 {
+	if accrual <= 0 {
+		return 0
+	}
+	bonus := accrual*(t.Multiplier-1) + t.Bonus
+	if bonus < 0 {
+		return 0
+	}
+	return bonus
+}
@@ -0,0 +1,69 @@
+package tier
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("Sorted by threshold", func(t *testing.T) {
+		tiers, err := Parse("gold:5000:1.5, bronze:0:1, silver:1000:1.2:10")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(tiers) != 3 || tiers[0].Name != "bronze" || tiers[1].Name != "silver" || tiers[2].Name != "gold" {
+			t.Fatalf("Unexpected tiers: %+v", tiers)
+		}
+		if tiers[1].Bonus != 10 {
+			t.Errorf("Expected silver bonus 10, got %v", tiers[1].Bonus)
+		}
+	})
+
+	t.Run("Lowest threshold must be zero", func(t *testing.T) {
+		if _, err := Parse("silver:1000:1.2"); err == nil {
+			t.Error("Expected error for non-zero lowest threshold")
+		}
+	})
+
+	t.Run("Invalid format", func(t *testing.T) {
+		for _, spec := range []string{"", "bronze:0", "bronze:x:1", ":0:1", "bronze:0:-1"} {
+			if _, err := Parse(spec); err == nil {
+				t.Errorf("Expected error for %q", spec)
+			}
+		}
+	})
+}
+
+func TestForPointsAndBonus(t *testing.T) {
+	tiers, err := Parse(ExampleSpec)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := ForPoints(tiers, 999).Name; got != "bronze" {
+		t.Errorf("Expected bronze for 999 points, got %s", got)
+	}
+	if got := ForPoints(tiers, 1000).Name; got != "silver" {
+		t.Errorf("Expected silver for 1000 points, got %s", got)
+	}
+	if got := Find(tiers, "").Name; got != "bronze" {
+		t.Errorf("Expected base tier for empty name, got %s", got)
+	}
+
+	gold := Find(tiers, "gold")
+	if got := Bonus(gold, 100); got != 25 {
+		t.Errorf("Expected gold bonus 25, got %v", got)
+	}
+	if got := Bonus(gold, 0); got != 0 {
+		t.Errorf("Expected no bonus without accrual, got %v", got)
+	}
+}
+
+func TestDefaultSpecIsNeutral(t *testing.T) {
+	tiers, err := Parse(DefaultSpec)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tiers) != 1 || tiers[0].Multiplier != 1 || tiers[0].Bonus != 0 {
+		t.Errorf("Expected a single neutral tier, got %+v", tiers)
+	}
+}
@@ -0,0 +1,181 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"gopher-market/internal/logging"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReloadInterval — как часто проверяется, не изменились ли файлы сертификата и ключа
+const ReloadInterval = 30 * time.Second
+
+var (
+	ErrMinVersion = errors.New("tls min version must be 1.2 or 1.3")
+	ErrNoCerts    = errors.New("no certificates found in CA file")
+)
+
+// cipherSuites — наборы шифров для TLS 1.2: только ECDHE с AEAD. В TLS 1.3 наборы не настраиваются.
+var cipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// ParseVersion разбирает минимальную версию TLS: 1.2 или 1.3
+func ParseVersion(v string) (uint16, error) {
+	switch v {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, ErrMinVersion
+}
+
+// LoadCertPool читает PEM-файл с сертификатами удостоверяющих центров
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: %s", ErrNoCerts, file)
+	}
+	return pool, nil
+}
+
+// Reloader хранит пару сертификат/ключ и перечитывает ее, когда файлы меняются,
+// чтобы обновленный сертификат подхватывался без перезапуска
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewReloader загружает пару сертификат/ключ; ошибка загрузки при запуске фатальна
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *Reloader) reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// Watch перечитывает сертификат при изменении файлов до отмены ctx. Если новая пара не загружается,
+// например ключ еще не записан, продолжает использоваться прежний сертификат.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modTime, err := r.latestModTime()
+			if err != nil {
+				logging.Logg.Error("Failed to stat certificate", "cert", r.certFile, "error", err)
+				continue
+			}
+			r.mu.RLock()
+			changed := modTime.After(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				logging.Logg.Error("Failed to reload certificate", "cert", r.certFile, "error", err)
+				continue
+			}
+			logging.Logg.Info("Certificate reloaded", "cert", r.certFile)
+		}
+	}
+}
+
+func (r *Reloader) certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// GetCertificate подходит для tls.Config.GetCertificate сервера
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.certificate(), nil
+}
+
+// GetClientCertificate подходит для tls.Config.GetClientCertificate клиента
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.certificate(), nil
+}
+
+// Server собирает конфигурацию сервера. Если задан clientCAs, клиентский сертификат проверяется,
+// когда клиент его предъявляет; обязательность сертификата для отдельных маршрутов проверяет middleware.
+func Server(cert *Reloader, minVersion uint16, clientCAs *x509.CertPool) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		GetCertificate: cert.GetCertificate,
+	}
+	if clientCAs != nil {
+		cfg.ClientCAs = clientCAs
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg
+}
+
+// Client собирает конфигурацию клиента: rootCAs заменяет системные корневые сертификаты,
+// cert предъявляется серверу для mTLS. Оба параметра необязательны.
+func Client(cert *Reloader, minVersion uint16, rootCAs *x509.CertPool) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+		RootCAs:      rootCAs,
+	}
+	if cert != nil {
+		cfg.GetClientCertificate = cert.GetClientCertificate
+	}
+	return cfg
+}
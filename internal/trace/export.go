@@ -0,0 +1,88 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"maps"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Exporter получает завершенные спаны
+type Exporter interface {
+	Export(s *Span)
+}
+
+var exporter atomic.Pointer[Exporter]
+
+// SetExporter задает экспортер спанов; nil отключает экспорт, идентификаторы при этом продолжают создаваться
+func SetExporter(e Exporter) {
+	if e == nil {
+		exporter.Store(nil)
+		return
+	}
+	exporter.Store(&e)
+}
+
+func getExporter() Exporter {
+	if e := exporter.Load(); e != nil {
+		return *e
+	}
+	return nil
+}
+
+// WriterExporter пишет спаны в w построчно в формате JSON
+type WriterExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{enc: json.NewEncoder(w)}
+}
+
+// Open создает экспортер по назначению dest: stdout или путь к файлу, в конец которого дописываются спаны
+func Open(dest string) (*WriterExporter, io.Closer, error) {
+	if dest == "stdout" {
+		return NewWriterExporter(os.Stdout), io.NopCloser(nil), nil
+	}
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewWriterExporter(f), f, nil
+}
+
+type spanRecord struct {
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Name       string         `json:"name"`
+	Start      time.Time      `json:"start"`
+	DurationMS float64        `json:"duration_ms"`
+	Attrs      map[string]any `json:"attrs,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+func (e *WriterExporter) Export(s *Span) {
+	s.mu.Lock()
+	rec := spanRecord{
+		TraceID:    s.Context.TraceID.String(),
+		SpanID:     s.Context.SpanID.String(),
+		Name:       s.Name,
+		Start:      s.Start,
+		DurationMS: float64(s.End.Sub(s.Start).Microseconds()) / 1000,
+		Attrs:      maps.Clone(s.Attrs),
+		Error:      s.Error,
+	}
+	if s.ParentID != (SpanID{}) {
+		rec.ParentID = s.ParentID.String()
+	}
+	s.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enc.Encode(rec)
+}
@@ -0,0 +1,199 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func (t TraceID) IsZero() bool { return t == TraceID{} }
+
+var ErrTraceparent = errors.New("invalid traceparent header")
+
+// SpanContext — идентификаторы, которые передаются между сервисами в заголовке traceparent
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return !sc.TraceID.IsZero() && sc.SpanID != SpanID{}
+}
+
+// Traceparent форматирует идентификаторы по W3C Trace Context: 00-<trace-id>-<span-id>-<flags>
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent разбирает заголовок traceparent версии 00
+func ParseTraceparent(h string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, ErrTraceparent
+	}
+
+	var sc SpanContext
+	var flags [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, ErrTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, ErrTraceparent
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, ErrTraceparent
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, ErrTraceparent
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// Span — одна операция в трассе
+type Span struct {
+	mu sync.Mutex
+
+	Context  SpanContext
+	ParentID SpanID
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Attrs    map[string]any
+	Error    string
+
+	ended bool
+}
+
+// SetName переименовывает спан, например когда маршрут становится известен только после обработки запроса
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Name = name
+	s.mu.Unlock()
+}
+
+// SetAttr добавляет атрибут спана
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.Attrs == nil {
+		s.Attrs = make(map[string]any)
+	}
+	s.Attrs[key] = value
+	s.mu.Unlock()
+}
+
+// RecordError отмечает спан как завершившийся ошибкой
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Error = err.Error()
+	s.mu.Unlock()
+}
+
+// Finish завершает спан и передает его экспортеру; повторные вызовы ничего не делают
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	if e := getExporter(); e != nil && s.Context.Sampled {
+		e.Export(s)
+	}
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+	requestIDKey
+)
+
+// Start начинает спан name, дочерний к спану из ctx или к удаленному родителю из ContextWithRemote.
+// Без родителя начинается новая трасса.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	s := &Span{Name: name, Start: time.Now()}
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.Context.TraceID = parent.Context.TraceID
+		s.Context.Sampled = parent.Context.Sampled
+		s.ParentID = parent.Context.SpanID
+	} else if remote, ok := ctx.Value(remoteKey).(SpanContext); ok && remote.IsValid() {
+		s.Context.TraceID = remote.TraceID
+		s.Context.Sampled = remote.Sampled
+		s.ParentID = remote.SpanID
+	} else {
+		rand.Read(s.Context.TraceID[:])
+		s.Context.Sampled = true
+	}
+	rand.Read(s.Context.SpanID[:])
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+// Do выполняет fn внутри дочернего спана name и отмечает спан ошибкой, которую вернула fn
+func Do(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	ctx, span := Start(ctx, name)
+	defer span.Finish()
+	err := fn(ctx)
+	span.RecordError(err)
+	return err
+}
+
+// SpanFromContext возвращает текущий спан или nil
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+// ContextWithRemote задает родителя для следующего Start, например из входящего заголовка traceparent
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// ContextWithRequestID сохраняет идентификатор запроса
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID возвращает идентификатор запроса из ctx или пустую строку
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// NewRequestID генерирует случайный идентификатор запроса
+func NewRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
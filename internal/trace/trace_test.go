@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestTraceparent(t *testing.T) {
+	h := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(h)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("Unexpected span context %+v", sc)
+	}
+	if sc.Traceparent() != h {
+		t.Errorf("Expected %q, got %q", h, sc.Traceparent())
+	}
+
+	for _, bad := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+	} {
+		if _, err := ParseTraceparent(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, root := Start(ContextWithRemote(context.Background(), remote), "root")
+	if root.Context.TraceID != remote.TraceID || root.ParentID != remote.SpanID {
+		t.Errorf("Root span must continue the remote trace, got %+v", root.Context)
+	}
+
+	_, child := Start(ctx, "child")
+	if child.Context.TraceID != remote.TraceID || child.ParentID != root.Context.SpanID {
+		t.Errorf("Child span must be parented by root, got parent %s", child.ParentID)
+	}
+	if child.Context.SpanID == root.Context.SpanID {
+		t.Errorf("Spans must have distinct ids")
+	}
+
+	_, fresh := Start(context.Background(), "fresh")
+	if fresh.Context.TraceID.IsZero() || fresh.ParentID != (SpanID{}) || !fresh.Context.Sampled {
+		t.Errorf("Span without parent must start a new sampled trace, got %+v", fresh)
+	}
+}
+
+func TestExport(t *testing.T) {
+	var buf bytes.Buffer
+	SetExporter(NewWriterExporter(&buf))
+	defer SetExporter(nil)
+
+	ctx := ContextWithRequestID(context.Background(), "req-1")
+	err := Do(ctx, "store.GetOrders", func(ctx context.Context) error {
+		SpanFromContext(ctx).SetAttr("user_id", 7)
+		return errors.New("boom")
+	})
+	if err == nil || RequestID(ctx) != "req-1" {
+		t.Fatalf("Unexpected result: %v", err)
+	}
+
+	var rec spanRecord
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("Exported span is not JSON: %v\n%s", err, buf.String())
+	}
+	if rec.Name != "store.GetOrders" || rec.Error != "boom" || rec.Attrs["user_id"] != float64(7) || len(rec.TraceID) != 32 {
+		t.Errorf("Unexpected exported span %+v", rec)
+	}
+}
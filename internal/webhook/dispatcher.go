@@ -0,0 +1,164 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"gopher-market/internal/store"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	MaxAttempts  = 8
+	BaseBackoff  = 10 * time.Second
+	MaxBackoff   = 6 * time.Hour
+	PollInterval = 2 * time.Second
+	BatchSize    = 50
+	SendTimeout  = 10 * time.Second
+	// lease — на это время выбранная доставка скрывается от других реплик; пачка отправляется
+	// последовательно, поэтому аренда с запасом покрывает худший случай, когда каждый запрос ждет таймаута
+	lease = BatchSize*SendTimeout + time.Minute
+)
+
+// Заголовки, с которыми отправляется событие
+const (
+	HeaderEvent     = "X-Gophermart-Event"
+	HeaderDelivery  = "X-Gophermart-Delivery"
+	HeaderTimestamp = "X-Gophermart-Timestamp"
+	HeaderSignature = "X-Gophermart-Signature"
+)
+
+// deliveryStore — исходящая очередь доставок, ее реализует store.Database
+type deliveryStore interface {
+	ClaimWebhookDeliveries(limit int, lease time.Duration) ([]model.WebhookDelivery, error)
+	MarkWebhookDelivered(id, attempts, statusCode int) error
+	MarkWebhookFailed(id, attempts, statusCode int, lastError string, nextAttempt time.Time, dead bool) error
+}
+
+var _ deliveryStore = (*store.Database)(nil)
+
+// Dispatcher отправляет события из исходящей очереди webhook_deliveries
+type Dispatcher struct {
+	repo   deliveryStore
+	client *http.Client
+}
+
+func NewDispatcher(repo *store.Database) *Dispatcher {
+	return &Dispatcher{
+		repo:   repo,
+		client: &http.Client{Timeout: SendTimeout},
+	}
+}
+
+// Sign вычисляет подпись тела запроса: hex(HMAC-SHA256(secret, timestamp + "." + body)).
+// Получатель проверяет ее тем же способом и отбрасывает запросы со старым timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run опрашивает очередь до отмены контекста
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.dispatch(ctx)
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	deliveries, err := d.repo.ClaimWebhookDeliveries(BatchSize, lease)
+	if err != nil {
+		logging.Logg.Error("Failed to claim webhook deliveries", "error", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		statusCode, err := d.send(ctx, delivery)
+		if err == nil {
+			if err := d.repo.MarkWebhookDelivered(delivery.ID, delivery.Attempts, statusCode); err != nil {
+				logMarkError("Failed to mark webhook delivered", delivery.ID, err)
+			}
+			continue
+		}
+
+		attempts := delivery.Attempts + 1
+		dead := attempts >= MaxAttempts
+		logging.Logg.Warn("Webhook delivery failed",
+			"delivery", delivery.ID,
+			"url", delivery.URL,
+			"attempt", attempts,
+			"dead", dead,
+			"error", err,
+		)
+		if err := d.repo.MarkWebhookFailed(delivery.ID, delivery.Attempts, statusCode, err.Error(), time.Now().Add(backoff(attempts)), dead); err != nil {
+			logMarkError("Failed to mark webhook failed", delivery.ID, err)
+		}
+	}
+}
+
+// logMarkError логирует неудачную отметку попытки; потерянная аренда — не ошибка хранилища,
+// результат попытки уже учтен другой репликой
+func logMarkError(msg string, id int, err error) {
+	if errors.Is(err, store.ErrLeaseLost) {
+		logging.Logg.Warn(msg, "delivery", id, "error", err)
+		return
+	}
+	logging.Logg.Error(msg, "delivery", id, "error", err)
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery model.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, SendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff — экспоненциальная задержка перед следующей попыткой со случайным разбросом до 20%
+func backoff(attempts int) time.Duration {
+	delay := BaseBackoff << (attempts - 1)
+	if delay <= 0 || delay > MaxBackoff {
+		delay = MaxBackoff
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
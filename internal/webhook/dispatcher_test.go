@@ -0,0 +1,162 @@
+package webhook
+
+import (
+	"context"
+	"gopher-market/internal/logging"
+	"gopher-market/internal/model"
+	"gopher-market/internal/store"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	logging.Logg = logging.NewLogger("error", "text", "text", "console", "")
+	os.Exit(m.Run())
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"event":"test"}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=e6a22eb66e93669c75e7a035a110d9a2ccfa7cdef62d0ecb361671b92718ee9f"
+	got := Sign("secret", "1700000000", []byte(`{"event":"test"}`))
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if Sign("other", "1700000000", []byte(`{"event":"test"}`)) == got {
+		t.Error("Expected signature to depend on the secret")
+	}
+	if Sign("secret", "1700000001", []byte(`{"event":"test"}`)) == got {
+		t.Error("Expected signature to depend on the timestamp")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, base := range map[int]time.Duration{
+		1:  BaseBackoff,
+		2:  2 * BaseBackoff,
+		3:  4 * BaseBackoff,
+		8:  128 * BaseBackoff,
+		12: 2048 * BaseBackoff,
+		13: MaxBackoff,
+		64: MaxBackoff,
+	} {
+		for i := 0; i < 100; i++ {
+			if d := backoff(attempts); d < base || d > base+base/5 {
+				t.Fatalf("backoff(%d) = %v, expected between %v and %v", attempts, d, base, base+base/5)
+			}
+		}
+	}
+}
+
+type failure struct {
+	statusCode  int
+	lastError   string
+	nextAttempt time.Time
+	dead        bool
+}
+
+// fakeStore — исходящая очередь в памяти
+type fakeStore struct {
+	deliveries []model.WebhookDelivery
+	attempts   map[int]int // счетчик попыток в очереди, по нему проверяется аренда
+	delivered  map[int]int
+	failed     map[int]failure
+}
+
+func (f *fakeStore) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	deliveries := f.deliveries
+	f.deliveries = nil
+	return deliveries, nil
+}
+
+func (f *fakeStore) MarkWebhookDelivered(id, attempts, statusCode int) error {
+	if f.attempts[id] != attempts {
+		return store.ErrLeaseLost
+	}
+	f.attempts[id]++
+	f.delivered[id] = statusCode
+	return nil
+}
+
+func (f *fakeStore) MarkWebhookFailed(id, attempts, statusCode int, lastError string, nextAttempt time.Time, dead bool) error {
+	if f.attempts[id] != attempts {
+		return store.ErrLeaseLost
+	}
+	f.attempts[id]++
+	f.failed[id] = failure{statusCode, lastError, nextAttempt, dead}
+	return nil
+}
+
+func TestDispatch(t *testing.T) {
+	payload := []byte(`{"login":"user","current":100}`)
+	var signatureErr string
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(HeaderEvent) != model.WebhookBalanceChanged || r.Header.Get(HeaderDelivery) != "1" {
+			signatureErr = "unexpected event headers"
+		}
+		if r.Header.Get(HeaderSignature) != Sign("secret", r.Header.Get(HeaderTimestamp), body) {
+			signatureErr = "invalid signature"
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	repo := &fakeStore{
+		deliveries: []model.WebhookDelivery{
+			{ID: 1, URL: ok.URL, Secret: "secret", EventType: model.WebhookBalanceChanged, Payload: payload},
+			{ID: 2, URL: failing.URL, EventType: model.WebhookBalanceChanged, Payload: payload, Attempts: 2},
+			{ID: 3, URL: closed.URL, EventType: model.WebhookBalanceChanged, Payload: payload},
+			{ID: 4, URL: failing.URL, EventType: model.WebhookBalanceChanged, Payload: payload, Attempts: MaxAttempts - 1},
+			{ID: 5, URL: failing.URL, EventType: model.WebhookBalanceChanged, Payload: payload, Attempts: 1},
+		},
+		// Доставку 5 после истечения аренды уже отметила другая реплика
+		attempts:  map[int]int{1: 0, 2: 2, 3: 0, 4: MaxAttempts - 1, 5: 2},
+		delivered: make(map[int]int),
+		failed:    make(map[int]failure),
+	}
+	d := &Dispatcher{repo: repo, client: &http.Client{Timeout: time.Second}}
+	start := time.Now()
+	d.dispatch(context.Background())
+
+	if signatureErr != "" {
+		t.Error(signatureErr)
+	}
+	if len(repo.delivered) != 1 || repo.delivered[1] != http.StatusNoContent {
+		t.Errorf("Expected delivery 1 to be delivered with 204, got %v", repo.delivered)
+	}
+
+	retry := repo.failed[2]
+	if retry.dead || retry.statusCode != http.StatusServiceUnavailable || retry.lastError != "unexpected status code: "+strconv.Itoa(http.StatusServiceUnavailable) {
+		t.Errorf("Unexpected retry of delivery 2: %+v", retry)
+	}
+	if wait := retry.nextAttempt.Sub(start); wait < 4*BaseBackoff || wait > 4*BaseBackoff*6/5+time.Second {
+		t.Errorf("Expected delivery 2 to be retried after the third backoff, got %v", wait)
+	}
+
+	if unreachable := repo.failed[3]; unreachable.dead || unreachable.statusCode != 0 || unreachable.lastError == "" {
+		t.Errorf("Unexpected retry of unreachable delivery 3: %+v", unreachable)
+	}
+	if dead := repo.failed[4]; !dead.dead || dead.statusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected delivery 4 to be dead-lettered after %d attempts: %+v", MaxAttempts, dead)
+	}
+	if _, ok := repo.failed[5]; ok || repo.attempts[5] != 2 {
+		t.Errorf("Expected attempt of delivery 5 with a lost lease to be discarded, attempts %d", repo.attempts[5])
+	}
+}
+
+func TestLeaseCoversBatch(t *testing.T) {
+	if lease <= BatchSize*SendTimeout {
+		t.Errorf("Lease %v expires before a batch of %d deliveries times out (%v)", lease, BatchSize, BatchSize*SendTimeout)
+	}
+}